@@ -2,8 +2,10 @@ package main
 
 import (
 	"ai-agent/utils"
+	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/gateway"
 	"ai-agent/work-flows/models"
+	"ai-agent/work-flows/services"
 	"bufio"
 	"fmt"
 	"log"
@@ -23,15 +25,183 @@ func main() {
 	}
 
 	openRouterApiKey := os.Getenv("OPENROUTER_API_KEY")
-	if openRouterApiKey == "" {
+
+	if len(os.Args) > 1 {
+		runCommand(openRouterApiKey, os.Args[1:])
+		return
+	}
+
+	requireAPIKey(openRouterApiKey)
+	runEnglishChatbot(openRouterApiKey)
+}
+
+// requireAPIKey exits unless the configured backend has the key it needs.
+func requireAPIKey(apiKey string) {
+	if client.RequiresOpenRouterKey() && client.SharedKeyPool(apiKey).Len() == 0 {
 		red := color.New(color.FgRed, color.Bold)
 		yellow := color.New(color.FgYellow)
 		red.Println("✗ OPENROUTER_API_KEY environment variable is required")
 		yellow.Println("ℹ Please set your OpenRouter API key in the environment or .env file")
+		yellow.Println("ℹ For several keys, set OPENROUTER_API_KEYS (comma-separated) or OPENROUTER_API_KEYS_FILE")
+		yellow.Println("ℹ Or set LLM_BACKEND=openai_compatible and LLM_BASE_URL to use a local model")
 		os.Exit(1)
 	}
+}
 
-	runEnglishChatbot(openRouterApiKey)
+// runCommand handles the entry points that skip the interface menu: resume <session-id>,
+// sessions, export <session-id> [format], import <file> and assess <file|dir>...
+func runCommand(apiKey string, args []string) {
+	red := color.New(color.FgRed, color.Bold)
+	yellow := color.New(color.FgYellow)
+
+	switch args[0] {
+	case "resume":
+		if len(args) < 2 {
+			red.Println("✗ Usage: resume <session-id>")
+			yellow.Println("ℹ Run with 'sessions' to list saved sessions")
+			os.Exit(1)
+		}
+		requireAPIKey(apiKey)
+		runChatbotResume(apiKey, args[1])
+	case "sessions":
+		listSessions()
+	case "export":
+		if len(args) < 2 {
+			red.Println("✗ Usage: export <session-id> [markdown|html|csv|jsonl]")
+			os.Exit(1)
+		}
+		format := ""
+		if len(args) > 2 {
+			format = args[2]
+		}
+		exportSession(args[1], format)
+	case "import":
+		if len(args) < 2 {
+			red.Println("✗ Usage: import <history-export.json>")
+			os.Exit(1)
+		}
+		requireAPIKey(apiKey)
+		runChatbotImport(apiKey, args[1])
+	case "assess":
+		if len(args) < 2 {
+			red.Println("✗ Usage: assess <history-export.json|directory>...")
+			os.Exit(1)
+		}
+		requireAPIKey(apiKey)
+		runAssessTranscripts(apiKey, args[1:])
+	default:
+		red.Printf("✗ Unknown command: %s\n", args[0])
+		yellow.Println("ℹ Commands: resume <session-id>, sessions, export <session-id> [format], import <file>, assess <file|dir>...")
+		os.Exit(1)
+	}
+}
+
+func runChatbotResume(apiKey string, sessionID string) {
+	chatbot, err := gateway.ResumeChatbotOrchestrator(apiKey, sessionID)
+	if err != nil {
+		red := color.New(color.FgRed, color.Bold)
+		red.Printf("✗ Failed to resume session: %v\n", err)
+		os.Exit(1)
+	}
+	chatbot.ResumeConversation()
+}
+
+// runChatbotImport continues the conversation in a history export, asking for whatever the
+// export does not record.
+func runChatbotImport(apiKey string, path string) {
+	transcript, err := services.ReadHistoryExport(path)
+	if err != nil {
+		color.New(color.FgRed, color.Bold).Printf("✗ Failed to import: %v\n", err)
+		os.Exit(1)
+	}
+
+	topic, level, language := transcript.Topic, transcript.Level, transcript.Language
+	if topic == "" {
+		topic = getUserInput("sports")
+	}
+	if level == "" {
+		level = models.ConversationLevel(getConversationLevel())
+	}
+	if language == "" {
+		language = getLanguage()
+	}
+
+	chatbot := gateway.ImportChatbotOrchestrator(apiKey, transcript, topic, level, language)
+	chatbot.ResumeConversation()
+}
+
+// runAssessTranscripts assesses history exports in bulk; a directory stands for the .json files in it.
+func runAssessTranscripts(apiKey string, args []string) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			color.New(color.FgRed).Printf("✗ %v\n", err)
+			continue
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(arg, "*.json"))
+		for _, file := range files {
+			if !strings.HasSuffix(file, "_assessment.json") {
+				paths = append(paths, file)
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		color.New(color.FgYellow).Println("ℹ No transcripts to assess")
+		return
+	}
+	if gateway.AssessTranscriptFiles(apiKey, paths) < len(paths) {
+		os.Exit(1)
+	}
+}
+
+func exportSession(sessionID string, format string) {
+	red := color.New(color.FgRed, color.Bold)
+
+	store := services.SharedSessionStore()
+	if store == nil {
+		red.Println("✗ Session storage is disabled (SESSION_STORE=off)")
+		os.Exit(1)
+	}
+	record, err := store.Load(sessionID)
+	if err != nil {
+		red.Printf("✗ Failed to load session: %v\n", err)
+		os.Exit(1)
+	}
+	if err := gateway.ExportSessionTranscript(services.NewTranscript(record), format); err != nil {
+		red.Printf("✗ %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func listSessions() {
+	store := services.SharedSessionStore()
+	if store == nil {
+		color.New(color.FgYellow).Println("ℹ Session storage is disabled (SESSION_STORE=off)")
+		return
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		color.New(color.FgRed, color.Bold).Printf("✗ Failed to list sessions: %v\n", err)
+		os.Exit(1)
+	}
+	if len(sessions) == 0 {
+		color.New(color.FgYellow).Println("ℹ No saved sessions")
+		return
+	}
+
+	blue := color.New(color.FgCyan)
+	for _, session := range sessions {
+		blue.Printf("%-32s %-16s %-20s %3d turns  %s\n",
+			session.SessionID, session.Topic, session.Level, session.Turns,
+			session.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
 }
 
 func runEnglishChatbot(apiKey string) {
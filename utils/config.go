@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,6 +15,7 @@ var evaluatePromptMemCache *EvaluatePromptConfig
 var assessmentPromptMemCache *AssessmentPromptConfig
 var personalizeVocabPromptMemCache *PersonalizeVocabPromptConfig
 var personalizeLessonPromptMemCache *PersonalizeLessonPromptConfig
+var pricingMemCache *PricingConfig
 
 type ConversationPromptConfig struct {
 	Information InformationConfig      `yaml:"information"`
@@ -127,9 +129,68 @@ type PersonalizeLessonLevelConfig struct {
 }
 
 type LLMSettings struct {
-	Model       string  `yaml:"model"`
-	Temperature float64 `yaml:"temperature"`
-	MaxTokens   int     `yaml:"max_tokens"`
+	Model          string   `yaml:"model"`
+	Temperature    float64  `yaml:"temperature"`
+	MaxTokens      int      `yaml:"max_tokens"`
+	FallbackModels []string `yaml:"fallback_models"` // Tried in order when the primary model is unavailable
+	ProviderSort   string   `yaml:"provider_sort"`   // price, throughput or latency
+	Backend        string   `yaml:"backend"`         // Overrides LLM_BACKEND for this block, e.g. anthropic
+	Cache          bool     `yaml:"cache"`           // Serve identical requests from the response cache
+	CacheTTL       string   `yaml:"cache_ttl"`       // e.g. "6h"; empty uses the cache default
+	ContextTokens  int      `yaml:"context_tokens"`  // Prompt budget for system prompt, summary and history; 0 uses the default
+	SummaryModel   string   `yaml:"summary_model"`   // Cheap model that folds older turns into the running summary
+}
+
+var validProviderSorts = map[string]bool{
+	"price":      true,
+	"throughput": true,
+	"latency":    true,
+}
+
+// Normalize drops an unknown provider_sort, duplicate or empty fallback models, an invalid cache_ttl
+// and a negative context_tokens.
+func (s LLMSettings) Normalize() LLMSettings {
+	if s.ProviderSort != "" && !validProviderSorts[s.ProviderSort] {
+		PrintError(fmt.Sprintf("Ignoring unknown provider_sort %q (expected price, throughput or latency)", s.ProviderSort))
+		s.ProviderSort = ""
+	}
+
+	seen := map[string]bool{s.Model: true}
+	var fallbacks []string
+	for _, model := range s.FallbackModels {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		fallbacks = append(fallbacks, model)
+	}
+	s.FallbackModels = fallbacks
+
+	if s.CacheTTL != "" {
+		if ttl, err := time.ParseDuration(s.CacheTTL); err != nil || ttl <= 0 {
+			PrintError(fmt.Sprintf("Ignoring invalid cache_ttl %q", s.CacheTTL))
+			s.CacheTTL = ""
+		}
+	}
+
+	if s.ContextTokens < 0 {
+		PrintError(fmt.Sprintf("Ignoring negative context_tokens %d", s.ContextTokens))
+		s.ContextTokens = 0
+	}
+
+	return s
+}
+
+// ModelPrice is expressed in USD per one million tokens.
+type ModelPrice struct {
+	Prompt       float64 `yaml:"prompt"`
+	Completion   float64 `yaml:"completion"`
+	CachedPrompt float64 `yaml:"cached_prompt"` // Falls back to Prompt when zero
+}
+
+type PricingConfig struct {
+	Currency string                `yaml:"currency"`
+	Models   map[string]ModelPrice `yaml:"models"`
 }
 
 type LevelConfig struct {
@@ -198,33 +259,36 @@ func GetFullPrompt(path string, level string, promptType string) (string, string
 }
 
 func GetLLMSettingsFromLevel(path string, level string) (string, float64, int) {
+	llm := GetLLMConfigFromLevel(path, level)
+	return llm.Model, llm.Temperature, llm.MaxTokens
+}
+
+// GetLLMConfigFromLevel returns the full llm block for a level, with defaults applied.
+func GetLLMConfigFromLevel(path string, level string) LLMSettings {
+	defaults := LLMSettings{Model: "openai/gpt-4o-mini", Temperature: 0.7, MaxTokens: 1000}
+
 	prompts, err := LoadConversationPromptConfig(path)
 	if err != nil {
-		return "openai/gpt-4o-mini", 0.7, 1000
+		return defaults
 	}
 
 	levelConfig, exists := prompts.Levels[level]
 	if !exists {
-		return "openai/gpt-4o-mini", 0.7, 1000
+		return defaults
 	}
 
 	llm := levelConfig.LLM
-	model := llm.Model
-	if model == "" {
-		model = "openai/gpt-4o-mini"
+	if llm.Model == "" {
+		llm.Model = defaults.Model
 	}
-
-	temperature := llm.Temperature
-	if temperature == 0 {
-		temperature = 0.7
+	if llm.Temperature == 0 {
+		llm.Temperature = defaults.Temperature
 	}
-
-	maxTokens := llm.MaxTokens
-	if maxTokens == 0 {
-		maxTokens = 1000
+	if llm.MaxTokens == 0 {
+		llm.MaxTokens = defaults.MaxTokens
 	}
 
-	return model, temperature, maxTokens
+	return llm.Normalize()
 }
 
 func GetPromptsDir() string {
@@ -377,6 +441,34 @@ func ClearPersonalizeLessonPromptCache() {
 	personalizeLessonPromptMemCache = nil
 }
 
+func LoadPricingConfig() (*PricingConfig, error) {
+	if pricingMemCache != nil {
+		return pricingMemCache, nil
+	}
+
+	path := filepath.Join(GetPromptsDir(), "_pricing.yaml")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("pricing config file not found: %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing config file: %w", err)
+	}
+
+	var config PricingConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing YAML config: %w", err)
+	}
+
+	pricingMemCache = &config
+	return pricingMemCache, nil
+}
+
+func ClearPricingCache() {
+	pricingMemCache = nil
+}
+
 func ClearAllPromptCaches() {
 	ClearConversationPromptCache()
 	ClearSuggestionPromptCache()
@@ -384,4 +476,5 @@ func ClearAllPromptCaches() {
 	ClearAssessmentPromptCache()
 	ClearPersonalizeVocabPromptCache()
 	ClearPersonalizeLessonPromptCache()
+	ClearPricingCache()
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,7 +20,11 @@ type ExportData struct {
 	Data        any    `json:"data"`
 }
 
-func sanitizeString(s string) string {
+// ExportDir is where exports are written.
+const ExportDir = "exports"
+
+// SanitizeString replaces invalid UTF-8 so exported text always decodes.
+func SanitizeString(s string) string {
 	// Loại bỏ hoặc thay thế các ký tự có thể gây lỗi
 	if !utf8.ValidString(s) {
 		// Thay thế ký tự không hợp lệ bằng ký tự thay thế
@@ -28,21 +33,22 @@ func sanitizeString(s string) string {
 	return s
 }
 
-func decodeUTF8(data any) any {
+// DecodeUTF8 applies SanitizeString to every string, key and value, in decoded JSON data.
+func DecodeUTF8(data any) any {
 	switch v := data.(type) {
 	case string:
-		return sanitizeString(v)
+		return SanitizeString(v)
 	case map[string]any:
 		result := make(map[string]any)
 		for key, value := range v {
-			sanitizedKey := sanitizeString(key)
-			result[sanitizedKey] = decodeUTF8(value)
+			sanitizedKey := SanitizeString(key)
+			result[sanitizedKey] = DecodeUTF8(value)
 		}
 		return result
 	case []any:
 		result := make([]any, len(v))
 		for i, value := range v {
-			result[i] = decodeUTF8(value)
+			result[i] = DecodeUTF8(value)
 		}
 		return result
 	default:
@@ -51,17 +57,8 @@ func decodeUTF8(data any) any {
 }
 
 func ExportToJSON(filename string, data any, requestType, endpoint string, status int) {
-
-	exportDir := "exports"
-	if err := os.MkdirAll(exportDir, 0755); err != nil {
-		PrintError("Failed to create exports directory: " + err.Error())
-		return
-	}
-
-	filepath := filepath.Join(exportDir, filename)
-
 	// Decode UTF-8 data before export
-	decodedData := decodeUTF8(data)
+	decodedData := DecodeUTF8(data)
 
 	exportData := ExportData{
 		Timestamp:   time.Now().Format(time.RFC3339),
@@ -84,7 +81,7 @@ func ExportToJSON(filename string, data any, requestType, endpoint string, statu
 
 	jsonData := []byte(strings.TrimSpace(buf.String()))
 
-	err := os.WriteFile(filepath, jsonData, 0644)
+	filepath, err := WriteExportFile(filename, jsonData)
 	if err != nil {
 		PrintError("Failed to write JSON file: " + err.Error())
 		return
@@ -96,6 +93,19 @@ func ExportToJSON(filename string, data any, requestType, endpoint string, statu
 	cyan.Printf("📁 File location: %s\n", filepath)
 }
 
+// WriteExportFile writes data to filename in ExportDir and returns the file's path.
+func WriteExportFile(filename string, data []byte) (string, error) {
+	if err := os.MkdirAll(ExportDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create exports directory: %w", err)
+	}
+
+	path := filepath.Join(ExportDir, filename)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	return path, nil
+}
+
 func ParseExportFlag(input string) (string, bool) {
 	parts := strings.Fields(input)
 	for i, part := range parts {
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// StripCodeFence removes a surrounding ```json or ``` fence that models sometimes add around JSON.
+func StripCodeFence(response string) string {
+	clean := strings.TrimSpace(response)
+	if after, ok := strings.CutPrefix(clean, "```json"); ok {
+		clean = after
+	} else if after, ok := strings.CutPrefix(clean, "```"); ok {
+		clean = after
+	}
+	clean = strings.TrimSuffix(clean, "```")
+	return strings.TrimSpace(clean)
+}
+
+// ValidateJSONSchema parses a model reply and checks it against the subset of JSON Schema
+// our response formats use: type, properties, required, additionalProperties, enum, items,
+// minItems and maxItems. It returns the reply without code fences and every problem found.
+func ValidateJSONSchema(response string, schema map[string]any) (string, []string) {
+	clean := StripCodeFence(response)
+
+	var value any
+	if err := json.Unmarshal([]byte(clean), &value); err != nil {
+		return clean, []string{fmt.Sprintf("reply is not valid JSON: %v", err)}
+	}
+
+	var problems []string
+	validateSchemaValue(value, schema, "$", &problems)
+	return clean, problems
+}
+
+func validateSchemaValue(value any, schema map[string]any, path string, problems *[]string) {
+	if schemaType, ok := schema["type"].(string); ok && !matchesSchemaType(value, schemaType) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, schemaType, jsonTypeName(value)))
+		return
+	}
+
+	if enum := schemaStrings(schema["enum"]); len(enum) > 0 {
+		if s, ok := value.(string); !ok || !slices.Contains(enum, s) {
+			*problems = append(*problems, fmt.Sprintf("%s: must be one of %s", path, strings.Join(enum, ", ")))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+
+		for _, name := range schemaStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required field %q", path, name))
+			}
+		}
+
+		if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+			for _, name := range sortedFieldNames(v) {
+				if _, known := properties[name]; !known {
+					*problems = append(*problems, fmt.Sprintf("%s: unexpected field %q", path, name))
+				}
+			}
+		}
+
+		for _, name := range sortedFieldNames(v) {
+			if propSchema, ok := properties[name].(map[string]any); ok {
+				validateSchemaValue(v[name], propSchema, path+"."+name, problems)
+			}
+		}
+
+	case []any:
+		if minItems, ok := schemaInt(schema["minItems"]); ok && len(v) < minItems {
+			*problems = append(*problems, fmt.Sprintf("%s: expected at least %d items, got %d", path, minItems, len(v)))
+		}
+		if maxItems, ok := schemaInt(schema["maxItems"]); ok && len(v) > maxItems {
+			*problems = append(*problems, fmt.Sprintf("%s: expected at most %d items, got %d", path, maxItems, len(v)))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validateSchemaValue(item, items, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+func matchesSchemaType(value any, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return true
+	}
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// schemaStrings accepts both the []string used when building schemas in Go and the []any of decoded JSON.
+func schemaStrings(value any) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []any:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+func schemaInt(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+func sortedFieldNames(object map[string]any) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
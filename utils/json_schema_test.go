@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStripCodeFence(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{name: "plain", response: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "json fence", response: "```json\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{name: "bare fence", response: "```\n{\"a\": 1}\n```", want: `{"a": 1}`},
+		{name: "surrounding space", response: "  \n```json {\"a\": 1} ```\n ", want: `{"a": 1}`},
+		{name: "unclosed fence", response: "```json\n{\"a\": 1}", want: `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripCodeFence(tt.response); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema := map[string]any{
+		"type":                 "object",
+		"required":             []string{"status", "items"},
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"status": map[string]any{"type": "string", "enum": []string{"good", "bad"}},
+			"score":  map[string]any{"type": "integer"},
+			"items": map[string]any{
+				"type":     "array",
+				"minItems": 1,
+				"maxItems": 2,
+				"items":    map[string]any{"type": "string"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		response string
+		want     []string
+	}{
+		{name: "valid", response: "```json\n{\"status\": \"good\", \"score\": 3, \"items\": [\"a\"]}\n```"},
+		{name: "not json", response: "Sure! Here it is", want: []string{"reply is not valid JSON: invalid character 'S' looking for beginning of value"}},
+		{name: "wrong root type", response: `["good"]`, want: []string{"$: expected object, got array"}},
+		{
+			name:     "missing and unexpected fields",
+			response: `{"status": "good", "extra": true}`,
+			want:     []string{`$: missing required field "items"`, `$: unexpected field "extra"`},
+		},
+		{
+			name:     "enum, integer and item problems",
+			response: `{"status": "great", "score": 2.5, "items": ["a", 1, "c"]}`,
+			want: []string{
+				"$.items: expected at most 2 items, got 3",
+				"$.items[1]: expected string, got number",
+				"$.score: expected integer, got number",
+				"$.status: must be one of good, bad",
+			},
+		},
+		{name: "too few items", response: `{"status": "bad", "items": []}`, want: []string{"$.items: expected at least 1 items, got 0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problems := ValidateJSONSchema(tt.response, schema)
+			if !slices.Equal(problems, tt.want) {
+				t.Errorf("got problems\n%q\nwant\n%q", problems, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONFieldEvent is one part of a streamed JSON object that has been received in full:
+// either a top-level field, or one element of a top-level array field.
+type JSONFieldEvent struct {
+	Field string          `json:"field"`
+	Index int             `json:"index"` // Element index within an array field; -1 for the whole field
+	Value json.RawMessage `json:"value"`
+}
+
+// IsElement reports whether the event is a single array element rather than a whole field.
+func (e JSONFieldEvent) IsElement() bool {
+	return e.Index >= 0
+}
+
+// JSONStreamParser reads a JSON object in arbitrary chunks, such as the deltas of a streamed
+// structured reply, and reports each top-level field and array element as soon as it closes.
+// Text before the opening brace, like a code fence, and anything after the object are ignored.
+type JSONStreamParser struct {
+	buf      []byte
+	pos      int
+	started  bool
+	finished bool
+
+	depth    int
+	inString bool
+	escaped  bool
+
+	expectKey    bool
+	readingKey   bool
+	keyStart     int
+	key          string
+	awaitingVal  bool
+	valueStart   int
+	arrayField   bool
+	elementStart int
+	elementIndex int
+}
+
+func NewJSONStreamParser() *JSONStreamParser {
+	return &JSONStreamParser{
+		valueStart:   -1,
+		elementStart: -1,
+	}
+}
+
+// Write appends a chunk and returns the events completed by it, in document order.
+func (p *JSONStreamParser) Write(chunk string) []JSONFieldEvent {
+	p.buf = append(p.buf, chunk...)
+
+	var events []JSONFieldEvent
+	for ; p.pos < len(p.buf) && !p.finished; p.pos++ {
+		i, c := p.pos, p.buf[p.pos]
+
+		if !p.started {
+			if c == '{' {
+				p.started = true
+				p.depth = 1
+				p.expectKey = true
+			}
+			continue
+		}
+
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+				if p.readingKey {
+					p.readingKey = false
+					if err := json.Unmarshal(p.buf[p.keyStart:i+1], &p.key); err != nil {
+						p.key = ""
+					}
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+
+		case '"':
+			p.inString = true
+			if p.depth == 1 && p.expectKey {
+				p.expectKey = false
+				p.readingKey = true
+				p.keyStart = i
+			} else {
+				p.markValueStart(i)
+			}
+
+		case ':':
+			if p.depth == 1 {
+				p.awaitingVal = true
+			}
+
+		case '{', '[':
+			startsField := p.depth == 1 && p.awaitingVal
+			p.markValueStart(i)
+			p.depth++
+			if startsField && c == '[' {
+				p.arrayField = true
+				p.elementIndex = 0
+			}
+
+		case '}', ']':
+			// A scalar ends at the bracket that closes its container
+			if p.depth == 2 && p.arrayField && p.elementStart >= 0 {
+				events = p.appendElement(events, p.buf[p.elementStart:i])
+			}
+			if p.depth == 1 && p.valueStart >= 0 {
+				events = p.appendField(events, p.buf[p.valueStart:i])
+			}
+
+			p.depth--
+			switch {
+			case p.depth == 0:
+				p.finished = true
+			case p.depth == 2 && p.arrayField && p.elementStart >= 0:
+				events = p.appendElement(events, p.buf[p.elementStart:i+1])
+			case p.depth == 1 && p.valueStart >= 0:
+				events = p.appendField(events, p.buf[p.valueStart:i+1])
+				p.arrayField = false
+			}
+
+		case ',':
+			if p.depth == 2 && p.arrayField && p.elementStart >= 0 {
+				events = p.appendElement(events, p.buf[p.elementStart:i])
+			}
+			if p.depth == 1 {
+				if p.valueStart >= 0 {
+					events = p.appendField(events, p.buf[p.valueStart:i])
+				}
+				p.expectKey = true
+			}
+
+		default:
+			p.markValueStart(i)
+		}
+	}
+
+	return events
+}
+
+// Finished reports whether the closing brace of the object has been read.
+func (p *JSONStreamParser) Finished() bool {
+	return p.finished
+}
+
+func (p *JSONStreamParser) markValueStart(i int) {
+	switch {
+	case p.depth == 1 && p.awaitingVal:
+		p.awaitingVal = false
+		p.valueStart = i
+	case p.depth == 2 && p.arrayField && p.elementStart < 0:
+		p.elementStart = i
+	}
+}
+
+func (p *JSONStreamParser) appendField(events []JSONFieldEvent, raw []byte) []JSONFieldEvent {
+	p.valueStart = -1
+	return appendJSONEvent(events, p.key, -1, raw)
+}
+
+func (p *JSONStreamParser) appendElement(events []JSONFieldEvent, raw []byte) []JSONFieldEvent {
+	p.elementStart = -1
+	index := p.elementIndex
+	p.elementIndex++
+	return appendJSONEvent(events, p.key, index, raw)
+}
+
+// appendJSONEvent copies raw out of the parser's buffer and drops values that are not valid JSON.
+func appendJSONEvent(events []JSONFieldEvent, field string, index int, raw []byte) []JSONFieldEvent {
+	raw = bytes.TrimSpace(raw)
+	if field == "" || !json.Valid(raw) {
+		return events
+	}
+	return append(events, JSONFieldEvent{
+		Field: field,
+		Index: index,
+		Value: json.RawMessage(bytes.Clone(raw)),
+	})
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestJSONStreamParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		want     []string // Events as field[index]=value
+		finished bool
+	}{
+		{
+			name: "fields and array elements in document order",
+			doc:  "```json\n" + `{"status": "good", "tags": ["a", {"b": 1}, 3], "n": 42, "obj": {"x": "}"}, "esc": "q\"}"}` + "\n```",
+			want: []string{
+				`status[-1]="good"`,
+				`tags[0]="a"`,
+				`tags[1]={"b": 1}`,
+				`tags[2]=3`,
+				`tags[-1]=["a", {"b": 1}, 3]`,
+				`n[-1]=42`,
+				`obj[-1]={"x": "}"}`,
+				`esc[-1]="q\"}"`,
+			},
+			finished: true,
+		},
+		{
+			name:     "truncated object reports only closed values",
+			doc:      `{"status": "good", "tags": ["a", "b`,
+			want:     []string{`status[-1]="good"`, `tags[0]="a"`},
+			finished: false,
+		},
+		{
+			name:     "empty values",
+			doc:      `{"list": [], "empty": {}, "null": null}`,
+			want:     []string{`list[-1]=[]`, `empty[-1]={}`, `null[-1]=null`},
+			finished: true,
+		},
+		{
+			name:     "no object",
+			doc:      "not json at all",
+			finished: false,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, size := range []int{1, 3, len(tt.doc)} {
+			t.Run(fmt.Sprintf("%s/chunks of %d", tt.name, size), func(t *testing.T) {
+				parser := NewJSONStreamParser()
+				var got []string
+				for chunk := range slices.Chunk([]byte(tt.doc), size) {
+					for _, event := range parser.Write(string(chunk)) {
+						got = append(got, fmt.Sprintf("%s[%d]=%s", event.Field, event.Index, event.Value))
+					}
+				}
+
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("got events\n%q\nwant\n%q", got, tt.want)
+				}
+				if parser.Finished() != tt.finished {
+					t.Errorf("got finished %v, want %v", parser.Finished(), tt.finished)
+				}
+			})
+		}
+	}
+}
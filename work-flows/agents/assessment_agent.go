@@ -5,8 +5,10 @@ import (
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/models"
 	"ai-agent/work-flows/services"
+	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"strings"
 )
 
@@ -67,6 +69,7 @@ type AssessmentAgent struct {
 	model       string
 	temperature float64
 	maxTokens   int
+	routing     client.Routing
 	config      *utils.AssessmentPromptConfig
 }
 
@@ -113,6 +116,7 @@ func NewAssessmentAgent(
 	model := "openai/gpt-4o-mini"
 	temperature := 0.2
 	maxTokens := 800
+	var llm utils.LLMSettings
 
 	if config != nil {
 		if config.AssessmentAgent.LLM.Model != "" {
@@ -124,6 +128,7 @@ func NewAssessmentAgent(
 		if config.AssessmentAgent.LLM.MaxTokens > 0 {
 			maxTokens = config.AssessmentAgent.LLM.MaxTokens
 		}
+		llm = config.AssessmentAgent.LLM
 	}
 
 	return &AssessmentAgent{
@@ -133,6 +138,7 @@ func NewAssessmentAgent(
 		model:       model,
 		temperature: temperature,
 		maxTokens:   maxTokens,
+		routing:     llmRouting(llm),
 		config:      config,
 	}
 }
@@ -150,18 +156,15 @@ func (aa *AssessmentAgent) Capabilities() []string {
 	}
 }
 
-func (aa *AssessmentAgent) CanHandle(task string) bool {
-	return strings.Contains(strings.ToLower(task), "assess") ||
-		strings.Contains(strings.ToLower(task), "level") ||
-		strings.Contains(strings.ToLower(task), "proficiency") ||
-		strings.Contains(strings.ToLower(task), "evaluation")
+func (aa *AssessmentAgent) TaskTypes() []models.TaskType {
+	return []models.TaskType{models.TaskTypeAssessment}
 }
 
 func (aa *AssessmentAgent) GetDescription() string {
 	return "Analyzes conversation history to assess learner proficiency level and provide learning tips"
 }
 
-func (aa *AssessmentAgent) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (aa *AssessmentAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("AssessmentAgent processing task: %s", task.Task))
 
 	historyManager, ok := task.Metadata.(*services.ConversationHistoryManager)
@@ -174,10 +177,10 @@ func (aa *AssessmentAgent) ProcessTask(task models.JobRequest) *models.JobRespon
 		}
 	}
 
-	return aa.generateAssessment(historyManager)
+	return aa.generateAssessment(ctx, historyManager)
 }
 
-func (aa *AssessmentAgent) generateAssessment(historyManager *services.ConversationHistoryManager) *models.JobResponse {
+func (aa *AssessmentAgent) generateAssessment(ctx context.Context, historyManager *services.ConversationHistoryManager) *models.JobResponse {
 	conversationHistory := historyManager.GetConversationHistory()
 
 	if len(conversationHistory) == 0 {
@@ -205,7 +208,7 @@ func (aa *AssessmentAgent) generateAssessment(historyManager *services.Conversat
 	systemPrompt := aa.buildAssessmentPrompt()
 	userPrompt := aa.buildUserPrompt(filteredHistory)
 
-	messages := []models.Message{
+	messages := []models.ChatMessage{
 		{
 			Role:    models.MessageRoleSystem,
 			Content: systemPrompt,
@@ -217,14 +220,15 @@ func (aa *AssessmentAgent) generateAssessment(historyManager *services.Conversat
 	}
 
 	responseFormat := aa.buildResponseFormat()
-	response := aa.getResponseWithFormat(messages, responseFormat)
+	callCtx, callInfo := callContext(ctx, aa.Name(), aa.routing)
+	response, err := aa.getResponseWithFormat(callCtx, messages, responseFormat)
 
-	if response == "" {
+	if err != nil {
 		return &models.JobResponse{
 			AgentName: aa.Name(),
 			Success:   false,
 			Result:    "",
-			Error:     "Failed to generate assessment",
+			Error:     fmt.Sprintf("Failed to generate assessment: %v", err),
 		}
 	}
 
@@ -232,6 +236,7 @@ func (aa *AssessmentAgent) generateAssessment(historyManager *services.Conversat
 		AgentName: aa.Name(),
 		Success:   true,
 		Result:    response,
+		Model:     callInfo.Model,
 	}
 }
 
@@ -287,14 +292,9 @@ func (aa *AssessmentAgent) buildUserPrompt(history []models.Message) string {
 func (aa *AssessmentAgent) formatHistoryForPrompt(history []models.Message) string {
 	var builder strings.Builder
 
-	for _, msg := range history {
-		builder.WriteString(fmt.Sprintf("Message %d (%s): %s\n", msg.Index, msg.Role, msg.Content))
-
-		if msg.Role == models.MessageRoleUser && msg.Evaluation != nil {
-			builder.WriteString(fmt.Sprintf("  Evaluation: %s - %s\n", msg.Evaluation.Status, msg.Evaluation.ShortDescription))
-		}
-
-		builder.WriteString("\n")
+	// Each learner message carries a compact summary of its evaluation; the projection keeps one entry per message
+	for i, msg := range services.ProjectHistory(history, services.HistoryProjection{Evaluations: true}) {
+		builder.WriteString(fmt.Sprintf("Message %d (%s): %s\n\n", history[i].Index, msg.Role, msg.Content))
 	}
 
 	return builder.String()
@@ -348,51 +348,90 @@ func (aa *AssessmentAgent) buildResponseFormat() *models.ResponseFormat {
 	}
 }
 
-func (aa *AssessmentAgent) getResponseWithFormat(messages []models.Message, responseFormat *models.ResponseFormat) string {
-	response, err := aa.client.ChatCompletionWithFormat(aa.model, aa.temperature, aa.maxTokens, messages, responseFormat)
+// getResponseWithFormat returns the reply once it validates against the response schema.
+func (aa *AssessmentAgent) getResponseWithFormat(ctx context.Context, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	response, err := completeStructured(ctx, aa.client, aa.model, aa.temperature, aa.maxTokens, messages, responseFormat)
 	if err != nil {
 		utils.PrintError(fmt.Sprintf("Failed to get assessment response: %v", err))
-		return ""
+		return "", err
 	}
-	return response
+	return response, nil
 }
 
-func (aa *AssessmentAgent) GenerateAssessmentStream(historyManager *services.ConversationHistoryManager, progressChan chan<- models.AssessmentStreamResponse) {
-	defer close(progressChan)
+// assessmentPhases is the progress event sent once each field of the assessment has streamed in,
+// announcing the part the model is writing next.
+var assessmentPhases = map[string]models.AssessmentProgressEvent{
+	"level": {
+		Type:     "skills_evaluation",
+		Message:  "Đang đánh giá kỹ năng tổng quát...",
+		Progress: 30,
+	},
+	"general_skills": {
+		Type:     "grammar_tips",
+		Message:  "Đang phân tích ngữ pháp...",
+		Progress: 50,
+	},
+	"grammar_tips": {
+		Type:     "vocabulary_tips",
+		Message:  "Đang đánh giá từ vựng...",
+		Progress: 70,
+	},
+	"vocabulary_tips": {
+		Type:     "fluency_suggestions",
+		Message:  "Đang tạo gợi ý cải thiện độ trôi chảy...",
+		Progress: 85,
+	},
+	"fluency_suggestions": {
+		Type:     "vocabulary_suggestions",
+		Message:  "Đang tạo gợi ý từ vựng...",
+		Progress: 95,
+	},
+}
+
+// GenerateAssessmentStream yields each field of the assessment as a partial result while it
+// streams in, with progress events between them, then either the final result or an error. Stopping the range cancels the underlying request.
+func (aa *AssessmentAgent) GenerateAssessmentStream(ctx context.Context, historyManager *services.ConversationHistoryManager) iter.Seq[models.AssessmentStreamResponse] {
+	return func(yield func(models.AssessmentStreamResponse) bool) {
+		aa.generateAssessmentStream(ctx, historyManager, yield)
+	}
+}
 
+func (aa *AssessmentAgent) generateAssessmentStream(ctx context.Context, historyManager *services.ConversationHistoryManager, yield func(models.AssessmentStreamResponse) bool) {
 	conversationHistory := historyManager.GetConversationHistory()
 
 	if len(conversationHistory) == 0 {
-		progressChan <- models.AssessmentStreamResponse{
+		yield(models.AssessmentStreamResponse{
 			Error: "No conversation history available for assessment",
-		}
+		})
 		return
 	}
 
 	filteredHistory := aa.filterHistoryForAssessment(conversationHistory)
 
 	if len(filteredHistory) == 0 {
-		progressChan <- models.AssessmentStreamResponse{
+		yield(models.AssessmentStreamResponse{
 			Error: "No relevant messages found for assessment",
-		}
+		})
 		return
 	}
 
 	utils.PrintInfo(fmt.Sprintf("Analyzing %d messages for assessment", len(filteredHistory)))
 
 	// Send progress events for different phases
-	progressChan <- models.AssessmentStreamResponse{
+	if !yield(models.AssessmentStreamResponse{
 		ProgressEvent: &models.AssessmentProgressEvent{
 			Type:     "level_assessment",
 			Message:  "Đang đánh giá cấp độ ngôn ngữ...",
 			Progress: 10,
 		},
+	}) {
+		return
 	}
 
 	systemPrompt := aa.buildAssessmentPrompt()
 	userPrompt := aa.buildUserPrompt(filteredHistory)
 
-	messages := []models.Message{
+	messages := []models.ChatMessage{
 		{
 			Role:    models.MessageRoleSystem,
 			Content: systemPrompt,
@@ -405,170 +444,69 @@ func (aa *AssessmentAgent) GenerateAssessmentStream(historyManager *services.Con
 
 	responseFormat := aa.buildResponseFormat()
 
-	// Use streaming with format
-	streamResponseChan := make(chan models.StreamResponse, 100)
-	doneChan := make(chan bool)
-
-	go aa.client.ChatCompletionWithFormatStream(aa.model, aa.temperature, aa.maxTokens, messages, responseFormat, streamResponseChan, doneChan)
-
-	var fullResponse strings.Builder
-	var progressTracker int = 10
-	var lastProgressUpdate int = 10
-
-	streaming := true
-	for streaming {
-		select {
-		case streamResp := <-streamResponseChan:
-			if streamResp.Error != "" {
-				progressChan <- models.AssessmentStreamResponse{
-					Error: streamResp.Error,
-				}
-				return
-			}
-
-			if len(streamResp.Choices) > 0 && streamResp.Choices[0].Delta.Content != "" {
-				fullResponse.WriteString(streamResp.Choices[0].Delta.Content)
-
-				// Update progress based on response content analysis
-				currentLength := fullResponse.Len()
-				if currentLength > 0 {
-					// Estimate progress based on response length and content
-					progressTracker = aa.estimateProgressFromContent(fullResponse.String())
-
-					// Send progress updates at key milestones
-					if progressTracker >= 30 && lastProgressUpdate < 30 {
-						progressChan <- models.AssessmentStreamResponse{
-							ProgressEvent: &models.AssessmentProgressEvent{
-								Type:     "skills_evaluation",
-								Message:  "Đang đánh giá kỹ năng tổng quát...",
-								Progress: 30,
-							},
-						}
-						lastProgressUpdate = 30
-					} else if progressTracker >= 50 && lastProgressUpdate < 50 {
-						progressChan <- models.AssessmentStreamResponse{
-							ProgressEvent: &models.AssessmentProgressEvent{
-								Type:     "grammar_tips",
-								Message:  "Đang phân tích ngữ pháp...",
-								Progress: 50,
-							},
-						}
-						lastProgressUpdate = 50
-					} else if progressTracker >= 70 && lastProgressUpdate < 70 {
-						progressChan <- models.AssessmentStreamResponse{
-							ProgressEvent: &models.AssessmentProgressEvent{
-								Type:     "vocabulary_tips",
-								Message:  "Đang đánh giá từ vựng...",
-								Progress: 70,
-							},
-						}
-						lastProgressUpdate = 70
-					} else if progressTracker >= 85 && lastProgressUpdate < 85 {
-						progressChan <- models.AssessmentStreamResponse{
-							ProgressEvent: &models.AssessmentProgressEvent{
-								Type:     "fluency_suggestions",
-								Message:  "Đang tạo gợi ý cải thiện độ trôi chảy...",
-								Progress: 85,
-							},
-						}
-						lastProgressUpdate = 85
-					} else if progressTracker >= 95 && lastProgressUpdate < 95 {
-						progressChan <- models.AssessmentStreamResponse{
-							ProgressEvent: &models.AssessmentProgressEvent{
-								Type:     "vocabulary_suggestions",
-								Message:  "Đang tạo gợi ý từ vựng...",
-								Progress: 95,
-							},
-						}
-						lastProgressUpdate = 95
-					}
-				}
-			}
-
-			if len(streamResp.Choices) > 0 && streamResp.Choices[0].FinishReason != nil {
-				streaming = false
-			}
+	// Progress follows the fields as they complete, and each field is passed on as a partial result
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		case <-doneChan:
-			streaming = false
+	stopped := false
+	lastProgress := 10
+	streamCtx = WithFieldListener(streamCtx, func(event utils.JSONFieldEvent) {
+		if stopped {
+			return
+		}
+		if !yield(models.AssessmentStreamResponse{Partial: &event}) {
+			stopped = true
+			cancel()
+			return
 		}
-	}
 
-	finalResult := fullResponse.String()
-	if finalResult == "" {
-		progressChan <- models.AssessmentStreamResponse{
-			Error: "Failed to generate assessment",
+		phase, ok := assessmentPhases[event.Field]
+		if !ok || event.IsElement() || phase.Progress <= lastProgress {
+			return
 		}
+		lastProgress = phase.Progress
+		if !yield(models.AssessmentStreamResponse{ProgressEvent: &phase}) {
+			stopped = true
+			cancel()
+		}
+	})
+
+	callCtx, _ := callContext(streamCtx, aa.Name(), aa.routing)
+	finalResult, err := completeStructured(callCtx, aa.client, aa.model, aa.temperature, aa.maxTokens, messages, responseFormat)
+	if stopped {
+		return
+	}
+	if err != nil {
+		yield(models.AssessmentStreamResponse{
+			Error: fmt.Sprintf("Failed to generate assessment: %v", err),
+		})
 		return
 	}
 
 	// Send completion event
-	progressChan <- models.AssessmentStreamResponse{
+	if !yield(models.AssessmentStreamResponse{
 		ProgressEvent: &models.AssessmentProgressEvent{
 			Type:       "completed",
 			Message:    "Đánh giá hoàn thành!",
 			Progress:   100,
 			IsComplete: true,
 		},
+	}) {
+		return
 	}
 
 	// Send final result
-	progressChan <- models.AssessmentStreamResponse{
+	if !yield(models.AssessmentStreamResponse{
 		FinalResult: finalResult,
+	}) {
+		return
 	}
 }
 
-func (aa *AssessmentAgent) estimateProgressFromContent(content string) int {
-	// Analyze the JSON content to estimate progress
-	content = strings.ToLower(content)
-
-	// Check for different sections in the JSON response
-	hasLevel := strings.Contains(content, "\"level\"")
-	hasGeneralSkills := strings.Contains(content, "\"general_skills\"")
-	hasGrammarTips := strings.Contains(content, "\"grammar_tips\"")
-	hasVocabularyTips := strings.Contains(content, "\"vocabulary_tips\"")
-	hasFluencySuggestions := strings.Contains(content, "\"fluency_suggestions\"")
-	hasVocabularySuggestions := strings.Contains(content, "\"vocabulary_suggestions\"")
-
-	// Estimate progress based on which sections are present
-	if hasVocabularySuggestions {
-		return 95
-	} else if hasFluencySuggestions {
-		return 85
-	} else if hasVocabularyTips {
-		return 70
-	} else if hasGrammarTips {
-		return 50
-	} else if hasGeneralSkills {
-		return 30
-	} else if hasLevel {
-		return 20
-	}
-
-	// Default progress based on content length
-	length := len(content)
-	if length > 500 {
-		return 25
-	} else if length > 200 {
-		return 20
-	} else if length > 50 {
-		return 15
-	}
-
-	return 10
-}
-
 func (aa *AssessmentAgent) DisplayAssessment(jsonResponse string) {
 	var assessment AssessmentResponse
 
-	cleanJSON := strings.TrimSpace(jsonResponse)
-	if after, ok := strings.CutPrefix(cleanJSON, "```json"); ok {
-		cleanJSON = after
-	} else if after, ok := strings.CutPrefix(cleanJSON, "```"); ok {
-		cleanJSON = after
-	}
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+	cleanJSON := utils.StripCodeFence(jsonResponse)
 
 	err := json.Unmarshal([]byte(cleanJSON), &assessment)
 	if err != nil {
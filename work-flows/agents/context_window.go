@@ -0,0 +1,154 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/client"
+	"ai-agent/work-flows/models"
+	"ai-agent/work-flows/services"
+)
+
+const (
+	DefaultContextTokens = 6000
+	DefaultSummaryModel  = "openai/gpt-4o-mini"
+
+	summaryAgentName = "ConversationSummarizer"
+	summaryMaxTokens = 400
+)
+
+const summaryPrompt = `You keep a running summary of an English practice conversation between a learner and their tutor.
+Merge the new turns into the current summary. Keep what the tutor needs to continue naturally:
+the learner's name, interests and plans, topics already covered, questions left open, and mistakes the learner keeps making.
+Write in English, in plain sentences, under 150 words. Reply with the summary only.`
+
+// ContextWindow assembles the messages for a conversation turn within a token budget. The system
+// prompt and the newest turns are sent verbatim; older turns are folded into a running summary,
+// kept on the session's history, by a cheap model.
+type ContextWindow struct {
+	client       client.Client
+	history      *services.ConversationHistoryManager
+	budget       int
+	summaryModel string
+}
+
+func NewContextWindow(c client.Client, history *services.ConversationHistoryManager, llm utils.LLMSettings) *ContextWindow {
+	cw := &ContextWindow{
+		client:       c,
+		history:      history,
+		budget:       llm.ContextTokens,
+		summaryModel: llm.SummaryModel,
+	}
+	if cw.budget <= 0 {
+		cw.budget = DefaultContextTokens
+	}
+	if cw.summaryModel == "" {
+		cw.summaryModel = DefaultSummaryModel
+	}
+	return cw
+}
+
+// Build returns the system prompt, the running summary, as many recent turns as fit the budget
+// and the learner's new message. Once the history outgrows the budget, turns are folded until the
+// verbatim part fills half of it, so the summary is refreshed every few turns rather than every turn.
+func (cw *ContextWindow) Build(ctx context.Context, systemPrompt string, userMessage string) []models.ChatMessage {
+	history, summary := cw.history.SummarizedSnapshot()
+
+	pending := history
+	for len(pending) > 0 && pending[0].Index < summary.UpTo {
+		pending = pending[1:]
+	}
+
+	system := models.ChatMessage{Role: models.MessageRoleSystem, Content: systemPrompt}
+	user := models.ChatMessage{Role: models.MessageRoleUser, Content: userMessage}
+	fixed := services.EstimateMessageTokens(system) + services.EstimateMessageTokens(user)
+
+	recent := services.ProjectHistory(pending, services.HistoryProjection{})
+	keep := fitting(recent, cw.budget-fixed-summaryTokens(summary))
+
+	if keep < len(recent) {
+		fold := len(recent) - fitting(recent, (cw.budget-fixed)/2-summaryMaxTokens)
+		folded, err := cw.summarize(ctx, summary, pending[:fold])
+		if err != nil {
+			// The dropped turns stay unsummarized and are folded on a later turn
+			utils.PrintError(fmt.Sprintf("Failed to summarize %d older messages, dropping them from this turn: %v", fold, err))
+		} else {
+			cw.history.SetSummary(folded)
+			summary = folded
+			// The folded messages are in the summary now, so they must not be sent verbatim as well
+			keep = min(fitting(recent, cw.budget-fixed-summaryTokens(summary)), len(recent)-fold)
+		}
+	}
+
+	messages := []models.ChatMessage{system}
+	if summary.Text != "" {
+		messages = append(messages, summaryMessage(summary))
+	}
+	messages = append(messages, recent[len(recent)-keep:]...)
+	return append(messages, user)
+}
+
+// summarize folds messages into the running summary and returns the new summary.
+func (cw *ContextWindow) summarize(ctx context.Context, summary models.ConversationSummary, messages []models.Message) (models.ConversationSummary, error) {
+	if len(messages) == 0 {
+		return summary, nil
+	}
+
+	var turns strings.Builder
+	for _, msg := range messages {
+		speaker := "Tutor"
+		if msg.Role == models.MessageRoleUser {
+			speaker = "Learner"
+		}
+		turns.WriteString(fmt.Sprintf("%s: %s\n", speaker, msg.Content))
+	}
+
+	current := summary.Text
+	if current == "" {
+		current = "(none yet)"
+	}
+
+	callCtx, _ := callContext(ctx, summaryAgentName, client.Routing{})
+	text, err := cw.client.ChatCompletion(callCtx, cw.summaryModel, 0.2, summaryMaxTokens, []models.ChatMessage{
+		{Role: models.MessageRoleSystem, Content: summaryPrompt},
+		{Role: models.MessageRoleUser, Content: fmt.Sprintf("Current summary:\n%s\n\nNew turns:\n%s", current, turns.String())},
+	})
+	if err != nil {
+		return summary, err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return summary, fmt.Errorf("empty summary")
+	}
+
+	utils.PrintInfo(fmt.Sprintf("Folded %d messages into the conversation summary", len(messages)))
+	return models.ConversationSummary{Text: text, UpTo: messages[len(messages)-1].Index + 1}, nil
+}
+
+func summaryMessage(summary models.ConversationSummary) models.ChatMessage {
+	return models.ChatMessage{
+		Role:    models.MessageRoleSystem,
+		Content: "Summary of the earlier conversation:\n" + summary.Text,
+	}
+}
+
+func summaryTokens(summary models.ConversationSummary) int {
+	if summary.Text == "" {
+		return 0
+	}
+	return services.EstimateMessageTokens(summaryMessage(summary))
+}
+
+// fitting counts how many of the newest messages fit in budget tokens.
+func fitting(messages []models.ChatMessage, budget int) int {
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		used += services.EstimateMessageTokens(messages[i])
+		if used > budget {
+			return len(messages) - 1 - i
+		}
+	}
+	return len(messages)
+}
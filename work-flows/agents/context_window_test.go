@@ -0,0 +1,91 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+	"ai-agent/work-flows/services"
+)
+
+// summaryClient answers every ChatCompletion, which ContextWindow only uses to summarize, with a fixed summary.
+type summaryClient struct {
+	scriptedClient
+	summary string
+	err     error
+	calls   int
+}
+
+func (sc *summaryClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	sc.calls++
+	return sc.summary, sc.err
+}
+
+func TestContextWindowBuild(t *testing.T) {
+	const turns = 10
+	tests := []struct {
+		name       string
+		budget     int
+		err        error
+		wantCalls  int
+		wantFolded bool
+	}{
+		{name: "history within budget is sent verbatim", budget: 6000, wantCalls: 0},
+		{name: "older turns are folded into the summary", budget: 2000, wantCalls: 1, wantFolded: true},
+		{name: "failed summary drops older turns", budget: 2000, err: errors.New("unavailable"), wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := services.NewConversationHistoryManager()
+			for i := range turns {
+				history.AppendTurn(models.Turn{
+					User:  fmt.Sprintf("learner %d %s", i, strings.Repeat("a", 400)),
+					Reply: fmt.Sprintf("tutor %d %s", i, strings.Repeat("b", 400)),
+				})
+			}
+			fake := &summaryClient{summary: "The learner likes hiking.", err: tt.err}
+			cw := NewContextWindow(fake, history, utils.LLMSettings{ContextTokens: tt.budget})
+
+			messages := cw.Build(context.Background(), "system prompt", "new message")
+
+			if fake.calls != tt.wantCalls {
+				t.Errorf("got %d summary calls, want %d", fake.calls, tt.wantCalls)
+			}
+			if first, last := messages[0], messages[len(messages)-1]; first.Content != "system prompt" || last.Content != "new message" {
+				t.Fatalf("got first %q and last %q, want the system prompt and the new message", first.Content, last.Content)
+			}
+
+			summary := history.Summary()
+			hasSummary := len(messages) > 1 && messages[1].Role == models.MessageRoleSystem
+			if hasSummary != tt.wantFolded || (summary.Text != "") != tt.wantFolded {
+				t.Fatalf("got summary message %v and stored summary %+v, want folded %v", hasSummary, summary, tt.wantFolded)
+			}
+
+			verbatim := messages[1 : len(messages)-1]
+			if hasSummary {
+				verbatim = verbatim[1:]
+			}
+			if !tt.wantFolded && tt.err == nil && len(verbatim) != 2*turns {
+				t.Errorf("got %d history messages, want all %d", len(verbatim), 2*turns)
+			}
+			if tt.wantFolded && len(verbatim) == 0 {
+				t.Errorf("got no history messages, want the newest turns verbatim")
+			}
+
+			sent := make(map[string]bool)
+			for _, msg := range verbatim {
+				sent[msg.Content] = true
+			}
+			for _, msg := range history.Snapshot() {
+				if msg.Index < summary.UpTo && sent[msg.Content] {
+					t.Errorf("message %d is in the summary and was also sent verbatim", msg.Index)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package agents
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -27,10 +28,13 @@ type ConversationAgent struct {
 	model       string
 	temperature float64
 	maxTokens   int
+	routing     client.Routing
 	Topic       string
 	client      client.Client
 	level       models.ConversationLevel
 	history     *services.ConversationHistoryManager
+	tools       *ToolRegistry
+	window      *ContextWindow
 }
 
 func NewConversationAgent(
@@ -43,7 +47,7 @@ func NewConversationAgent(
 		level = models.ConversationLevelIntermediate
 	}
 
-	model, temperature, maxTokens := utils.GetLLMSettingsFromLevel(
+	llm := utils.GetLLMConfigFromLevel(
 		filepath.Join(utils.GetPromptsDir(), topic+"_prompt.yaml"),
 		string(level),
 	)
@@ -53,10 +57,13 @@ func NewConversationAgent(
 		client:      client,
 		level:       level,
 		Topic:       topic,
-		model:       model,
-		temperature: temperature,
-		maxTokens:   maxTokens,
+		model:       llm.Model,
+		temperature: llm.Temperature,
+		maxTokens:   llm.MaxTokens,
+		routing:     llmRouting(llm),
 		history:     history,
+		tools:       conversationTools(history),
+		window:      NewContextWindow(client, history, llm),
 	}
 }
 
@@ -73,24 +80,22 @@ func (ca *ConversationAgent) Capabilities() []string {
 	}
 }
 
-func (ca *ConversationAgent) CanHandle(task string) bool {
-	return strings.Contains(strings.ToLower(task), "conversation") ||
-		strings.Contains(strings.ToLower(task), "chat") ||
-		strings.Contains(strings.ToLower(task), "talk")
+func (ca *ConversationAgent) TaskTypes() []models.TaskType {
+	return []models.TaskType{models.TaskTypeConversation}
 }
 
 func (ca *ConversationAgent) GetDescription() string {
 	return "Handles English conversation with learners, providing appropriate responses for practice"
 }
 
-func (ca *ConversationAgent) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (ca *ConversationAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("ConversationAgent processing task: %s", task.Task))
 
 	if task.UserMessage == "" {
 		return ca.generateConversationStarter()
 	}
 
-	return ca.generateConversationalResponse(task, ca.model, ca.temperature, ca.maxTokens)
+	return ca.generateConversationalResponse(ctx, task, ca.model, ca.temperature, ca.maxTokens)
 }
 
 func (ca *ConversationAgent) generateConversationStarter() *models.JobResponse {
@@ -98,17 +103,20 @@ func (ca *ConversationAgent) generateConversationStarter() *models.JobResponse {
 	pathPrompts := filepath.Join(utils.GetPromptsDir(), ca.Topic+"_prompt.yaml")
 	starterMessage := GetLevelSpecificPrompt(pathPrompts, ca.level, "starter")
 
-	ca.history.AddToHistory(models.MessageRoleAssistant, starterMessage)
+	turn := models.Turn{Reply: starterMessage}
+	turn.Index = ca.history.AppendTurn(turn)
 	response := &models.JobResponse{
 		AgentName: ca.Name(),
 		Success:   true,
 		Result:    starterMessage,
+		Turn:      &turn,
 	}
 	fmt.Println("💬 Starter message: ", starterMessage)
 	return response
 }
 
 func (ca *ConversationAgent) generateConversationalResponse(
+	ctx context.Context,
 	task models.JobRequest,
 	model string,
 	temperature float64,
@@ -118,30 +126,26 @@ func (ca *ConversationAgent) generateConversationalResponse(
 	if task.Level != "" {
 		conversationLevel = task.Level
 	}
-	pathPrompts := filepath.Join(utils.GetPromptsDir(), ca.Topic+"_prompt.yaml")
-	levelPrompt := GetLevelSpecificPrompt(pathPrompts, conversationLevel, "conversational")
+	messages := ca.buildMessages(ctx, conversationLevel, task.UserMessage)
 
-	messages := []models.Message{
-		{
-			Role:    models.MessageRoleSystem,
-			Content: levelPrompt,
-		},
-	}
+	fmt.Println("💬 Responding...")
+	callCtx, callInfo := callContext(ctx, ca.Name(), ca.routing)
+	result := ca.getStreamingResponse(callCtx, messages, "", model, temperature, maxTokens)
+	response := result.Content
 
-	history := ca.history.GetConversationHistory()
-	if len(history) > 0 {
-		// recentHistory := ca.history.GetRecentHistory(6)
-		messages = append(messages, history...)
+	if !result.Complete() {
+		// A cut-off or failed reply is not saved, so the learner can simply send the message again
+		utils.PrintError(fmt.Sprintf("Conversational response %s: %s", result.Status, result.Message()))
+		return &models.JobResponse{
+			AgentName: ca.Name(),
+			Success:   false,
+			Result:    response,
+			Error:     result.Message(),
+			Model:     callInfo.Model,
+			Metadata:  result,
+		}
 	}
 
-	messages = append(messages, models.Message{
-		Role:    models.MessageRoleUser,
-		Content: task.UserMessage,
-	})
-
-	fmt.Println("💬 Responding...")
-	response := ca.getStreamingResponse(messages, "", model, temperature, maxTokens)
-
 	if response == "" {
 		utils.PrintError("Conversational response failed")
 		return &models.JobResponse{
@@ -152,16 +156,32 @@ func (ca *ConversationAgent) generateConversationalResponse(
 		}
 	}
 
-	ca.history.AddToHistory(models.MessageRoleUser, task.UserMessage)
-	ca.history.AddToHistory(models.MessageRoleAssistant, response)
+	turn := models.Turn{User: task.UserMessage, Reply: response}
+	turn.Index = ca.history.AppendTurn(turn)
 
 	return &models.JobResponse{
 		AgentName: ca.Name(),
 		Success:   true,
 		Result:    response,
+		Model:     callInfo.Model,
+		Turn:      &turn,
 	}
 }
 
+// BuildMessages assembles the prompt for the learner's next message: the level prompt, the running
+// summary of older turns and the recent history that fits the context budget. Call it before the
+// message is added to the history.
+func (ca *ConversationAgent) BuildMessages(ctx context.Context, userMessage string) []models.ChatMessage {
+	return ca.buildMessages(ctx, ca.level, userMessage)
+}
+
+func (ca *ConversationAgent) buildMessages(ctx context.Context, level models.ConversationLevel, userMessage string) []models.ChatMessage {
+	pathPrompts := filepath.Join(utils.GetPromptsDir(), ca.Topic+"_prompt.yaml")
+	levelPrompt := GetLevelSpecificPrompt(pathPrompts, level, "conversational")
+
+	return ca.window.Build(ctx, levelPrompt, userMessage)
+}
+
 func (ca *ConversationAgent) GetClient() client.Client {
 	return ca.client
 }
@@ -178,6 +198,12 @@ func (ca *ConversationAgent) GetMaxTokens() int {
 	return ca.maxTokens
 }
 
+// CallContext prepares ctx for a conversation call made outside ProcessTask, such as the web stream.
+func (ca *ConversationAgent) CallContext(ctx context.Context) context.Context {
+	callCtx, _ := callContext(ctx, ca.Name(), ca.routing)
+	return callCtx
+}
+
 func (ca *ConversationAgent) GetTopic() string {
 	return ca.Topic
 }
@@ -241,36 +267,117 @@ func (ca *ConversationAgent) showVietnameseTranslation(text string) {
 }
 
 func (ca *ConversationAgent) getStreamingResponse(
-	messages []models.Message,
+	ctx context.Context,
+	messages []models.ChatMessage,
 	prefix string,
 	model string,
 	temperature float64,
 	maxTokens int,
-) string {
+) models.StreamResult {
 	fmt.Print(prefix)
 
-	streamResponseChan := make(chan models.StreamResponse, 10)
-	done := make(chan bool)
+	var collector client.StreamCollector
+	result := collector.Collect(ca.StreamReply(ctx, model, temperature, maxTokens, messages), func(delta string) {
+		fmt.Print(delta)
+	})
 
-	go ca.client.ChatCompletionStream(model, temperature, maxTokens, messages, streamResponseChan, done)
+	if result.Complete() {
+		ca.showVietnameseTranslation(result.Content)
+	} else {
+		fmt.Printf("\n⚠️  %s\n", result.Message())
+	}
+	return result
+}
+
+// StreamReply streams a reply like client.ChatCompletionStream, but lets the model call the
+// agent's tools first. Tool-call rounds are run here and only the final text reaches the caller:
+// text is passed on as it arrives until a round starts calling a tool, and the rest of that
+// round's text is dropped. A model whose backend rejects tools is asked again without them.
+func (ca *ConversationAgent) StreamReply(
+	ctx context.Context,
+	model string,
+	temperature float64,
+	maxTokens int,
+	messages []models.ChatMessage,
+) client.Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		conversation := append([]models.ChatMessage{}, messages...)
+
+		for round := 0; ; round++ {
+			roundCtx := ctx
+			_, unsupported := toolsUnsupported.Load(model)
+			toolRound := round < maxToolRounds && ca.tools.Len() > 0 && !unsupported
+			if toolRound {
+				roundCtx = client.WithTools(ctx, ca.tools.Definitions())
+			}
 
-	var fullResponse strings.Builder
+			var collector client.StreamCollector
+			sent := false
+			callingTools := false
+			var streamErr error
+			for chunk, err := range ca.client.ChatCompletionStream(roundCtx, model, temperature, maxTokens, conversation) {
+				if err != nil {
+					streamErr = err
+					break
+				}
+				collector.Add(chunk)
+				if len(chunk.Choices) > 0 && len(chunk.Choices[0].Delta.ToolCalls) > 0 {
+					callingTools = true
+				}
+				if callingTools {
+					continue
+				}
+				sent = true
+				if !yield(withoutToolCalls(chunk), nil) {
+					return
+				}
+			}
 
-	for {
-		select {
-		case <-done:
-			fullText := fullResponse.String()
-			ca.showVietnameseTranslation(fullText)
-			return fullText
-		case streamResponse := <-streamResponseChan:
-			if len(streamResponse.Choices) > 0 && streamResponse.Choices[0].Delta.Content != "" {
-				fullResponse.WriteString(streamResponse.Choices[0].Delta.Content)
-				fmt.Print(streamResponse.Choices[0].Delta.Content)
+			if streamErr != nil && toolRound && !sent && rejectsTools(streamErr) {
+				utils.PrintInfo(fmt.Sprintf("%s rejected tool calls, answering without tools: %v", model, streamErr))
+				toolsUnsupported.Store(model, true)
+				round--
+				continue
+			}
+			if streamErr != nil {
+				yield(models.StreamResponse{}, streamErr)
+				return
+			}
+
+			result := collector.Result()
+			if len(result.ToolCalls) == 0 || !result.Complete() {
+				return
+			}
+
+			conversation = append(conversation, models.ChatMessage{
+				Role:      models.MessageRoleAssistant,
+				Content:   result.Content,
+				ToolCalls: result.ToolCalls,
+			})
+			for _, call := range result.ToolCalls {
+				conversation = append(conversation, ca.tools.Run(ctx, call))
 			}
 		}
 	}
 }
 
+// withoutToolCalls hides a tool-call round from the caller: its deltas and its tool_calls
+// finish reason, which would otherwise end the caller's stream before the real reply.
+func withoutToolCalls(chunk models.StreamResponse) models.StreamResponse {
+	if len(chunk.Choices) == 0 {
+		return chunk
+	}
+
+	choices := append([]models.StreamChoice{}, chunk.Choices...)
+	choices[0].Delta.ToolCalls = nil
+	if choices[0].FinishReason != nil && *choices[0].FinishReason == "tool_calls" {
+		choices[0].FinishReason = nil
+		choices[0].NativeFinishReason = nil
+	}
+	chunk.Choices = choices
+	return chunk
+}
+
 func (ca *ConversationAgent) GetTitle() string {
 	// Load title from prompt
 	pathPrompts := filepath.Join(utils.GetPromptsDir(), ca.Topic+"_prompt.yaml")
@@ -0,0 +1,142 @@
+package agents
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"ai-agent/work-flows/client"
+	"ai-agent/work-flows/models"
+)
+
+// scriptedClient streams one scripted round per call and records whether each call offered tools,
+// which StreamReply does by deriving a new context from base.
+type scriptedClient struct {
+	base       context.Context
+	rounds     []func() ([]models.StreamResponse, error)
+	toolOffers []bool
+}
+
+func (sc *scriptedClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	return "", nil
+}
+
+func (sc *scriptedClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	return "", nil
+}
+
+func (sc *scriptedClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) client.Stream {
+	return sc.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+}
+
+func (sc *scriptedClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) client.Stream {
+	offered := ctx != sc.base
+	sc.toolOffers = append(sc.toolOffers, offered)
+	round := sc.rounds[len(sc.toolOffers)-1]
+	return func(yield func(models.StreamResponse, error) bool) {
+		chunks, err := round()
+		for _, chunk := range chunks {
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(models.StreamResponse{}, err)
+		}
+	}
+}
+
+func textChunk(text string) models.StreamResponse {
+	return models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{Content: text}}}}
+}
+
+func finishChunk(reason string) models.StreamResponse {
+	return models.StreamResponse{Choices: []models.StreamChoice{{FinishReason: &reason}}}
+}
+
+func toolCallChunk(name string) models.StreamResponse {
+	return models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{ToolCalls: []models.ToolCallDelta{
+		{Index: 0, ID: "call_1", Type: "function", Function: models.ToolCallFunction{Name: name, Arguments: "{}"}},
+	}}}}}
+}
+
+func TestStreamReply(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		rounds     []func() ([]models.StreamResponse, error)
+		want       string
+		deltas     int // Chunks expected to reach the caller; 0 to skip the check
+		toolOffers []bool
+	}{
+		{
+			name:  "text is forwarded chunk by chunk",
+			model: "plain",
+			rounds: []func() ([]models.StreamResponse, error){
+				func() ([]models.StreamResponse, error) {
+					return []models.StreamResponse{textChunk("Hello"), textChunk(" there"), finishChunk("stop")}, nil
+				},
+			},
+			want:       "Hello there",
+			deltas:     2,
+			toolOffers: []bool{true},
+		},
+		{
+			name:  "text after a tool call is dropped",
+			model: "tools",
+			rounds: []func() ([]models.StreamResponse, error){
+				func() ([]models.StreamResponse, error) {
+					return []models.StreamResponse{toolCallChunk("unknown_tool"), textChunk("ignored"), finishChunk("tool_calls")}, nil
+				},
+				func() ([]models.StreamResponse, error) {
+					return []models.StreamResponse{textChunk("Answer"), finishChunk("stop")}, nil
+				},
+			},
+			want:       "Answer",
+			toolOffers: []bool{true, true},
+		},
+		{
+			name:  "rejected tools are retried without them",
+			model: "no-tools",
+			rounds: []func() ([]models.StreamResponse, error){
+				func() ([]models.StreamResponse, error) {
+					return nil, &client.APIError{StatusCode: http.StatusBadRequest, Message: "model does not support tools"}
+				},
+				func() ([]models.StreamResponse, error) {
+					return []models.StreamResponse{textChunk("Answer"), finishChunk("stop")}, nil
+				},
+			},
+			want:       "Answer",
+			toolOffers: []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := &scriptedClient{base: ctx, rounds: tt.rounds}
+			agent := &ConversationAgent{client: fake, tools: conversationTools(nil)}
+
+			var deltas []string
+			var collector client.StreamCollector
+			result := collector.Collect(agent.StreamReply(ctx, tt.model, 0, 0, nil), func(delta string) {
+				deltas = append(deltas, delta)
+			})
+
+			if result.Content != tt.want || !result.Complete() {
+				t.Fatalf("got %q (%s), want complete %q", result.Content, result.Status, tt.want)
+			}
+			if tt.deltas > 0 && len(deltas) != tt.deltas {
+				t.Errorf("got deltas %q, want each chunk forwarded", deltas)
+			}
+			if len(fake.toolOffers) != len(tt.toolOffers) {
+				t.Fatalf("got %d calls, want %d", len(fake.toolOffers), len(tt.toolOffers))
+			}
+			for i, offered := range tt.toolOffers {
+				if fake.toolOffers[i] != offered {
+					t.Errorf("call %d offered tools = %v, want %v", i, fake.toolOffers[i], offered)
+				}
+			}
+		})
+	}
+}
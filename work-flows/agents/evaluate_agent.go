@@ -4,6 +4,7 @@ import (
 	"ai-agent/utils"
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -18,6 +19,7 @@ type EvaluateAgent struct {
 	model       string
 	temperature float64
 	maxTokens   int
+	routing     client.Routing
 	config      *utils.EvaluatePromptConfig
 }
 
@@ -44,6 +46,7 @@ func NewEvaluateAgent(
 	model := "openai/gpt-4o-mini"
 	temperature := 0.3
 	maxTokens := 500
+	var llm utils.LLMSettings
 
 	if config != nil {
 		if config.EvaluateAgent.LLM.Model != "" {
@@ -55,6 +58,7 @@ func NewEvaluateAgent(
 		if config.EvaluateAgent.LLM.MaxTokens > 0 {
 			maxTokens = config.EvaluateAgent.LLM.MaxTokens
 		}
+		llm = config.EvaluateAgent.LLM
 	}
 
 	return &EvaluateAgent{
@@ -66,6 +70,7 @@ func NewEvaluateAgent(
 		model:       model,
 		temperature: temperature,
 		maxTokens:   maxTokens,
+		routing:     llmRouting(llm),
 		config:      config,
 	}
 }
@@ -82,23 +87,21 @@ func (ea *EvaluateAgent) Capabilities() []string {
 	}
 }
 
-func (ea *EvaluateAgent) CanHandle(task string) bool {
-	return strings.Contains(strings.ToLower(task), "evaluate") ||
-		strings.Contains(strings.ToLower(task), "check") ||
-		strings.Contains(strings.ToLower(task), "feedback")
+func (ea *EvaluateAgent) TaskTypes() []models.TaskType {
+	return []models.TaskType{models.TaskTypeEvaluation}
 }
 
 func (ea *EvaluateAgent) GetDescription() string {
 	return "Evaluates learner responses and provides constructive feedback on grammar, vocabulary, and structure"
 }
 
-func (ea *EvaluateAgent) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (ea *EvaluateAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("EvaluateAgent processing task: %s", task.Task))
 
-	return ea.generateEvaluation(task)
+	return ea.generateEvaluation(ctx, task)
 }
 
-func (ea *EvaluateAgent) generateEvaluation(task models.JobRequest) *models.JobResponse {
+func (ea *EvaluateAgent) generateEvaluation(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	userMessage := task.UserMessage
 	lastAIMessage := task.LastAIMessage
 
@@ -116,7 +119,7 @@ func (ea *EvaluateAgent) generateEvaluation(task models.JobRequest) *models.JobR
 	systemPrompt := ea.buildEvaluatePrompt()
 	userPrompt := ea.buildUserPrompt(userMessage, lastAIMessage)
 
-	messages := []models.Message{
+	messages := []models.ChatMessage{
 		{
 			Role:    models.MessageRoleSystem,
 			Content: systemPrompt,
@@ -128,14 +131,15 @@ func (ea *EvaluateAgent) generateEvaluation(task models.JobRequest) *models.JobR
 	}
 
 	responseFormat := ea.buildResponseFormat()
-	response := ea.getResponseWithFormat(messages, responseFormat)
+	callCtx, callInfo := callContext(ctx, ea.Name(), ea.routing)
+	response, err := ea.getResponseWithFormat(callCtx, messages, responseFormat)
 
-	if response == "" {
+	if err != nil {
 		return &models.JobResponse{
 			AgentName: ea.Name(),
 			Success:   false,
 			Result:    "",
-			Error:     "Failed to generate evaluation",
+			Error:     fmt.Sprintf("Failed to generate evaluation: %v", err),
 		}
 	}
 
@@ -143,6 +147,7 @@ func (ea *EvaluateAgent) generateEvaluation(task models.JobRequest) *models.JobR
 		AgentName: ea.Name(),
 		Success:   true,
 		Result:    response,
+		Model:     callInfo.Model,
 	}
 }
 
@@ -293,28 +298,20 @@ func (ea *EvaluateAgent) buildResponseFormat() *models.ResponseFormat {
 	}
 }
 
-func (ea *EvaluateAgent) getResponseWithFormat(messages []models.Message, responseFormat *models.ResponseFormat) string {
-	response, err := ea.client.ChatCompletionWithFormat(ea.model, ea.temperature, ea.maxTokens, messages, responseFormat)
+// getResponseWithFormat returns the reply once it validates against the response schema.
+func (ea *EvaluateAgent) getResponseWithFormat(ctx context.Context, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	response, err := completeStructured(ctx, ea.client, ea.model, ea.temperature, ea.maxTokens, messages, responseFormat)
 	if err != nil {
 		utils.PrintError(fmt.Sprintf("Failed to get evaluation response: %v", err))
-		return ""
+		return "", err
 	}
-	return response
+	return response, nil
 }
 
 func (ea *EvaluateAgent) DisplayEvaluation(jsonResponse string) {
 	var evaluation models.EvaluationResponse
 
-	cleanJSON := strings.TrimSpace(jsonResponse)
-	if after, ok := strings.CutPrefix(cleanJSON, "```json"); ok {
-		cleanJSON = after
-		cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-		cleanJSON = strings.TrimSpace(cleanJSON)
-	} else if strings.HasPrefix(cleanJSON, "```") {
-		cleanJSON = strings.TrimPrefix(cleanJSON, "```")
-		cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-		cleanJSON = strings.TrimSpace(cleanJSON)
-	}
+	cleanJSON := utils.StripCodeFence(jsonResponse)
 
 	err := json.Unmarshal([]byte(cleanJSON), &evaluation)
 	if err != nil {
@@ -361,14 +358,7 @@ func (ea *EvaluateAgent) GetLevel() models.ConversationLevel {
 }
 
 func ParseEvaluationResponse(jsonResponse string) (*models.EvaluationResponse, error) {
-	cleanJSON := strings.TrimSpace(jsonResponse)
-	if after, ok := strings.CutPrefix(cleanJSON, "```json"); ok {
-		cleanJSON = after
-	} else if after, ok := strings.CutPrefix(cleanJSON, "```"); ok {
-		cleanJSON = after
-	}
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+	cleanJSON := utils.StripCodeFence(jsonResponse)
 
 	var evaluation models.EvaluationResponse
 	err := json.Unmarshal([]byte(cleanJSON), &evaluation)
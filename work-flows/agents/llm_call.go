@@ -0,0 +1,21 @@
+package agents
+
+import (
+	"context"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/client"
+)
+
+// callContext tags the call with the agent name and fallback routing, and attaches a
+// CallInfo the client fills in so the agent can report which model actually answered.
+func callContext(ctx context.Context, agentName string, routing client.Routing) (context.Context, *client.CallInfo) {
+	info := &client.CallInfo{}
+	ctx = client.WithAgentName(client.WithRouting(ctx, routing), agentName)
+	return client.WithCallInfo(ctx, info), info
+}
+
+// llmRouting reads the fallback chain from a prompt's llm block.
+func llmRouting(settings utils.LLMSettings) client.Routing {
+	return client.RoutingFromSettings(settings)
+}
@@ -4,6 +4,7 @@ import (
 	"ai-agent/utils"
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -23,6 +24,7 @@ type PersonalizeLessonAgent struct {
 	model       string
 	temperature float64
 	maxTokens   int
+	routing     client.Routing
 	config      *utils.PersonalizeLessonPromptConfig
 }
 
@@ -36,6 +38,7 @@ func NewPersonalizeLessonAgent(client client.Client) *PersonalizeLessonAgent {
 	model := defaultModelPersonalizeLesson
 	temperature := defaultTemperaturePersonalizeLesson
 	maxTokens := defaultMaxTokensPersonalizeLesson
+	var llm utils.LLMSettings
 
 	if config != nil {
 		if config.PersonalizeLessonAgent.LLM.Model != "" {
@@ -47,6 +50,7 @@ func NewPersonalizeLessonAgent(client client.Client) *PersonalizeLessonAgent {
 		if config.PersonalizeLessonAgent.LLM.MaxTokens > 0 {
 			maxTokens = config.PersonalizeLessonAgent.LLM.MaxTokens
 		}
+		llm = config.PersonalizeLessonAgent.LLM
 	}
 
 	return &PersonalizeLessonAgent{
@@ -55,6 +59,7 @@ func NewPersonalizeLessonAgent(client client.Client) *PersonalizeLessonAgent {
 		model:       model,
 		temperature: temperature,
 		maxTokens:   maxTokens,
+		routing:     llmRouting(llm),
 		config:      config,
 	}
 }
@@ -72,33 +77,28 @@ func (pla *PersonalizeLessonAgent) Capabilities() []string {
 	}
 }
 
-func (pla *PersonalizeLessonAgent) CanHandle(task string) bool {
-	return strings.Contains(strings.ToLower(task), "personalize") ||
-		strings.Contains(strings.ToLower(task), "lesson") ||
-		strings.Contains(strings.ToLower(task), "detail") ||
-		strings.Contains(strings.ToLower(task), "create") ||
-		strings.Contains(strings.ToLower(task), "vocabulary") ||
-		strings.Contains(strings.ToLower(task), "vocab")
+func (pla *PersonalizeLessonAgent) TaskTypes() []models.TaskType {
+	return []models.TaskType{models.TaskTypePersonalizeLesson}
 }
 
 func (pla *PersonalizeLessonAgent) GetDescription() string {
 	return "Creates personalized lesson details with emoji, title, description, and 4 essential vocabulary items based on user preferences"
 }
 
-func (pla *PersonalizeLessonAgent) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (pla *PersonalizeLessonAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("PersonalizeLessonAgent processing task: %s", task.Task))
 
-	return pla.generatePersonalizedLesson(task)
+	return pla.generatePersonalizedLesson(ctx, task)
 }
 
-func (pla *PersonalizeLessonAgent) generatePersonalizedLesson(task models.JobRequest) *models.JobResponse {
+func (pla *PersonalizeLessonAgent) generatePersonalizedLesson(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	// Extract topic, level, and language from metadata
 	topic, level, language := pla.extractMetadata(task.Metadata)
 
 	systemPrompt := pla.buildPersonalizePrompt(level)
 	userPrompt := pla.buildUserPrompt(topic, level, language)
 
-	messages := []models.Message{
+	messages := []models.ChatMessage{
 		{
 			Role:    models.MessageRoleSystem,
 			Content: systemPrompt,
@@ -110,14 +110,15 @@ func (pla *PersonalizeLessonAgent) generatePersonalizedLesson(task models.JobReq
 	}
 
 	responseFormat := pla.buildResponseFormat()
-	response := pla.getResponseWithFormat(messages, responseFormat)
+	callCtx, callInfo := callContext(ctx, pla.Name(), pla.routing)
+	response, err := pla.getResponseWithFormat(callCtx, messages, responseFormat)
 
-	if response == "" {
+	if err != nil {
 		return &models.JobResponse{
 			AgentName: pla.Name(),
 			Success:   false,
 			Result:    "",
-			Error:     "Failed to generate personalized lesson",
+			Error:     fmt.Sprintf("Failed to generate personalized lesson: %v", err),
 		}
 	}
 
@@ -125,6 +126,7 @@ func (pla *PersonalizeLessonAgent) generatePersonalizedLesson(task models.JobReq
 		AgentName: pla.Name(),
 		Success:   true,
 		Result:    response,
+		Model:     callInfo.Model,
 	}
 }
 
@@ -346,26 +348,20 @@ func (pla *PersonalizeLessonAgent) buildResponseFormat() *models.ResponseFormat
 	}
 }
 
-func (pla *PersonalizeLessonAgent) getResponseWithFormat(messages []models.Message, responseFormat *models.ResponseFormat) string {
-	response, err := pla.client.ChatCompletionWithFormat(pla.model, pla.temperature, pla.maxTokens, messages, responseFormat)
+// getResponseWithFormat returns the reply once it validates against the response schema.
+func (pla *PersonalizeLessonAgent) getResponseWithFormat(ctx context.Context, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	response, err := completeStructured(ctx, pla.client, pla.model, pla.temperature, pla.maxTokens, messages, responseFormat)
 	if err != nil {
 		utils.PrintError(fmt.Sprintf("Failed to get personalize lesson response: %v", err))
-		return ""
+		return "", err
 	}
-	return response
+	return response, nil
 }
 
 func (pla *PersonalizeLessonAgent) DisplayPersonalizedLesson(jsonResponse string) {
 	var lesson models.PersonalizeLessonResponse
 
-	cleanJSON := strings.TrimSpace(jsonResponse)
-	if after, ok := strings.CutPrefix(cleanJSON, "```json"); ok {
-		cleanJSON = after
-	} else if after, ok := strings.CutPrefix(cleanJSON, "```"); ok {
-		cleanJSON = after
-	}
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+	cleanJSON := utils.StripCodeFence(jsonResponse)
 
 	err := json.Unmarshal([]byte(cleanJSON), &lesson)
 	if err != nil {
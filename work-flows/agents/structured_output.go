@@ -0,0 +1,199 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/client"
+	"ai-agent/work-flows/models"
+)
+
+// structuredOutputAttempts bounds the first request plus the re-prompts after invalid replies.
+const structuredOutputAttempts = 3
+
+// jsonSchemaUnsupported remembers models whose provider rejected json_schema, so later calls go straight to JSON mode.
+var jsonSchemaUnsupported sync.Map
+
+// SchemaError is returned when a reply still fails validation after every repair attempt.
+type SchemaError struct {
+	Schema   string
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("response did not match %s after %d attempts: %s", e.Schema, structuredOutputAttempts, strings.Join(e.Problems, "; "))
+}
+
+type fieldListenerKey struct{}
+
+// FieldListener receives each top-level field and array element of a structured reply as soon as it has streamed in.
+type FieldListener func(event utils.JSONFieldEvent)
+
+// WithFieldListener makes structured calls made with the returned context stream their reply
+// and report its fields to listener, instead of waiting for the whole reply.
+func WithFieldListener(ctx context.Context, listener FieldListener) context.Context {
+	return context.WithValue(ctx, fieldListenerKey{}, listener)
+}
+
+func fieldListenerFromContext(ctx context.Context) FieldListener {
+	listener, _ := ctx.Value(fieldListenerKey{}).(FieldListener)
+	return listener
+}
+
+// completeStructured asks for a reply in responseFormat, validates it against the format's
+// schema and re-prompts with the validation errors until it passes. With a FieldListener in
+// ctx the first reply is streamed and parsed as it arrives.
+func completeStructured(ctx context.Context, c client.Client, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	var response string
+	var err error
+	if listener := fieldListenerFromContext(ctx); listener != nil {
+		response, err = streamWithFormat(ctx, c, model, temperature, maxTokens, messages, responseFormat, listener)
+	} else {
+		response, err = chatWithFormat(ctx, c, model, temperature, maxTokens, messages, responseFormat)
+	}
+	if err != nil {
+		return "", err
+	}
+	return repairStructured(ctx, c, model, temperature, maxTokens, messages, responseFormat, response)
+}
+
+// streamWithFormat streams a structured reply through a JSONStreamParser, passing every completed
+// field to listener. Like chatWithFormat it falls back to JSON mode when json_schema is rejected.
+func streamWithFormat(ctx context.Context, c client.Client, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, listener FieldListener) (string, error) {
+	requestMessages, requestFormat := messages, responseFormat
+	if _, unsupported := jsonSchemaUnsupported.Load(model); unsupported {
+		requestMessages, requestFormat = jsonObjectFallback(messages, responseFormat)
+	}
+
+	for {
+		parser := utils.NewJSONStreamParser()
+		var collector client.StreamCollector
+		var streamErr error
+		for chunk, err := range c.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, requestMessages, requestFormat) {
+			if err != nil {
+				streamErr = err
+				break
+			}
+			for _, event := range parser.Write(collector.Add(chunk)) {
+				listener(event)
+			}
+		}
+
+		if streamErr != nil && collector.Content() == "" && requestFormat == responseFormat && rejectsJSONSchema(streamErr, responseFormat) {
+			utils.PrintInfo(fmt.Sprintf("%s rejected json_schema, falling back to JSON mode: %v", model, streamErr))
+			jsonSchemaUnsupported.Store(model, true)
+			requestMessages, requestFormat = jsonObjectFallback(messages, responseFormat)
+			continue
+		}
+		if streamErr != nil {
+			return "", streamErr
+		}
+
+		result := collector.Result()
+		if !result.Complete() {
+			return "", errors.New(result.Message())
+		}
+		return result.Content, nil
+	}
+}
+
+// repairStructured validates a reply that has already been received, e.g. from a stream,
+// and runs the re-prompt loop if it does not match the schema.
+func repairStructured(ctx context.Context, c client.Client, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, response string) (string, error) {
+	if responseFormat == nil || responseFormat.JSONSchema == nil {
+		return utils.StripCodeFence(response), nil
+	}
+
+	schemaName := responseFormat.JSONSchema.Name
+	conversation := append([]models.ChatMessage{}, messages...)
+
+	for attempt := 1; ; attempt++ {
+		clean, problems := utils.ValidateJSONSchema(response, responseFormat.JSONSchema.Schema)
+		if len(problems) == 0 {
+			return clean, nil
+		}
+
+		utils.PrintError(fmt.Sprintf("Reply for %s failed validation (attempt %d/%d): %s", schemaName, attempt, structuredOutputAttempts, strings.Join(problems, "; ")))
+		if attempt >= structuredOutputAttempts {
+			return "", &SchemaError{Schema: schemaName, Problems: problems}
+		}
+
+		conversation = append(conversation,
+			models.ChatMessage{Role: models.MessageRoleAssistant, Content: response},
+			models.ChatMessage{Role: models.MessageRoleUser, Content: repairPrompt(problems)},
+		)
+
+		var err error
+		response, err = chatWithFormat(ctx, c, model, temperature, maxTokens, conversation, responseFormat)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func repairPrompt(problems []string) string {
+	var builder strings.Builder
+	builder.WriteString("Your previous reply did not match the required JSON schema:\n")
+	for _, problem := range problems {
+		builder.WriteString(fmt.Sprintf("- %s\n", problem))
+	}
+	builder.WriteString("\nReply again with only the corrected JSON object, without code fences or commentary.")
+	return builder.String()
+}
+
+// chatWithFormat sends the request with json_schema, degrading to json_object with the schema
+// in the prompt when the provider rejects json_schema.
+func chatWithFormat(ctx context.Context, c client.Client, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	if _, unsupported := jsonSchemaUnsupported.Load(model); unsupported {
+		fallbackMessages, fallbackFormat := jsonObjectFallback(messages, responseFormat)
+		return c.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, fallbackMessages, fallbackFormat)
+	}
+
+	response, err := c.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+	if err != nil && rejectsJSONSchema(err, responseFormat) {
+		utils.PrintInfo(fmt.Sprintf("%s rejected json_schema, falling back to JSON mode: %v", model, err))
+		jsonSchemaUnsupported.Store(model, true)
+
+		fallbackMessages, fallbackFormat := jsonObjectFallback(messages, responseFormat)
+		return c.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, fallbackMessages, fallbackFormat)
+	}
+	return response, err
+}
+
+func rejectsJSONSchema(err error, responseFormat *models.ResponseFormat) bool {
+	if responseFormat == nil || responseFormat.Type != "json_schema" {
+		return false
+	}
+
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "json_schema") ||
+		strings.Contains(message, "response_format") ||
+		strings.Contains(message, "structured output")
+}
+
+// jsonObjectFallback switches to plain JSON mode and moves the schema into a system message.
+func jsonObjectFallback(messages []models.ChatMessage, responseFormat *models.ResponseFormat) ([]models.ChatMessage, *models.ResponseFormat) {
+	schema, _ := json.MarshalIndent(responseFormat.JSONSchema.Schema, "", "  ")
+
+	fallback := append([]models.ChatMessage{}, messages...)
+	fallback = append(fallback, models.ChatMessage{
+		Role:    models.MessageRoleSystem,
+		Content: fmt.Sprintf("Respond with a single JSON object that matches this JSON schema exactly:\n%s", schema),
+	})
+
+	return fallback, &models.ResponseFormat{Type: "json_object"}
+}
@@ -4,6 +4,7 @@ import (
 	"ai-agent/utils"
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/models"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -18,6 +19,7 @@ type SuggestionAgent struct {
 	model       string
 	temperature float64
 	maxTokens   int
+	routing     client.Routing
 	config      *utils.SuggestionPromptConfig
 }
 
@@ -44,6 +46,7 @@ func NewSuggestionAgent(
 	model := "openai/gpt-4o-mini"
 	temperature := 0.7
 	maxTokens := 150
+	var llm utils.LLMSettings
 
 	if config != nil {
 		if config.SuggestionAgent.LLM.Model != "" {
@@ -55,6 +58,7 @@ func NewSuggestionAgent(
 		if config.SuggestionAgent.LLM.MaxTokens > 0 {
 			maxTokens = config.SuggestionAgent.LLM.MaxTokens
 		}
+		llm = config.SuggestionAgent.LLM
 	}
 
 	return &SuggestionAgent{
@@ -66,6 +70,7 @@ func NewSuggestionAgent(
 		model:       model,
 		temperature: temperature,
 		maxTokens:   maxTokens,
+		routing:     llmRouting(llm),
 		config:      config,
 	}
 }
@@ -82,29 +87,27 @@ func (sa *SuggestionAgent) Capabilities() []string {
 	}
 }
 
-func (sa *SuggestionAgent) CanHandle(task string) bool {
-	return strings.Contains(strings.ToLower(task), "suggestion") ||
-		strings.Contains(strings.ToLower(task), "vocab") ||
-		strings.Contains(strings.ToLower(task), "help")
+func (sa *SuggestionAgent) TaskTypes() []models.TaskType {
+	return []models.TaskType{models.TaskTypeSuggestion}
 }
 
 func (sa *SuggestionAgent) GetDescription() string {
 	return "Provides vocabulary suggestions and sentence starters to help users respond in conversations"
 }
 
-func (sa *SuggestionAgent) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (sa *SuggestionAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("SuggestionAgent processing task: %s", task.Task))
 
-	return sa.generateSuggestions(task)
+	return sa.generateSuggestions(ctx, task)
 }
 
-func (sa *SuggestionAgent) generateSuggestions(task models.JobRequest) *models.JobResponse {
+func (sa *SuggestionAgent) generateSuggestions(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	lastMessage := task.LastAIMessage
 	utils.PrintInfo(fmt.Sprintf("Last AI message: %s", lastMessage))
 	systemPrompt := sa.buildSuggestionPrompt()
 	userPrompt := sa.buildUserPrompt(lastMessage)
 
-	messages := []models.Message{
+	messages := []models.ChatMessage{
 		{
 			Role:    models.MessageRoleSystem,
 			Content: systemPrompt,
@@ -116,14 +119,15 @@ func (sa *SuggestionAgent) generateSuggestions(task models.JobRequest) *models.J
 	}
 
 	responseFormat := sa.buildResponseFormat()
-	response := sa.getResponseWithFormat(messages, responseFormat)
+	callCtx, callInfo := callContext(ctx, sa.Name(), sa.routing)
+	response, err := sa.getResponseWithFormat(callCtx, messages, responseFormat)
 
-	if response == "" {
+	if err != nil {
 		return &models.JobResponse{
 			AgentName: sa.Name(),
 			Success:   false,
 			Result:    "",
-			Error:     "Failed to generate suggestions",
+			Error:     fmt.Sprintf("Failed to generate suggestions: %v", err),
 		}
 	}
 
@@ -131,6 +135,7 @@ func (sa *SuggestionAgent) generateSuggestions(task models.JobRequest) *models.J
 		AgentName: sa.Name(),
 		Success:   true,
 		Result:    response,
+		Model:     callInfo.Model,
 	}
 }
 
@@ -284,26 +289,20 @@ func (sa *SuggestionAgent) buildResponseFormat() *models.ResponseFormat {
 	}
 }
 
-func (sa *SuggestionAgent) getResponseWithFormat(messages []models.Message, responseFormat *models.ResponseFormat) string {
-	response, err := sa.client.ChatCompletionWithFormat(sa.model, sa.temperature, sa.maxTokens, messages, responseFormat)
+// getResponseWithFormat returns the reply once it validates against the response schema.
+func (sa *SuggestionAgent) getResponseWithFormat(ctx context.Context, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	response, err := completeStructured(ctx, sa.client, sa.model, sa.temperature, sa.maxTokens, messages, responseFormat)
 	if err != nil {
 		utils.PrintError(fmt.Sprintf("Failed to get suggestion response: %v", err))
-		return ""
+		return "", err
 	}
-	return response
+	return response, nil
 }
 
 func (sa *SuggestionAgent) DisplaySuggestions(jsonResponse string) {
 	var suggestion models.SuggestionResponse
 
-	cleanJSON := strings.TrimSpace(jsonResponse)
-	if after, ok := strings.CutPrefix(cleanJSON, "```json"); ok {
-		cleanJSON = after
-	} else if after, ok := strings.CutPrefix(cleanJSON, "```"); ok {
-		cleanJSON = after
-	}
-	cleanJSON = strings.TrimSuffix(cleanJSON, "```")
-	cleanJSON = strings.TrimSpace(cleanJSON)
+	cleanJSON := utils.StripCodeFence(jsonResponse)
 
 	err := json.Unmarshal([]byte(cleanJSON), &suggestion)
 	if err != nil {
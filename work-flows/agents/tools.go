@@ -0,0 +1,177 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/client"
+	"ai-agent/work-flows/models"
+	"ai-agent/work-flows/services"
+)
+
+// maxToolRounds bounds how many times a reply may stop to run tools before it must answer in text.
+const maxToolRounds = 3
+
+// toolsUnsupported remembers models whose backend rejected tool definitions, so later replies skip them.
+var toolsUnsupported sync.Map
+
+// rejectsTools reports whether err is a backend refusing a request because it carries tools,
+// as Ollama models without tool support and OpenRouter routes without tool-capable endpoints do.
+func rejectsTools(err error) bool {
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity:
+	default:
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "tool") || strings.Contains(message, "function call")
+}
+
+// ToolHandler runs a tool with the JSON arguments the model chose and returns the result sent back to it.
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (string, error)
+
+// ToolRegistry holds the tools an agent offers the model, in registration order.
+type ToolRegistry struct {
+	definitions []models.Tool
+	handlers    map[string]ToolHandler
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		handlers: make(map[string]ToolHandler),
+	}
+}
+
+// Register adds a tool; parameters is the JSON schema of its arguments.
+func (tr *ToolRegistry) Register(name string, description string, parameters map[string]any, handler ToolHandler) {
+	tr.definitions = append(tr.definitions, models.Tool{
+		Type: "function",
+		Function: models.ToolFunction{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	})
+	tr.handlers[name] = handler
+}
+
+func (tr *ToolRegistry) Definitions() []models.Tool {
+	return tr.definitions
+}
+
+func (tr *ToolRegistry) Len() int {
+	return len(tr.definitions)
+}
+
+// Run executes a tool call and returns the tool message answering it. Failures are reported
+// to the model as the result, so it can recover instead of the whole reply failing.
+func (tr *ToolRegistry) Run(ctx context.Context, call models.ToolCall) models.ChatMessage {
+	result := models.ChatMessage{Role: models.MessageRoleTool, ToolCallID: call.ID}
+
+	handler, ok := tr.handlers[call.Function.Name]
+	if !ok {
+		result.Content = fmt.Sprintf("Error: unknown tool %q", call.Function.Name)
+		return result
+	}
+
+	arguments := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		arguments = json.RawMessage("{}")
+	}
+
+	utils.PrintInfo(fmt.Sprintf("Running tool %s(%s)", call.Function.Name, arguments))
+	output, err := handler(ctx, arguments)
+	if err != nil {
+		utils.PrintError(fmt.Sprintf("Tool %s failed: %v", call.Function.Name, err))
+		result.Content = fmt.Sprintf("Error: %v", err)
+		return result
+	}
+
+	result.Content = output
+	return result
+}
+
+// conversationTools are the tools ConversationAgent may call while replying.
+func conversationTools(history *services.ConversationHistoryManager) *ToolRegistry {
+	tools := NewToolRegistry()
+
+	tools.Register(
+		"lookup_dictionary",
+		"Look up the definitions and an example sentence of an English word, to explain it accurately to the learner.",
+		map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"word": map[string]any{"type": "string", "description": "The English word to look up"},
+			},
+			"required": []any{"word"},
+		},
+		func(ctx context.Context, arguments json.RawMessage) (string, error) {
+			var args struct {
+				Word string `json:"word"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+
+			entry, err := services.LookupWord(ctx, args.Word)
+			if err != nil {
+				return "", err
+			}
+			return toolJSON(entry)
+		},
+	)
+
+	tools.Register(
+		"check_saved_vocabulary",
+		"List the vocabulary suggested to the learner earlier in this conversation and whether they have used each phrase yet. Pass a word to check only that phrase.",
+		map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"word": map[string]any{"type": "string", "description": "Optional phrase to check"},
+			},
+		},
+		func(ctx context.Context, arguments json.RawMessage) (string, error) {
+			var args struct {
+				Word string `json:"word"`
+			}
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+
+			saved := history.SavedVocabulary()
+			if word := strings.ToLower(strings.TrimSpace(args.Word)); word != "" {
+				var matches []models.SavedVocab
+				for _, vocab := range saved {
+					if strings.Contains(strings.ToLower(vocab.Text), word) {
+						matches = append(matches, vocab)
+					}
+				}
+				saved = matches
+			}
+			if len(saved) == 0 {
+				return "No saved vocabulary matches.", nil
+			}
+			return toolJSON(saved)
+		},
+	)
+
+	return tools
+}
+
+func toolJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tool result: %w", err)
+	}
+	return string(data), nil
+}
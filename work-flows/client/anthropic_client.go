@@ -0,0 +1,531 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	AnthropicBaseURL  = "https://api.anthropic.com/v1"
+	AnthropicVersion  = "2023-06-01"
+	AnthropicProvider = "Anthropic"
+)
+
+// anthropicClient speaks the Anthropic Messages API directly.
+type anthropicClient struct {
+	apiKey      string
+	client      *http.Client
+	baseURL     string
+	retryPolicy RetryPolicy
+}
+
+func NewAnthropicClient(apiKey string) *anthropicClient {
+	return &anthropicClient{
+		apiKey:      apiKey,
+		client:      &http.Client{},
+		baseURL:     AnthropicBaseURL,
+		retryPolicy: RetryPolicyFromEnv(),
+	}
+}
+
+func (ac *anthropicClient) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	ac.retryPolicy = policy
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature float64              `json:"temperature"`
+	Stream      bool                 `json:"stream,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Metadata    *anthropicMetadata   `json:"metadata,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+// tokenUsage converts to the OpenAI-style usage the rest of the app reads.
+// Anthropic reports cached input separately, so it is folded back into the prompt count.
+func (u anthropicUsage) tokenUsage() models.TokenUsage {
+	var usage models.TokenUsage
+	usage.PromptTokens = u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	usage.CompletionTokens = u.OutputTokens
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.PromptTokensDetails.CachedTokens = u.CacheReadInputTokens
+	return usage
+}
+
+// anthropicContentBlock is a text, image, tool_use or tool_result block, in requests and responses.
+type anthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+// anthropicImageSource is an image given by URL, or inline as base64 when the part held a data URL.
+type anthropicImageSource struct {
+	Type      string `json:"type"` // url or base64
+	URL       string `json:"url,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+// anthropicEvent covers the fields of every SSE event type we read.
+type anthropicEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	ContentBlock anthropicContentBlock `json:"content_block"`
+	Message      anthropicResponse     `json:"message"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (ac *anthropicClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	return ac.complete(ctx, ac.buildRequest(ctx, model, temperature, maxTokens, messages, nil, false))
+}
+
+func (ac *anthropicClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	return ac.stream(ctx, ac.buildRequest(ctx, model, temperature, maxTokens, messages, nil, true))
+}
+
+func (ac *anthropicClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	return ac.complete(ctx, ac.buildRequest(ctx, model, temperature, maxTokens, messages, responseFormat, false))
+}
+
+func (ac *anthropicClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return ac.stream(ctx, ac.buildRequest(ctx, model, temperature, maxTokens, messages, responseFormat, true))
+}
+
+// structured reports whether the request forces the schema tool, in which case its input is the reply itself.
+func (r anthropicRequest) structured() bool {
+	return r.ToolChoice != nil && r.ToolChoice.Type == "tool"
+}
+
+// buildRequest moves system messages into the system field, maps tool calls and results to
+// content blocks, offers the tools in ctx, and turns a JSON schema response format into a single forced tool whose
+// input is the structured output.
+func (ac *anthropicClient) buildRequest(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, stream bool) anthropicRequest {
+	reqBody := anthropicRequest{
+		Model:       anthropicModelName(model),
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+		Stream:      stream,
+	}
+	if sessionID := SessionIDFromContext(ctx); sessionID != "" {
+		reqBody.Metadata = &anthropicMetadata{UserID: sessionID}
+	}
+
+	var system []string
+	for _, msg := range messages {
+		if msg.Role == models.MessageRoleSystem {
+			system = append(system, msg.Text())
+			continue
+		}
+
+		role, blocks := anthropicBlocks(msg)
+
+		// The Messages API expects alternating turns starting with the user
+		if len(reqBody.Messages) == 0 && role != models.MessageRoleUser.String() {
+			reqBody.Messages = append(reqBody.Messages, anthropicMessage{
+				Role:    models.MessageRoleUser.String(),
+				Content: []anthropicContentBlock{{Type: "text", Text: "(conversation start)"}},
+			})
+		}
+		if last := len(reqBody.Messages) - 1; last >= 0 && reqBody.Messages[last].Role == role {
+			reqBody.Messages[last].Content = append(reqBody.Messages[last].Content, blocks...)
+			continue
+		}
+		reqBody.Messages = append(reqBody.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	reqBody.System = strings.Join(system, "\n\n")
+
+	for _, tool := range toolsFromContext(ctx) {
+		reqBody.Tools = append(reqBody.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: tool.Function.Parameters,
+		})
+	}
+
+	if responseFormat != nil && responseFormat.JSONSchema != nil {
+		name := responseFormat.JSONSchema.Name
+		reqBody.Tools = []anthropicTool{{
+			Name:        name,
+			Description: "Respond with structured output matching this schema.",
+			InputSchema: responseFormat.JSONSchema.Schema,
+		}}
+		reqBody.ToolChoice = &anthropicToolChoice{Type: "tool", Name: name}
+	}
+
+	return reqBody
+}
+
+// anthropicBlocks converts one message; tool results travel as user turns.
+func anthropicBlocks(msg models.ChatMessage) (string, []anthropicContentBlock) {
+	if msg.Role == models.MessageRoleTool {
+		return models.MessageRoleUser.String(), []anthropicContentBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Text()}}
+	}
+
+	var blocks []anthropicContentBlock
+	if msg.Content != "" && len(msg.Parts) == 0 {
+		blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+	}
+	for _, part := range msg.Parts {
+		switch {
+		case part.Type == "text" && part.Text != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+		case part.Type == "image_url" && part.ImageURL != nil:
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: anthropicImage(part.ImageURL.URL)})
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, anthropicContentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, anthropicContentBlock{Type: "text", Text: "(empty)"})
+	}
+	return msg.Role.String(), blocks
+}
+
+func anthropicImage(url string) *anthropicImageSource {
+	// data:<media type>;base64,<data>
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &anthropicImageSource{Type: "url", URL: url}
+}
+
+// anthropicModelName strips the OpenRouter-style provider prefix so prompt YAML can keep one model id.
+func anthropicModelName(model string) string {
+	return strings.TrimPrefix(model, "anthropic/")
+}
+
+// openAIFinishReason maps Anthropic stop reasons to the OpenAI values agents check for.
+// The forced schema tool of a structured request is a normal stop, not a tool call.
+func openAIFinishReason(stopReason string, structured bool) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	case "tool_use":
+		if structured {
+			return "stop"
+		}
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+func (ac *anthropicClient) complete(ctx context.Context, reqBody anthropicRequest) (string, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := ac.send(ctx, jsonData)
+		if err != nil {
+			if delay, ok := ac.retryPolicy.retryDelay(err, attempt); ok {
+				utils.PrintInfo(fmt.Sprintf("Retrying %s in %s (attempt %d/%d): %v", reqBody.Model, delay, attempt+1, ac.retryPolicy.MaxAttempts, err))
+				if err := retryBackoff(ctx, delay); err != nil {
+					return "", err
+				}
+				continue
+			}
+			return "", err
+		}
+
+		var msgResp anthropicResponse
+		err = json.NewDecoder(resp.Body).Decode(&msgResp)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		var content strings.Builder
+		var toolCalls []models.ToolCall
+		for _, block := range msgResp.Content {
+			switch {
+			case block.Type == "text":
+				content.WriteString(block.Text)
+			case block.Type == "tool_use" && reqBody.structured():
+				content.Write(block.Input)
+			case block.Type == "tool_use":
+				toolCalls = append(toolCalls, models.ToolCall{
+					ID:       block.ID,
+					Type:     "function",
+					Function: models.ToolCallFunction{Name: block.Name, Arguments: string(block.Input)},
+				})
+			}
+		}
+
+		recordCallInfo(ctx, CallInfo{
+			RequestedModel: reqBody.Model,
+			Model:          msgResp.Model,
+			Provider:       AnthropicProvider,
+			Usage:          msgResp.Usage.tokenUsage(),
+			FinishReason:   openAIFinishReason(msgResp.StopReason, reqBody.structured()),
+			ToolCalls:      toolCalls,
+		})
+
+		if content.Len() == 0 && len(toolCalls) == 0 {
+			return "", fmt.Errorf("no response from API")
+		}
+
+		return content.String(), nil
+	}
+}
+
+// stream retries until the first chunk has been yielded, like openAICompatibleClient.stream.
+func (ac *anthropicClient) stream(ctx context.Context, reqBody anthropicRequest) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		jsonData, err := json.Marshal(reqBody)
+		if err != nil {
+			yield(models.StreamResponse{}, fmt.Errorf("failed to marshal request: %w", err))
+			return
+		}
+
+		for attempt := 1; ; attempt++ {
+			resp, err := ac.send(ctx, jsonData)
+			sent := 0
+			if err == nil {
+				info := CallInfo{RequestedModel: reqBody.Model, Provider: AnthropicProvider}
+				sent, err = readAnthropicStream(resp.Body, yield, &info, reqBody.structured())
+				resp.Body.Close()
+				recordCallInfo(ctx, info)
+				if err == nil || errors.Is(err, errStreamStopped) {
+					return
+				}
+				err = fmt.Errorf("failed to read response: %w", err)
+			}
+
+			if sent == 0 {
+				if delay, ok := ac.retryPolicy.retryDelay(err, attempt); ok {
+					utils.PrintInfo(fmt.Sprintf("Retrying %s stream in %s (attempt %d/%d): %v", reqBody.Model, delay, attempt+1, ac.retryPolicy.MaxAttempts, err))
+					if err = retryBackoff(ctx, delay); err == nil {
+						continue
+					}
+				}
+			}
+
+			yield(models.StreamResponse{}, err)
+			return
+		}
+	}
+}
+
+func (ac *anthropicClient) send(ctx context.Context, jsonData []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", ac.baseURL+"/messages", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("x-api-key", ac.apiKey)
+	req.Header.Set("anthropic-version", AnthropicVersion)
+	req.Header.Set("Content-Type", ContentTypeHeader)
+
+	resp, err := ac.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return nil, newAPIError(resp, body)
+	}
+
+	return resp, nil
+}
+
+// readAnthropicStream translates message_start, content_block_delta and message_delta
+// events into the OpenAI-style chunks agents consume, and reports how many were yielded.
+func readAnthropicStream(body io.Reader, yield func(models.StreamResponse, error) bool, info *CallInfo, structured bool) (int, error) {
+	sent := 0
+	var id string
+	var usage anthropicUsage
+	toolIndexes := make(map[int]int) // Content block index to OpenAI tool call index
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			utils.PrintError(fmt.Sprintf("Skipping unparseable stream event: %v: %s", err, truncate(data, 200)))
+			continue
+		}
+
+		chunk := models.StreamResponse{ID: id, Model: info.Model, Provider: AnthropicProvider}
+		switch event.Type {
+		case "message_start":
+			id = event.Message.ID
+			info.Model = event.Message.Model
+			usage = event.Message.Usage
+			continue
+
+		case "content_block_start":
+			if event.ContentBlock.Type != "tool_use" || structured {
+				continue
+			}
+			toolIndex := len(toolIndexes)
+			toolIndexes[event.Index] = toolIndex
+			chunk.Choices = []models.StreamChoice{{Delta: models.StreamDelta{
+				Role: models.MessageRoleAssistant.String(),
+				ToolCalls: []models.ToolCallDelta{{
+					Index:    toolIndex,
+					ID:       event.ContentBlock.ID,
+					Type:     "function",
+					Function: models.ToolCallFunction{Name: event.ContentBlock.Name},
+				}},
+			}}}
+
+		case "content_block_delta":
+			if toolIndex, ok := toolIndexes[event.Index]; ok {
+				chunk.Choices = []models.StreamChoice{{Delta: models.StreamDelta{
+					ToolCalls: []models.ToolCallDelta{{Index: toolIndex, Function: models.ToolCallFunction{Arguments: event.Delta.PartialJSON}}},
+				}}}
+				break
+			}
+
+			text := event.Delta.Text
+			if event.Delta.Type == "input_json_delta" {
+				text = event.Delta.PartialJSON
+			}
+			if text == "" {
+				continue
+			}
+			chunk.Choices = []models.StreamChoice{{Delta: models.StreamDelta{Role: models.MessageRoleAssistant.String(), Content: text}}}
+
+		case "message_delta":
+			usage.OutputTokens = event.Usage.OutputTokens
+			info.Usage = usage.tokenUsage()
+
+			finishReason := openAIFinishReason(event.Delta.StopReason, structured)
+			nativeFinishReason := event.Delta.StopReason
+			chunk.Choices = []models.StreamChoice{{FinishReason: &finishReason, NativeFinishReason: &nativeFinishReason}}
+			chunk.Usage = info.Usage
+
+		case "message_stop":
+			return sent, scanner.Err()
+
+		case "error":
+			return sent, &APIError{
+				StatusCode: anthropicErrorStatus(event.Error.Type),
+				Message:    fmt.Sprintf("stream error (%s): %s", event.Error.Type, event.Error.Message),
+			}
+
+		default:
+			// ping and content_block_stop carry nothing we forward
+			continue
+		}
+
+		if !yield(chunk, nil) {
+			return sent, errStreamStopped
+		}
+		sent++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return sent, err
+	}
+	return sent, fmt.Errorf("stream ended without message_stop: %w", io.ErrUnexpectedEOF)
+}
+
+// anthropicErrorStatus maps the error type of a mid-stream error event to the HTTP status the
+// same error has when returned up front, so retry rules treat both alike.
+func anthropicErrorStatus(errorType string) int {
+	switch errorType {
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	case "authentication_error":
+		return http.StatusUnauthorized
+	case "permission_error":
+		return http.StatusForbidden
+	case "not_found_error":
+		return http.StatusNotFound
+	case "request_too_large":
+		return http.StatusRequestEntityTooLarge
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "overloaded_error":
+		return 529 // Anthropic's own status for an overloaded API
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"ai-agent/work-flows/models"
+)
+
+func TestReadAnthropicStream(t *testing.T) {
+	const (
+		start = `data: {"type":"message_start","message":{"id":"msg_1","model":"claude"}}`
+		text  = `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`
+		stop  = `data: {"type":"message_stop"}`
+	)
+	tests := []struct {
+		name          string
+		events        []string
+		wantSent      int
+		wantErr       error // nil for a clean end
+		wantStatus    int   // Expected APIError status; 0 when the error is not an APIError
+		wantRetryable bool
+	}{
+		{name: "message_stop ends the stream", events: []string{start, text, stop}, wantSent: 1},
+		{name: "missing message_stop is a truncated stream", events: []string{start, text}, wantSent: 1, wantErr: io.ErrUnexpectedEOF},
+		{
+			name:          "overloaded error event is retryable",
+			events:        []string{start, `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`},
+			wantStatus:    529,
+			wantRetryable: true,
+		},
+		{
+			name:          "rate limit error event is retryable",
+			events:        []string{start, `data: {"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`},
+			wantStatus:    429,
+			wantRetryable: true,
+		},
+		{
+			name:       "invalid request error event is not retryable",
+			events:     []string{start, text, `data: {"type":"error","error":{"type":"invalid_request_error","message":"Bad"}}`},
+			wantSent:   1,
+			wantStatus: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.NewReader(strings.Join(tt.events, "\n\n") + "\n\n")
+			var info CallInfo
+			sent, err := readAnthropicStream(body, func(models.StreamResponse, error) bool { return true }, &info, false)
+
+			if sent != tt.wantSent {
+				t.Errorf("got %d chunks, want %d", sent, tt.wantSent)
+			}
+			if tt.wantStatus == 0 {
+				if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("got error %v, want an APIError", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || apiErr.Retryable() != tt.wantRetryable {
+				t.Errorf("got status %d retryable %v, want %d %v", apiErr.StatusCode, apiErr.Retryable(), tt.wantStatus, tt.wantRetryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	BackendOpenRouter       = "openrouter"
+	BackendOpenAICompatible = "openai_compatible"
+	BackendAnthropic        = "anthropic"
+
+	DefaultLocalBaseURL = "http://localhost:11434/v1" // Ollama's OpenAI-compatible endpoint
+)
+
+// Backend returns the configured LLM backend from LLM_BACKEND, defaulting to OpenRouter.
+func Backend() string {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_BACKEND")))
+	if backend == "" {
+		return BackendOpenRouter
+	}
+	return backend
+}
+
+// RequiresOpenRouterKey reports whether the configured backend needs OPENROUTER_API_KEY.
+// Replaying cassettes never reaches the network, so no key is needed.
+func RequiresOpenRouterKey() bool {
+	return Backend() == BackendOpenRouter && CassetteMode() != CassetteModeReplay
+}
+
+// OpenAICompatibleConfigFromEnv reads LLM_BASE_URL, LLM_API_KEY, LLM_AUTH_SCHEME,
+// LLM_AUTH_HEADER, LLM_EXTRA_HEADERS (comma-separated Key=Value) and LLM_MODEL.
+func OpenAICompatibleConfigFromEnv() OpenAICompatibleConfig {
+	config := OpenAICompatibleConfig{
+		BaseURL:       os.Getenv("LLM_BASE_URL"),
+		APIKey:        os.Getenv("LLM_API_KEY"),
+		AuthScheme:    strings.ToLower(os.Getenv("LLM_AUTH_SCHEME")),
+		AuthHeader:    os.Getenv("LLM_AUTH_HEADER"),
+		Headers:       parseKeyValues(os.Getenv("LLM_EXTRA_HEADERS")),
+		ModelOverride: os.Getenv("LLM_MODEL"),
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultLocalBaseURL
+	}
+	if config.AuthScheme == "" && config.APIKey == "" {
+		config.AuthScheme = AuthSchemeNone
+	}
+	return config
+}
+
+// parseKeyValues reads a comma-separated list of Key=Value pairs.
+func parseKeyValues(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		headers[key] = strings.TrimSpace(val)
+	}
+	return headers
+}
+
+// NewBackendClient builds a client for the configured backend that also honours a
+// per-call Routing.Backend, so an llm block can pick e.g. anthropic without agent changes.
+// LLM_CASSETTE_MODE wraps it for recording or replaying calls, and llm blocks with
+// cache: true are served from the shared response cache. Cache misses wait their turn
+// in the shared limiter.
+// apiKey is the fallback OpenRouter key for the shared key pool and is ignored by other backends.
+func NewBackendClient(apiKey string) Client {
+	router := &backendRouter{
+		apiKey:  apiKey,
+		clients: make(map[string]Client),
+	}
+
+	router.defaultBackend = Backend()
+	if _, err := router.clientFor(router.defaultBackend); err != nil {
+		utils.PrintError(fmt.Sprintf("%v, falling back to %s", err, BackendOpenRouter))
+		router.defaultBackend = BackendOpenRouter
+	}
+
+	limited := NewLimitedClient(WithCassetteFromEnv(router), SharedLimiter())
+	return NewCachingClient(limited, SharedResponseCache())
+}
+
+func newClientForBackend(backend string, apiKey string) (Client, error) {
+	switch backend {
+	case BackendOpenRouter:
+		return NewOpenRouterPoolClient(SharedKeyPool(apiKey)), nil
+	case BackendOpenAICompatible:
+		return NewOpenAICompatibleClient(OpenAICompatibleConfigFromEnv()), nil
+	case BackendAnthropic:
+		anthropicKey := os.Getenv("ANTHROPIC_API_KEY")
+		if anthropicKey == "" {
+			return nil, fmt.Errorf("backend %s requires ANTHROPIC_API_KEY", backend)
+		}
+		return NewAnthropicClient(anthropicKey), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM backend %q", backend)
+	}
+}
+
+// backendRouter dispatches each call to the backend named in its Routing, creating clients on first use.
+type backendRouter struct {
+	apiKey         string
+	defaultBackend string
+
+	mu      sync.Mutex
+	clients map[string]Client
+}
+
+func (br *backendRouter) clientFor(backend string) (Client, error) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	if c, ok := br.clients[backend]; ok {
+		return c, nil
+	}
+
+	c, err := newClientForBackend(backend, br.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	br.clients[backend] = c
+	return c, nil
+}
+
+func (br *backendRouter) route(ctx context.Context) (Client, error) {
+	backend := routingFromContext(ctx).Backend
+	if backend == "" {
+		backend = br.defaultBackend
+	}
+	return br.clientFor(backend)
+}
+
+func (br *backendRouter) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	c, err := br.route(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+}
+
+func (br *backendRouter) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	c, err := br.route(ctx)
+	if err != nil {
+		return ErrorStream(err)
+	}
+	return c.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+}
+
+func (br *backendRouter) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	c, err := br.route(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+}
+
+func (br *backendRouter) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	c, err := br.route(ctx)
+	if err != nil {
+		return ErrorStream(err)
+	}
+	return c.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+}
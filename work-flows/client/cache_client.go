@@ -0,0 +1,373 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	DefaultCacheSize = 256
+	DefaultCacheTTL  = 24 * time.Hour
+)
+
+// CachedResponse is what the cache keeps per request, in memory and on disk.
+type CachedResponse struct {
+	Content   string    `json:"content"`
+	Model     string    `json:"model,omitempty"` // Model that produced the original reply
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// ResponseCache is an LRU of replies with a TTL, optionally backed by a directory on disk.
+type ResponseCache struct {
+	mu         sync.Mutex
+	capacity   int
+	defaultTTL time.Duration
+	dir        string
+	order      *list.List // Front is most recently used
+	entries    map[string]*list.Element
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type cacheEntry struct {
+	key      string
+	response CachedResponse
+}
+
+// NewResponseCache creates a cache holding up to capacity replies; dir may be empty for memory only.
+func NewResponseCache(capacity int, defaultTTL time.Duration, dir string) *ResponseCache {
+	if capacity < 1 {
+		capacity = DefaultCacheSize
+	}
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultCacheTTL
+	}
+	return &ResponseCache{
+		capacity:   capacity,
+		defaultTTL: defaultTTL,
+		dir:        dir,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+var (
+	sharedResponseCache     *ResponseCache
+	sharedResponseCacheOnce sync.Once
+)
+
+// SharedResponseCache returns the process-wide cache configured by LLM_CACHE_SIZE, LLM_CACHE_TTL and LLM_CACHE_DIR.
+func SharedResponseCache() *ResponseCache {
+	sharedResponseCacheOnce.Do(func() {
+		capacity := DefaultCacheSize
+		if v := os.Getenv("LLM_CACHE_SIZE"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				capacity = n
+			}
+		}
+		ttl := DefaultCacheTTL
+		if v := os.Getenv("LLM_CACHE_TTL"); v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d > 0 {
+				ttl = d
+			}
+		}
+		sharedResponseCache = NewResponseCache(capacity, ttl, os.Getenv("LLM_CACHE_DIR"))
+	})
+	return sharedResponseCache
+}
+
+func (rc *ResponseCache) Stats() CacheStats {
+	rc.mu.Lock()
+	entries := rc.order.Len()
+	rc.mu.Unlock()
+
+	return CacheStats{
+		Hits:    rc.hits.Load(),
+		Misses:  rc.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// Get looks in memory first, then on disk, and counts the hit or miss.
+func (rc *ResponseCache) Get(key string) (CachedResponse, bool) {
+	response, ok := rc.lookup(key)
+	if ok {
+		rc.hits.Add(1)
+	} else {
+		rc.misses.Add(1)
+	}
+	return response, ok
+}
+
+func (rc *ResponseCache) lookup(key string) (CachedResponse, bool) {
+	now := time.Now()
+
+	rc.mu.Lock()
+	if elem, ok := rc.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if now.Before(entry.response.ExpiresAt) {
+			rc.order.MoveToFront(elem)
+			rc.mu.Unlock()
+			return entry.response, true
+		}
+		rc.order.Remove(elem)
+		delete(rc.entries, key)
+	}
+	rc.mu.Unlock()
+
+	response, ok := rc.loadFromDisk(key)
+	if !ok || !now.Before(response.ExpiresAt) {
+		return CachedResponse{}, false
+	}
+	rc.remember(key, response)
+	return response, true
+}
+
+// Put stores a reply for ttl, or the default TTL when ttl is zero.
+func (rc *ResponseCache) Put(key string, response CachedResponse, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = rc.defaultTTL
+	}
+	response.ExpiresAt = time.Now().Add(ttl)
+
+	rc.remember(key, response)
+	rc.saveToDisk(key, response)
+}
+
+func (rc *ResponseCache) remember(key string, response CachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if elem, ok := rc.entries[key]; ok {
+		elem.Value.(*cacheEntry).response = response
+		rc.order.MoveToFront(elem)
+		return
+	}
+
+	rc.entries[key] = rc.order.PushFront(&cacheEntry{key: key, response: response})
+	for rc.order.Len() > rc.capacity {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (rc *ResponseCache) loadFromDisk(key string) (CachedResponse, bool) {
+	if rc.dir == "" {
+		return CachedResponse{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(rc.dir, key+".json"))
+	if err != nil {
+		return CachedResponse{}, false
+	}
+
+	var response CachedResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return CachedResponse{}, false
+	}
+	return response, true
+}
+
+func (rc *ResponseCache) saveToDisk(key string, response CachedResponse) {
+	if rc.dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(rc.dir, 0755); err != nil {
+		utils.PrintError("Failed to create cache directory: " + err.Error())
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(rc.dir, key+".json"), data, 0644); err != nil {
+		utils.PrintError("Failed to write cache entry: " + err.Error())
+	}
+}
+
+// cachingClient serves calls whose Routing opts in to caching from a ResponseCache.
+type cachingClient struct {
+	next  Client
+	cache *ResponseCache
+}
+
+func NewCachingClient(next Client, cache *ResponseCache) Client {
+	return &cachingClient{
+		next:  next,
+		cache: cache,
+	}
+}
+
+func (cc *cachingClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	return cc.complete(ctx, model, temperature, messages, nil, func(ctx context.Context) (string, error) {
+		return cc.next.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (cc *cachingClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	return cc.stream(ctx, model, temperature, messages, nil, func(ctx context.Context) Stream {
+		return cc.next.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (cc *cachingClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	return cc.complete(ctx, model, temperature, messages, responseFormat, func(ctx context.Context) (string, error) {
+		return cc.next.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (cc *cachingClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return cc.stream(ctx, model, temperature, messages, responseFormat, func(ctx context.Context) Stream {
+		return cc.next.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (cc *cachingClient) complete(ctx context.Context, model string, temperature float64, messages []models.ChatMessage, responseFormat *models.ResponseFormat, call func(context.Context) (string, error)) (string, error) {
+	// Replies that may stop for tool calls depend on the tool results, so they are never cached
+	routing := routingFromContext(ctx)
+	if !routing.Cache || len(toolsFromContext(ctx)) > 0 {
+		return call(ctx)
+	}
+
+	key := cacheKey(model, temperature, messages, responseFormat)
+	if cached, ok := cc.cache.Get(key); ok {
+		recordCallInfo(ctx, CallInfo{RequestedModel: model, Model: cached.Model})
+		return cached.Content, nil
+	}
+
+	// Like streams, only replies the model ended on its own are cached, not ones cut off or filtered
+	ctx, info := ensureCallInfo(ctx)
+	response, err := call(ctx)
+	if err == nil && info.FinishReason == "stop" && cacheable(response, responseFormat) {
+		cc.cache.Put(key, CachedResponse{Content: response, Model: info.Model}, routing.CacheTTL)
+	}
+	return response, err
+}
+
+// stream forwards a live stream while collecting it for the cache; a hit is replayed as synthetic chunks.
+// Only streams that ran to a normal stop are stored.
+func (cc *cachingClient) stream(ctx context.Context, model string, temperature float64, messages []models.ChatMessage, responseFormat *models.ResponseFormat, call func(context.Context) Stream) Stream {
+	// Replies that may stop for tool calls depend on the tool results, so they are never cached
+	routing := routingFromContext(ctx)
+	if !routing.Cache || len(toolsFromContext(ctx)) > 0 {
+		return call(ctx)
+	}
+
+	return func(yield func(models.StreamResponse, error) bool) {
+		key := cacheKey(model, temperature, messages, responseFormat)
+		if cached, ok := cc.cache.Get(key); ok {
+			recordCallInfo(ctx, CallInfo{RequestedModel: model, Model: cached.Model})
+			replayCached(cached, yield)
+			return
+		}
+
+		ctx, info := ensureCallInfo(ctx)
+		var collector StreamCollector
+		// A stream cut off without a finish reason must not be cached, so completion is proven, not assumed
+		complete := false
+		for chunk, err := range call(ctx) {
+			if err != nil {
+				collector.Fail(err)
+				complete = false
+			} else {
+				collector.Add(chunk)
+				if len(chunk.Choices) > 0 {
+					if reason := chunk.Choices[0].FinishReason; reason != nil && *reason != "" {
+						complete = *reason == "stop"
+					}
+				}
+			}
+			if !yield(chunk, err) {
+				return
+			}
+		}
+
+		if complete && collector.Result().Status == models.StreamStatusComplete && cacheable(collector.Content(), responseFormat) {
+			cc.cache.Put(key, CachedResponse{Content: collector.Content(), Model: info.Model}, routing.CacheTTL)
+		}
+	}
+}
+
+// replayCached splits a cached reply into word-sized deltas ending with a stop chunk.
+func replayCached(cached CachedResponse, yield func(models.StreamResponse, error) bool) {
+	content := cached.Content
+	for content != "" {
+		end := strings.IndexAny(content[1:], " \n")
+		if end < 0 {
+			end = len(content)
+		} else {
+			end++
+		}
+
+		chunk := models.StreamResponse{
+			Model:   cached.Model,
+			Choices: []models.StreamChoice{{Delta: models.StreamDelta{Role: models.MessageRoleAssistant.String(), Content: content[:end]}}},
+		}
+		if !yield(chunk, nil) {
+			return
+		}
+		content = content[end:]
+	}
+
+	finishReason := "stop"
+	yield(models.StreamResponse{
+		Model:   cached.Model,
+		Choices: []models.StreamChoice{{FinishReason: &finishReason}},
+	}, nil)
+}
+
+// cacheable skips empty replies and, for structured calls, replies that are not even JSON.
+func cacheable(response string, responseFormat *models.ResponseFormat) bool {
+	if strings.TrimSpace(response) == "" {
+		return false
+	}
+	if responseFormat != nil {
+		return json.Valid([]byte(utils.StripCodeFence(response)))
+	}
+	return true
+}
+
+func cacheKey(model string, temperature float64, messages []models.ChatMessage, responseFormat *models.ResponseFormat) string {
+	payload, _ := json.Marshal(struct {
+		Model          string                 `json:"model"`
+		Temperature    float64                `json:"temperature"`
+		Messages       []keyMessage           `json:"messages"`
+		ResponseFormat *models.ResponseFormat `json:"response_format,omitempty"`
+	}{model, temperature, keyMessages(messages), responseFormat})
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// String summarizes the counters for logs and the CLI stats view.
+func (s CacheStats) String() string {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return fmt.Sprintf("0 lookups, %d entries", s.Entries)
+	}
+	return fmt.Sprintf("%d hits / %d misses (%.0f%% hit rate), %d entries", s.Hits, s.Misses, float64(s.Hits)*100/float64(total), s.Entries)
+}
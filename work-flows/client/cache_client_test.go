@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ai-agent/work-flows/models"
+)
+
+// countingClient answers every call with the same reply and finish reason, counting the calls.
+type countingClient struct {
+	reply        string
+	finishReason string // Empty to end the stream without one
+	calls        int
+}
+
+func (cc *countingClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	cc.calls++
+	recordCallInfo(ctx, CallInfo{RequestedModel: model, Model: model, FinishReason: cc.finishReason})
+	return cc.reply, nil
+}
+
+func (cc *countingClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	return cc.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+}
+
+func (cc *countingClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	cc.calls++
+	return func(yield func(models.StreamResponse, error) bool) {
+		if !yield(models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{Content: cc.reply}}}}, nil) {
+			return
+		}
+		if cc.finishReason != "" {
+			reason := cc.finishReason
+			yield(models.StreamResponse{Choices: []models.StreamChoice{{FinishReason: &reason}}}, nil)
+		}
+	}
+}
+
+func (cc *countingClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return cc.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+}
+
+func TestCachingClientStoresOnlyFinishedReplies(t *testing.T) {
+	tests := []struct {
+		name         string
+		stream       bool
+		finishReason string
+		wantCached   bool
+	}{
+		{"complete stop", false, "stop", true},
+		{"complete length", false, "length", false},
+		{"complete content filter", false, "content_filter", false},
+		{"complete no finish reason", false, "", false},
+		{"stream stop", true, "stop", true},
+		{"stream length", true, "length", false},
+		{"stream cut off", true, "", false},
+	}
+
+	messages := []models.ChatMessage{{Role: models.MessageRoleUser, Content: "hi"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &countingClient{reply: "Hello", finishReason: tt.finishReason}
+			cached := NewCachingClient(next, NewResponseCache(10, time.Hour, ""))
+			ctx := WithRouting(context.Background(), Routing{Cache: true})
+
+			for range 2 {
+				if tt.stream {
+					for _, err := range cached.ChatCompletionStream(ctx, "model", 0, 0, messages) {
+						if err != nil {
+							t.Fatal(err)
+						}
+					}
+				} else if _, err := cached.ChatCompletion(ctx, "model", 0, 0, messages); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			wantCalls := 2
+			if tt.wantCached {
+				wantCalls = 1
+			}
+			if next.calls != wantCalls {
+				t.Errorf("backend called %d times, want %d", next.calls, wantCalls)
+			}
+		})
+	}
+}
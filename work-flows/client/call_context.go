@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+type routingKey struct{}
+type callInfoKey struct{}
+type agentNameKey struct{}
+type toolsKey struct{}
+type sessionIDKey struct{}
+
+// Routing carries the backend, fallback chain, provider preference and cache opt-in from a prompt's llm block.
+type Routing struct {
+	Backend        string // Empty means the configured default backend
+	FallbackModels []string
+	ProviderSort   string
+	Cache          bool          // Opt-in to the response cache
+	CacheTTL       time.Duration // Zero uses the cache default
+}
+
+func RoutingFromSettings(settings utils.LLMSettings) Routing {
+	settings = settings.Normalize()
+	cacheTTL, _ := time.ParseDuration(settings.CacheTTL)
+	return Routing{
+		Backend:        strings.ToLower(strings.TrimSpace(settings.Backend)),
+		FallbackModels: settings.FallbackModels,
+		ProviderSort:   settings.ProviderSort,
+		Cache:          settings.Cache,
+		CacheTTL:       cacheTTL,
+	}
+}
+
+// WithRouting attaches routing preferences to every call made with the returned context.
+func WithRouting(ctx context.Context, routing Routing) context.Context {
+	return context.WithValue(ctx, routingKey{}, routing)
+}
+
+func routingFromContext(ctx context.Context) Routing {
+	routing, _ := ctx.Value(routingKey{}).(Routing)
+	return routing
+}
+
+// apply fills in the OpenRouter models list and provider preferences for a request.
+func (r Routing) apply(reqBody *models.ChatRequest) {
+	if len(r.FallbackModels) > 0 {
+		reqBody.Models = append([]string{reqBody.Model}, r.FallbackModels...)
+	}
+	if r.ProviderSort != "" {
+		reqBody.Providers = &models.ProviderPreferences{Sort: r.ProviderSort}
+	}
+}
+
+// CallInfo is filled in by the client with details of the call once it completes.
+type CallInfo struct {
+	RequestedModel string
+	Model          string // Model that actually answered; differs from RequestedModel after a fallback
+	Provider       string
+	Usage          models.TokenUsage
+	FinishReason   string            // For streams, the last finish reason reported in a chunk
+	ToolCalls      []models.ToolCall // Set for non-streamed calls that ended asking for tools
+	Duration       time.Duration     // Set by the timing middleware
+}
+
+func (ci *CallInfo) UsedFallback() bool {
+	return ci.Model != "" && ci.Model != ci.RequestedModel
+}
+
+// WithCallInfo asks the client to record call details into info.
+func WithCallInfo(ctx context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+func callInfoFromContext(ctx context.Context) *CallInfo {
+	info, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info
+}
+
+// WithAgentName tags calls with the agent making them, for usage attribution.
+func WithAgentName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, agentNameKey{}, name)
+}
+
+func AgentNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(agentNameKey{}).(string)
+	return name
+}
+
+// WithTools offers tools to the model for every call made with the returned context.
+func WithTools(ctx context.Context, tools []models.Tool) context.Context {
+	return context.WithValue(ctx, toolsKey{}, tools)
+}
+
+func toolsFromContext(ctx context.Context) []models.Tool {
+	tools, _ := ctx.Value(toolsKey{}).([]models.Tool)
+	return tools
+}
+
+// WithSessionID attributes every call made with the returned context to a conversation session.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey{}).(string)
+	return sessionID
+}
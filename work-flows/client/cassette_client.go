@@ -0,0 +1,339 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	CassetteModeOff    = ""
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+
+	DefaultCassetteDir = "cassettes"
+)
+
+// CassetteMode reads LLM_CASSETTE_MODE: record, replay or empty for live calls.
+func CassetteMode() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("LLM_CASSETTE_MODE")))
+}
+
+// CassetteDir reads LLM_CASSETTE_DIR, defaulting to DefaultCassetteDir.
+func CassetteDir() string {
+	if dir := os.Getenv("LLM_CASSETTE_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultCassetteDir
+}
+
+// Cassette is one recorded call. Streamed calls keep every chunk with the delay before it.
+type Cassette struct {
+	Key            string                 `json:"key"`
+	Model          string                 `json:"model"`
+	Messages       []keyMessage           `json:"messages"`
+	ResponseFormat *models.ResponseFormat `json:"response_format,omitempty"`
+	Tools          []models.Tool          `json:"tools,omitempty"`
+	Temperature    float64                `json:"temperature"`
+	MaxTokens      int                    `json:"max_tokens,omitempty"`
+	Stream         bool                   `json:"stream"`
+	Response       string                 `json:"response,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	Chunks         []CassetteChunk        `json:"chunks,omitempty"`
+	AnsweredBy     string                 `json:"answered_by,omitempty"`
+	Provider       string                 `json:"provider,omitempty"`
+	Usage          models.TokenUsage      `json:"usage,omitzero"`
+	FinishReason   string                 `json:"finish_reason,omitempty"`
+	ToolCalls      []models.ToolCall      `json:"tool_calls,omitempty"` // Non-streamed calls that ended asking for tools
+	RecordedAt     string                 `json:"recorded_at"`
+}
+
+type CassetteChunk struct {
+	DelayMs int64                 `json:"delay_ms"` // Time since the previous chunk, or since the request for the first
+	Chunk   models.StreamResponse `json:"chunk"`
+}
+
+// keyMessage is a wire message as it is keyed and recorded, with multi-part content in its own field.
+type keyMessage struct {
+	Role       models.MessageRole   `json:"role"`
+	Content    string               `json:"content"`
+	Parts      []models.ContentPart `json:"parts,omitempty"`
+	ToolCalls  []models.ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string               `json:"tool_call_id,omitempty"`
+}
+
+func keyMessages(messages []models.ChatMessage) []keyMessage {
+	result := make([]keyMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = keyMessage{Role: msg.Role, Content: msg.Content, Parts: msg.Parts, ToolCalls: msg.ToolCalls, ToolCallID: msg.ToolCallID}
+	}
+	return result
+}
+
+// content rebuilds the full reply, joining the chunks of a streamed recording.
+func (c *Cassette) content() string {
+	if !c.Stream {
+		return c.Response
+	}
+	var content strings.Builder
+	for _, chunk := range c.Chunks {
+		if len(chunk.Chunk.Choices) > 0 {
+			content.WriteString(chunk.Chunk.Choices[0].Delta.Content)
+		}
+	}
+	return content.String()
+}
+
+// cassetteClient records calls to next into cassette files, or replays them without calling next.
+type cassetteClient struct {
+	next Client
+	dir  string
+	mode string
+	mu   sync.Mutex
+}
+
+// NewCassetteClient wraps next for record or replay mode; next may be nil when replaying.
+func NewCassetteClient(next Client, dir string, mode string) Client {
+	return &cassetteClient{
+		next: next,
+		dir:  dir,
+		mode: mode,
+	}
+}
+
+// WithCassetteFromEnv wraps c according to LLM_CASSETTE_MODE and LLM_CASSETTE_DIR.
+func WithCassetteFromEnv(c Client) Client {
+	switch mode := CassetteMode(); mode {
+	case CassetteModeOff:
+		return c
+	case CassetteModeRecord, CassetteModeReplay:
+		utils.PrintInfo(fmt.Sprintf("LLM cassettes: %s mode, directory %s", mode, CassetteDir()))
+		return NewCassetteClient(c, CassetteDir(), mode)
+	default:
+		utils.PrintError(fmt.Sprintf("Ignoring unknown LLM_CASSETTE_MODE %q (expected record or replay)", mode))
+		return c
+	}
+}
+
+func (cc *cassetteClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	return cc.complete(ctx, model, temperature, maxTokens, messages, nil, func(ctx context.Context) (string, error) {
+		return cc.next.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (cc *cassetteClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	return cc.stream(ctx, model, temperature, maxTokens, messages, nil, func(ctx context.Context) Stream {
+		return cc.next.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (cc *cassetteClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	return cc.complete(ctx, model, temperature, maxTokens, messages, responseFormat, func(ctx context.Context) (string, error) {
+		return cc.next.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (cc *cassetteClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return cc.stream(ctx, model, temperature, maxTokens, messages, responseFormat, func(ctx context.Context) Stream {
+		return cc.next.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (cc *cassetteClient) complete(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, call func(context.Context) (string, error)) (string, error) {
+	cassette := newCassette(ctx, model, temperature, maxTokens, messages, responseFormat, false)
+
+	if cc.mode == CassetteModeReplay {
+		recorded, err := cc.load(cassette.Key, model)
+		if err != nil {
+			return "", err
+		}
+		recordCallInfo(ctx, recorded.callInfo(model))
+		if recorded.Error != "" {
+			return "", errors.New(recorded.Error)
+		}
+		return recorded.content(), nil
+	}
+
+	ctx, info := ensureCallInfo(ctx)
+	response, err := call(ctx)
+
+	cassette.Response = response
+	if err != nil {
+		cassette.Error = err.Error()
+	}
+	cassette.setCallInfo(info)
+	cc.save(cassette)
+
+	return response, err
+}
+
+// stream records the chunks and the terminal error of a live stream. A stream the consumer
+// stopped early is not saved, since replaying it would cut the reply short.
+func (cc *cassetteClient) stream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, call func(context.Context) Stream) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		cassette := newCassette(ctx, model, temperature, maxTokens, messages, responseFormat, true)
+
+		if cc.mode == CassetteModeReplay {
+			cc.replayStream(ctx, cassette.Key, model, yield)
+			return
+		}
+
+		ctx, info := ensureCallInfo(ctx)
+		last := time.Now()
+		for chunk, err := range call(ctx) {
+			if err != nil {
+				cassette.Error = err.Error()
+			} else {
+				now := time.Now()
+				cassette.Chunks = append(cassette.Chunks, CassetteChunk{DelayMs: now.Sub(last).Milliseconds(), Chunk: chunk})
+				last = now
+			}
+			if !yield(chunk, err) {
+				return
+			}
+		}
+
+		cassette.setCallInfo(info)
+		cc.save(cassette)
+	}
+}
+
+// replayStream yields the recorded chunks with their original spacing, then the recorded
+// error if the stream failed; a non-streamed recording of the same request is replayed as a single chunk.
+func (cc *cassetteClient) replayStream(ctx context.Context, key string, model string, yield func(models.StreamResponse, error) bool) {
+	recorded, err := cc.load(key, model)
+	if err != nil {
+		yield(models.StreamResponse{}, err)
+		return
+	}
+	recordCallInfo(ctx, recorded.callInfo(model))
+
+	if !recorded.Stream {
+		if recorded.Error != "" {
+			yield(models.StreamResponse{}, errors.New(recorded.Error))
+			return
+		}
+		finishReason := recorded.FinishReason
+		if finishReason == "" {
+			finishReason = "stop"
+		}
+		delta := models.StreamDelta{Role: models.MessageRoleAssistant.String(), Content: recorded.Response}
+		for i, call := range recorded.ToolCalls {
+			delta.ToolCalls = append(delta.ToolCalls, models.ToolCallDelta{Index: i, ID: call.ID, Type: call.Type, Function: call.Function})
+		}
+		yield(models.StreamResponse{
+			Model:    recorded.AnsweredBy,
+			Provider: recorded.Provider,
+			Choices:  []models.StreamChoice{{Delta: delta, FinishReason: &finishReason}},
+		}, nil)
+		return
+	}
+
+	for _, chunk := range recorded.Chunks {
+		if err := sleepContext(ctx, time.Duration(chunk.DelayMs)*time.Millisecond); err != nil {
+			yield(models.StreamResponse{}, err)
+			return
+		}
+		if !yield(chunk.Chunk, nil) {
+			return
+		}
+	}
+	if recorded.Error != "" {
+		yield(models.StreamResponse{}, errors.New(recorded.Error))
+	}
+}
+
+func newCassette(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat, stream bool) *Cassette {
+	cassette := &Cassette{
+		Model:          model,
+		ResponseFormat: responseFormat,
+		Tools:          toolsFromContext(ctx),
+		Temperature:    temperature,
+		MaxTokens:      maxTokens,
+		Stream:         stream,
+		RecordedAt:     time.Now().Format(time.RFC3339),
+	}
+	cassette.Messages = keyMessages(messages)
+	cassette.Key = cassetteKey(cassette)
+	return cassette
+}
+
+// cassetteKey hashes everything that shapes the reply: model, messages, response format, tool
+// definitions, temperature and token limit. Streaming is left out, so streamed and plain calls share a key.
+func cassetteKey(cassette *Cassette) string {
+	payload, _ := json.Marshal(struct {
+		Model          string                 `json:"model"`
+		Messages       []keyMessage           `json:"messages"`
+		ResponseFormat *models.ResponseFormat `json:"response_format,omitempty"`
+		Tools          []models.Tool          `json:"tools,omitempty"`
+		Temperature    float64                `json:"temperature"`
+		MaxTokens      int                    `json:"max_tokens,omitempty"`
+	}{cassette.Model, cassette.Messages, cassette.ResponseFormat, cassette.Tools, cassette.Temperature, cassette.MaxTokens})
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cassette) setCallInfo(info *CallInfo) {
+	c.AnsweredBy = info.Model
+	c.Provider = info.Provider
+	c.Usage = info.Usage
+	c.FinishReason = info.FinishReason
+	c.ToolCalls = info.ToolCalls
+}
+
+func (c *Cassette) callInfo(requestedModel string) CallInfo {
+	return CallInfo{RequestedModel: requestedModel, Model: c.AnsweredBy, Provider: c.Provider, Usage: c.Usage, FinishReason: c.FinishReason, ToolCalls: c.ToolCalls}
+}
+
+func (cc *cassetteClient) path(key string) string {
+	return filepath.Join(cc.dir, key+".json")
+}
+
+func (cc *cassetteClient) load(key string, model string) (*Cassette, error) {
+	data, err := os.ReadFile(cc.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no cassette recorded for this %s request (key %s)", model, key)
+		}
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", key, err)
+	}
+	return &cassette, nil
+}
+
+// save overwrites any earlier recording of the same request, so the newest run wins.
+func (cc *cassetteClient) save(cassette *Cassette) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if err := os.MkdirAll(cc.dir, 0755); err != nil {
+		utils.PrintError("Failed to create cassette directory: " + err.Error())
+		return
+	}
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		utils.PrintError("Failed to marshal cassette: " + err.Error())
+		return
+	}
+
+	if err := os.WriteFile(cc.path(cassette.Key), data, 0644); err != nil {
+		utils.PrintError("Failed to write cassette: " + err.Error())
+	}
+}
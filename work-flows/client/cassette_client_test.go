@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"ai-agent/work-flows/models"
+)
+
+func TestCassetteKey(t *testing.T) {
+	messages := []models.ChatMessage{
+		{Role: models.MessageRoleSystem, Content: "You are a tutor."},
+		{Role: models.MessageRoleUser, Content: "Hi"},
+	}
+	tools := []models.Tool{{Type: "function", Function: models.ToolFunction{Name: "lookup_word"}}}
+	base := newCassette(context.Background(), "model", 0.7, 100, messages, nil, false)
+
+	tests := []struct {
+		name     string
+		cassette *Cassette
+		same     bool
+	}{
+		{name: "identical call", cassette: newCassette(context.Background(), "model", 0.7, 100, messages, nil, false), same: true},
+		{name: "streamed call shares the key", cassette: newCassette(context.Background(), "model", 0.7, 100, messages, nil, true), same: true},
+		{name: "other model", cassette: newCassette(context.Background(), "other", 0.7, 100, messages, nil, false)},
+		{name: "other message", cassette: newCassette(context.Background(), "model", 0.7, 100, messages[:1], nil, false)},
+		{
+			name: "other role",
+			cassette: newCassette(context.Background(), "model", 0.7, 100, []models.ChatMessage{
+				messages[0], {Role: models.MessageRoleAssistant, Content: "Hi"},
+			}, nil, false),
+		},
+		{name: "response format", cassette: newCassette(context.Background(), "model", 0.7, 100, messages, &models.ResponseFormat{Type: "json_object"}, false)},
+		{name: "tools offered", cassette: newCassette(WithTools(context.Background(), tools), "model", 0.7, 100, messages, nil, false)},
+		{name: "other temperature", cassette: newCassette(context.Background(), "model", 0.2, 100, messages, nil, false)},
+		{name: "other max tokens", cassette: newCassette(context.Background(), "model", 0.7, 200, messages, nil, false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.cassette.Key == base.Key; same != tt.same {
+				t.Errorf("got same key %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
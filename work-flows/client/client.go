@@ -1,10 +1,30 @@
 package client
 
-import "ai-agent/work-flows/models"
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"ai-agent/work-flows/models"
+)
+
+// Stream yields the chunks of a streamed reply in order, the usage chunk included. A non-nil
+// error is always the last value yielded. Breaking out of the range ends the request.
+type Stream = iter.Seq2[models.StreamResponse, error]
 
 type Client interface {
-	ChatCompletion(model string, temperature float64, maxTokens int, messages []models.Message) (string, error)
-	ChatCompletionStream(model string, temperature float64, maxTokens int, messages []models.Message, streamResponse chan<- models.StreamResponse, done chan<- bool)
-	ChatCompletionWithFormat(model string, temperature float64, maxTokens int, messages []models.Message, responseFormat *models.ResponseFormat) (string, error)
-	ChatCompletionWithFormatStream(model string, temperature float64, maxTokens int, messages []models.Message, responseFormat *models.ResponseFormat, streamResponse chan<- models.StreamResponse, done chan<- bool)
+	ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error)
+	ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream
+	ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error)
+	ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream
+}
+
+// errStreamStopped tells a stream reader that the consumer stopped ranging, so it must not yield again.
+var errStreamStopped = errors.New("stream consumer stopped")
+
+// ErrorStream fails with err without yielding any chunk.
+func ErrorStream(err error) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		yield(models.StreamResponse{}, err)
+	}
 }
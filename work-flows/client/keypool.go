@@ -0,0 +1,268 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	KeyRotationRoundRobin = "round_robin"
+	KeyRotationLeastUsed  = "least_used"
+
+	DefaultKeyBench     = time.Minute // After a 429 without Retry-After
+	DefaultKeyAuthBench = time.Hour   // After a 401 or 402; the key needs fixing or topping up
+)
+
+// ErrNoAPIKey is returned when every key in the pool is benched.
+var ErrNoAPIKey = errors.New("no API key available")
+
+// KeyStats is one key's share of the traffic. Key is masked to its last four characters.
+type KeyStats struct {
+	Key          string    `json:"key"`
+	Calls        int       `json:"calls"`
+	Failures     int       `json:"failures"`
+	Tokens       int       `json:"tokens"`
+	Spend        float64   `json:"spend"`
+	BenchedUntil time.Time `json:"benched_until,omitzero"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+type poolKey struct {
+	key   string
+	stats KeyStats
+}
+
+// KeyPool hands out API keys in rotation, benches keys the provider rejected and tracks spend per key.
+type KeyPool struct {
+	rotation  string
+	bench     time.Duration
+	authBench time.Duration
+
+	mu   sync.Mutex
+	keys []*poolKey
+	next int
+}
+
+func NewKeyPool(keys []string, rotation string) *KeyPool {
+	if rotation != KeyRotationLeastUsed {
+		rotation = KeyRotationRoundRobin
+	}
+
+	pool := &KeyPool{
+		rotation:  rotation,
+		bench:     DefaultKeyBench,
+		authBench: DefaultKeyAuthBench,
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		pool.keys = append(pool.keys, &poolKey{key: key, stats: KeyStats{Key: maskKey(key)}})
+	}
+	return pool
+}
+
+// KeyPoolFromEnv collects keys from OPENROUTER_API_KEYS (comma-separated), the file named by
+// OPENROUTER_API_KEYS_FILE (one key per line, # comments) and fallbackKey, usually OPENROUTER_API_KEY.
+// LLM_KEY_ROTATION picks round_robin (default) or least_used, and LLM_KEY_BENCH overrides
+// how long a rate-limited key sits out.
+func KeyPoolFromEnv(fallbackKey string) *KeyPool {
+	var keys []string
+	keys = append(keys, strings.Split(os.Getenv("OPENROUTER_API_KEYS"), ",")...)
+
+	if path := os.Getenv("OPENROUTER_API_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			utils.PrintError(fmt.Sprintf("Failed to read API key file: %v", err))
+		}
+		for line := range strings.SplitSeq(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				keys = append(keys, line)
+			}
+		}
+	}
+	keys = append(keys, fallbackKey)
+
+	pool := NewKeyPool(keys, strings.ToLower(strings.TrimSpace(os.Getenv("LLM_KEY_ROTATION"))))
+	if v := os.Getenv("LLM_KEY_BENCH"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			pool.bench = d
+		}
+	}
+	if pool.Len() > 1 {
+		utils.PrintInfo(fmt.Sprintf("Using %d OpenRouter API keys (%s)", pool.Len(), pool.rotation))
+	}
+	return pool
+}
+
+var (
+	sharedKeyPool     *KeyPool
+	sharedKeyPoolOnce sync.Once
+)
+
+// SharedKeyPool returns the process-wide pool, so every session rotates over the same keys
+// and a benched key stays benched for all of them. fallbackKey is only read on first use.
+func SharedKeyPool(fallbackKey string) *KeyPool {
+	sharedKeyPoolOnce.Do(func() {
+		sharedKeyPool = KeyPoolFromEnv(fallbackKey)
+	})
+	return sharedKeyPool
+}
+
+func (kp *KeyPool) Len() int {
+	return len(kp.keys)
+}
+
+// Pick returns the next key that is not benched.
+func (kp *KeyPool) Pick() (string, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if len(kp.keys) == 0 {
+		return "", ErrNoAPIKey
+	}
+
+	now := time.Now()
+	var picked *poolKey
+	for i := range kp.keys {
+		candidate := kp.keys[(kp.next+i)%len(kp.keys)]
+		if candidate.stats.BenchedUntil.After(now) {
+			continue
+		}
+		if kp.rotation == KeyRotationRoundRobin {
+			picked = candidate
+			kp.next = (kp.next + i + 1) % len(kp.keys)
+			break
+		}
+		if picked == nil || candidate.stats.Calls < picked.stats.Calls {
+			picked = candidate
+		}
+	}
+
+	if picked == nil {
+		return "", fmt.Errorf("%w: all %d keys are benched until %s", ErrNoAPIKey, len(kp.keys), kp.earliestReturn().Format(time.Kitchen))
+	}
+	picked.stats.Calls++
+	return picked.key, nil
+}
+
+// earliestReturn is when the first benched key becomes usable again. Callers hold kp.mu.
+func (kp *KeyPool) earliestReturn() time.Time {
+	var earliest time.Time
+	for _, k := range kp.keys {
+		if earliest.IsZero() || k.stats.BenchedUntil.Before(earliest) {
+			earliest = k.stats.BenchedUntil
+		}
+	}
+	return earliest
+}
+
+// Report records how a call made with key ended. Rejected keys (401, 402, 429) are benched:
+// rate limits for their Retry-After or the pool's bench time, auth and credit failures for longer.
+// A rate-limited key is only benched while another key can take over; on its own it is left
+// to the retry policy.
+func (kp *KeyPool) Report(key string, err error) {
+	var apiErr *APIError
+	if err == nil || !errors.As(err, &apiErr) {
+		return
+	}
+
+	var bench time.Duration
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests:
+		bench = max(apiErr.RetryAfter, kp.bench)
+	case http.StatusUnauthorized, http.StatusPaymentRequired:
+		bench = kp.authBench
+	default:
+		return
+	}
+
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	k := kp.find(key)
+	if k == nil {
+		return
+	}
+	k.stats.Failures++
+	k.stats.LastError = RedactSecrets(apiErr.Error())
+	if apiErr.StatusCode == http.StatusTooManyRequests && !kp.othersAvailable(k) {
+		return
+	}
+	k.stats.BenchedUntil = time.Now().Add(bench)
+	utils.PrintError(fmt.Sprintf("Benching API key %s for %s: %s", k.stats.Key, bench, k.stats.LastError))
+}
+
+// RecordUsage adds a finished call's tokens and cost to key's spend.
+func (kp *KeyPool) RecordUsage(key string, usage models.TokenUsage) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	if k := kp.find(key); k != nil {
+		k.stats.Tokens += usage.TotalTokens
+		k.stats.Spend += usage.Cost
+	}
+}
+
+// Benches reports whether err makes the pool bench a key, in which case another key may succeed.
+func (kp *KeyPool) Benches(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusPaymentRequired:
+		return true
+	}
+	return false
+}
+
+func (kp *KeyPool) Stats() []KeyStats {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	stats := make([]KeyStats, len(kp.keys))
+	for i, k := range kp.keys {
+		stats[i] = k.stats
+	}
+	return stats
+}
+
+// othersAvailable reports whether any key besides k is not benched. Callers hold kp.mu.
+func (kp *KeyPool) othersAvailable(k *poolKey) bool {
+	now := time.Now()
+	for _, other := range kp.keys {
+		if other != k && !other.stats.BenchedUntil.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// find looks a key up by value. Callers hold kp.mu.
+func (kp *KeyPool) find(key string) *poolKey {
+	for _, k := range kp.keys {
+		if k.key == key {
+			return k
+		}
+	}
+	return nil
+}
+
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "…" + key[len(key)-4:]
+}
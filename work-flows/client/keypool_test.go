@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestKeyPool(t *testing.T) {
+	rateLimited := &APIError{StatusCode: http.StatusTooManyRequests}
+
+	// A step either reports err for key, or picks a key and expects want (or wantErr)
+	type step struct {
+		report  string
+		err     error
+		want    string
+		wantErr error
+	}
+	pick := func(want string) step { return step{want: want} }
+
+	tests := []struct {
+		name     string
+		keys     []string
+		rotation string
+		steps    []step
+	}{
+		{
+			name:  "round robin cycles through the keys",
+			keys:  []string{"a", "b", "c"},
+			steps: []step{pick("a"), pick("b"), pick("c"), pick("a")},
+		},
+		{
+			name:  "blank and duplicate keys are dropped",
+			keys:  []string{" a ", "a", "", "b"},
+			steps: []step{pick("a"), pick("b"), pick("a")},
+		},
+		{
+			name:     "least used picks the key with fewest calls",
+			keys:     []string{"a", "b"},
+			rotation: KeyRotationLeastUsed,
+			steps:    []step{pick("a"), pick("b"), pick("a"), {report: "a", err: rateLimited}, pick("b"), pick("b")},
+		},
+		{
+			name:  "rate limited key is skipped while benched",
+			keys:  []string{"a", "b", "c"},
+			steps: []step{pick("a"), {report: "b", err: rateLimited}, pick("c"), pick("a"), pick("c")},
+		},
+		{
+			name:  "rate limited key is kept when it is the only one left",
+			keys:  []string{"a"},
+			steps: []step{{report: "a", err: rateLimited}, pick("a")},
+		},
+		{
+			name:  "rejected key is benched even when it is the only one",
+			keys:  []string{"a"},
+			steps: []step{{report: "a", err: &APIError{StatusCode: http.StatusUnauthorized}}, {wantErr: ErrNoAPIKey}},
+		},
+		{
+			name:  "server errors do not bench",
+			keys:  []string{"a", "b"},
+			steps: []step{{report: "a", err: &APIError{StatusCode: http.StatusInternalServerError}}, pick("a"), pick("b")},
+		},
+		{
+			name:  "empty pool",
+			steps: []step{{wantErr: ErrNoAPIKey}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := NewKeyPool(tt.keys, tt.rotation)
+			for i, s := range tt.steps {
+				if s.report != "" {
+					pool.Report(s.report, s.err)
+					continue
+				}
+				got, err := pool.Pick()
+				if got != s.want || !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d: got %q, %v; want %q, %v", i, got, err, s.want, s.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPoolBenches(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&APIError{StatusCode: http.StatusUnauthorized}, true},
+		{&APIError{StatusCode: http.StatusPaymentRequired}, true},
+		{&APIError{StatusCode: http.StatusServiceUnavailable}, false},
+		{errors.New("connection reset"), false},
+	}
+
+	pool := NewKeyPool([]string{"a", "b"}, "")
+	for _, tt := range tests {
+		if got := pool.Benches(tt.err); got != tt.want {
+			t.Errorf("Benches(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
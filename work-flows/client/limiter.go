@@ -0,0 +1,404 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+// Priority orders queued calls; lower values are served first.
+type Priority int
+
+const (
+	PriorityHigh   Priority = iota // Conversation replies the learner is waiting on
+	PriorityNormal                 // Evaluations shown next to the reply
+	PriorityLow                    // Suggestions, assessments and lessons
+)
+
+const (
+	DefaultMaxInFlight  = 8
+	DefaultQueueTimeout = 30 * time.Second
+)
+
+// ErrQueueTimeout is returned when a call waited longer than the limiter's queue timeout.
+var ErrQueueTimeout = errors.New("timed out waiting for an LLM request slot")
+
+// agentPriorities gives each agent its lane when the caller did not set one explicitly.
+var agentPriorities = map[string]Priority{
+	"ConversationAgent":      PriorityHigh,
+	"EvaluateAgent":          PriorityNormal,
+	"SuggestionAgent":        PriorityLow,
+	"AssessmentAgent":        PriorityLow,
+	"PersonalizeLessonAgent": PriorityLow,
+}
+
+type priorityKey struct{}
+
+// WithPriority overrides the lane a call is queued in.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	if priority, ok := agentPriorities[AgentNameFromContext(ctx)]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+type LimiterConfig struct {
+	MaxInFlight  int            // Upstream requests allowed at once
+	DefaultRPM   int            // Requests per minute per model; 0 means unlimited
+	ModelRPM     map[string]int // Per-model overrides of DefaultRPM
+	QueueTimeout time.Duration  // Longest a call may wait for a slot and a rate token
+}
+
+// LimiterConfigFromEnv reads LLM_MAX_IN_FLIGHT, LLM_RPM, LLM_MODEL_RPM (comma-separated
+// model=rpm) and LLM_QUEUE_TIMEOUT.
+func LimiterConfigFromEnv() LimiterConfig {
+	config := LimiterConfig{
+		MaxInFlight:  DefaultMaxInFlight,
+		ModelRPM:     make(map[string]int),
+		QueueTimeout: DefaultQueueTimeout,
+	}
+
+	if v := os.Getenv("LLM_MAX_IN_FLIGHT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			config.MaxInFlight = n
+		}
+	}
+	if v := os.Getenv("LLM_RPM"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			config.DefaultRPM = n
+		}
+	}
+	for model, value := range parseKeyValues(os.Getenv("LLM_MODEL_RPM")) {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			config.ModelRPM[model] = n
+		}
+	}
+	if v := os.Getenv("LLM_QUEUE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.QueueTimeout = d
+		}
+	}
+
+	return config
+}
+
+// Limiter caps in-flight upstream calls, hands free slots out by priority and
+// paces each model with a token bucket.
+type Limiter struct {
+	config LimiterConfig
+
+	mu       sync.Mutex
+	inFlight int
+	lanes    [PriorityLow + 1]*list.List // Waiting *limiterWaiter per priority
+	buckets  map[string]*tokenBucket
+}
+
+type limiterWaiter struct {
+	ready chan struct{}
+}
+
+func NewLimiter(config LimiterConfig) *Limiter {
+	if config.MaxInFlight < 1 {
+		config.MaxInFlight = DefaultMaxInFlight
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = DefaultQueueTimeout
+	}
+
+	limiter := &Limiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+	}
+	for i := range limiter.lanes {
+		limiter.lanes[i] = list.New()
+	}
+	return limiter
+}
+
+var (
+	sharedLimiter     *Limiter
+	sharedLimiterOnce sync.Once
+)
+
+// SharedLimiter returns the process-wide limiter, so every session shares the same upstream budget.
+func SharedLimiter() *Limiter {
+	sharedLimiterOnce.Do(func() {
+		sharedLimiter = NewLimiter(LimiterConfigFromEnv())
+	})
+	return sharedLimiter
+}
+
+// Acquire waits for a slot and a rate token for model. The returned release must be called once the call ends.
+func (l *Limiter) Acquire(ctx context.Context, model string, priority Priority) (func(), error) {
+	priority = min(max(priority, PriorityHigh), PriorityLow)
+
+	ctx, cancel := context.WithTimeoutCause(ctx, l.config.QueueTimeout, ErrQueueTimeout)
+	defer cancel()
+
+	if err := l.acquireSlot(ctx, priority); err != nil {
+		return nil, err
+	}
+
+	if err := l.waitForToken(ctx, model); err != nil {
+		l.release()
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() { once.Do(l.release) }, nil
+}
+
+func (l *Limiter) acquireSlot(ctx context.Context, priority Priority) error {
+	l.mu.Lock()
+	if l.inFlight < l.config.MaxInFlight && !l.hasWaitersAhead(priority) {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+
+	waiter := &limiterWaiter{ready: make(chan struct{})}
+	elem := l.lanes[priority].PushBack(waiter)
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		select {
+		case <-waiter.ready:
+			// The slot was granted while we were giving up; pass it on
+			l.inFlight--
+			l.grantNext()
+		default:
+			l.lanes[priority].Remove(elem)
+		}
+		return context.Cause(ctx)
+	}
+}
+
+func (l *Limiter) hasWaitersAhead(priority Priority) bool {
+	for p := PriorityHigh; p <= priority; p++ {
+		if l.lanes[p].Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.grantNext()
+}
+
+// grantNext hands free slots to the oldest waiter of the highest priority lane. Callers hold l.mu.
+func (l *Limiter) grantNext() {
+	for _, lane := range l.lanes {
+		for l.inFlight < l.config.MaxInFlight && lane.Len() > 0 {
+			waiter := lane.Remove(lane.Front()).(*limiterWaiter)
+			l.inFlight++
+			close(waiter.ready)
+		}
+	}
+}
+
+func (l *Limiter) waitForToken(ctx context.Context, model string) error {
+	rpm := l.config.DefaultRPM
+	if override, ok := l.config.ModelRPM[model]; ok {
+		rpm = override
+	}
+	if rpm <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	bucket, ok := l.buckets[model]
+	if !ok {
+		bucket = newTokenBucket(rpm)
+		l.buckets[model] = bucket
+	}
+	l.mu.Unlock()
+
+	wait := bucket.reserve()
+	if wait <= 0 {
+		return nil
+	}
+
+	utils.PrintInfo(fmt.Sprintf("Rate limit for %s reached, waiting %s", model, wait.Round(time.Millisecond)))
+	if err := sleepContext(ctx, wait); err != nil {
+		bucket.cancel()
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// tokenBucket refills at rpm tokens per minute and allows bursts of a tenth of that.
+// Tokens may go negative; the deficit is how long the reserving caller must wait.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	perSec   float64
+	last     time.Time
+}
+
+func newTokenBucket(rpm int) *tokenBucket {
+	capacity := math.Max(1, float64(rpm)/10)
+	return &tokenBucket{
+		tokens:   capacity,
+		capacity: capacity,
+		perSec:   float64(rpm) / 60,
+		last:     time.Now(),
+	}
+}
+
+func (tb *tokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens = math.Min(tb.capacity, tb.tokens+now.Sub(tb.last).Seconds()*tb.perSec)
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.perSec * float64(time.Second))
+}
+
+// cancel returns a reserved token when the caller gave up waiting for it.
+func (tb *tokenBucket) cancel() {
+	tb.mu.Lock()
+	tb.tokens++
+	tb.mu.Unlock()
+}
+
+// limitedClient makes every call wait its turn in a Limiter before reaching next.
+type limitedClient struct {
+	next    Client
+	limiter *Limiter
+}
+
+func NewLimitedClient(next Client, limiter *Limiter) Client {
+	return &limitedClient{
+		next:    next,
+		limiter: limiter,
+	}
+}
+
+func (lc *limitedClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	ctx, release, err := lc.acquire(ctx, model)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return lc.next.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+}
+
+func (lc *limitedClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	return lc.stream(ctx, model, func(ctx context.Context) Stream {
+		return lc.next.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (lc *limitedClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	ctx, release, err := lc.acquire(ctx, model)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return lc.next.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+}
+
+func (lc *limitedClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return lc.stream(ctx, model, func(ctx context.Context) Stream {
+		return lc.next.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+// stream waits for a slot once ranging starts and holds it until the stream ends or the consumer
+// stops, except while the backend backs off between attempts.
+func (lc *limitedClient) stream(ctx context.Context, model string, next func(context.Context) Stream) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		ctx, release, err := lc.acquire(ctx, model)
+		if err != nil {
+			yield(models.StreamResponse{}, err)
+			return
+		}
+		defer release()
+
+		for chunk, err := range next(ctx) {
+			if !yield(chunk, err) {
+				return
+			}
+		}
+	}
+}
+
+// acquire waits for a slot for one call and returns a context carrying it, so that the backend's
+// retry loop can give the slot up while it backs off. The returned release frees whichever slot
+// the call holds at the end.
+func (lc *limitedClient) acquire(ctx context.Context, model string) (context.Context, func(), error) {
+	priority := priorityFromContext(ctx)
+	release, err := lc.limiter.Acquire(ctx, model, priority)
+	if err != nil {
+		return ctx, nil, err
+	}
+	slot := &limiterSlot{limiter: lc.limiter, model: model, priority: priority, release: release}
+	return context.WithValue(ctx, limiterSlotKey{}, slot), func() { slot.release() }, nil
+}
+
+type limiterSlotKey struct{}
+
+// limiterSlot is the limiter slot held by one call. It is only used from the goroutine making
+// the call.
+type limiterSlot struct {
+	limiter  *Limiter
+	model    string
+	priority Priority
+	release  func()
+}
+
+// retryBackoff waits delay before the next attempt of a call. A limiter slot held by the call is
+// released for the wait and queued for again afterwards, so a call backing off from a 429 or 5xx
+// does not keep other calls from the upstream.
+func retryBackoff(ctx context.Context, delay time.Duration) error {
+	slot, ok := ctx.Value(limiterSlotKey{}).(*limiterSlot)
+	if !ok {
+		return sleepContext(ctx, delay)
+	}
+
+	slot.release()
+	slot.release = func() {}
+	if err := sleepContext(ctx, delay); err != nil {
+		return err
+	}
+	release, err := slot.limiter.Acquire(ctx, slot.model, slot.priority)
+	if err != nil {
+		return err
+	}
+	slot.release = release
+	return nil
+}
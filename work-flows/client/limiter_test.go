@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"ai-agent/work-flows/models"
+)
+
+// backoffClient backs off once per call, as a backend does between attempts, and reports when it starts to.
+type backoffClient struct {
+	Client
+	delay      time.Duration
+	backingOff chan struct{}
+}
+
+func (bc *backoffClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	close(bc.backingOff)
+	if err := retryBackoff(ctx, bc.delay); err != nil {
+		return "", err
+	}
+	return "reply", nil
+}
+
+func TestLimitedClientReleasesSlotDuringBackoff(t *testing.T) {
+	limiter := NewLimiter(LimiterConfig{MaxInFlight: 1, QueueTimeout: time.Second})
+	next := &backoffClient{delay: 200 * time.Millisecond, backingOff: make(chan struct{})}
+	lc := NewLimitedClient(next, limiter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := lc.ChatCompletion(context.Background(), "model", 0, 0, nil)
+		done <- err
+	}()
+	<-next.backingOff
+
+	// The only slot is free while the first call backs off
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	release, err := limiter.Acquire(ctx, "model", PriorityLow)
+	if err != nil {
+		t.Fatalf("got %v, want the slot while the other call backs off", err)
+	}
+	release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("backing off call failed: %v", err)
+	}
+	if limiter.inFlight != 0 {
+		t.Errorf("got %d slots in flight after the call, want 0", limiter.inFlight)
+	}
+}
+
+// queued counts the calls waiting in l's lanes.
+func queued(l *Limiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, lane := range l.lanes {
+		n += lane.Len()
+	}
+	return n
+}
+
+func TestLimiterPriorityOrder(t *testing.T) {
+	type waiter struct {
+		name     string
+		priority Priority
+	}
+	tests := []struct {
+		name    string
+		waiters []waiter // In the order they queue
+		want    []string // In the order they are granted a slot
+	}{
+		{
+			name:    "higher priority goes first",
+			waiters: []waiter{{"low", PriorityLow}, {"normal", PriorityNormal}, {"high", PriorityHigh}},
+			want:    []string{"high", "normal", "low"},
+		},
+		{
+			name:    "same priority is first come first served",
+			waiters: []waiter{{"low1", PriorityLow}, {"high", PriorityHigh}, {"low2", PriorityLow}},
+			want:    []string{"high", "low1", "low2"},
+		},
+		{
+			name:    "out of range priorities are clamped",
+			waiters: []waiter{{"lowest", PriorityLow + 5}, {"highest", PriorityHigh - 5}},
+			want:    []string{"highest", "lowest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(LimiterConfig{MaxInFlight: 1, QueueTimeout: time.Second})
+			hold, err := limiter.Acquire(context.Background(), "model", PriorityHigh)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var got []string
+			var wg sync.WaitGroup
+			for i, w := range tt.waiters {
+				wg.Go(func() {
+					release, err := limiter.Acquire(context.Background(), "model", w.priority)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					got = append(got, w.name)
+					mu.Unlock()
+					release()
+				})
+				for queued(limiter) < i+1 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			hold()
+			wg.Wait()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "queue timeout", ctx: context.Background(), wantErr: ErrQueueTimeout},
+		{name: "caller gave up", ctx: canceled, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLimiter(LimiterConfig{MaxInFlight: 1, QueueTimeout: 20 * time.Millisecond})
+			hold, err := limiter.Acquire(context.Background(), "model", PriorityHigh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer hold()
+
+			if _, err := limiter.Acquire(tt.ctx, "model", PriorityHigh); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if n := queued(limiter); n != 0 {
+				t.Errorf("got %d calls still queued, want 0", n)
+			}
+		})
+	}
+}
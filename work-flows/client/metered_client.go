@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+// UsageRecorder receives one record per completed LLM call.
+type UsageRecorder interface {
+	RecordUsage(record models.UsageRecord)
+}
+
+// meteredClient reports token usage of every call to a UsageRecorder,
+// attributed to a session and to the agent named in the call context.
+type meteredClient struct {
+	next      Client
+	recorder  UsageRecorder
+	sessionID string
+}
+
+func NewMeteredClient(next Client, recorder UsageRecorder, sessionID string) Client {
+	return &meteredClient{
+		next:      next,
+		recorder:  recorder,
+		sessionID: sessionID,
+	}
+}
+
+func (mc *meteredClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	ctx, info := ensureCallInfo(ctx)
+	response, err := mc.next.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+	mc.record(ctx, model, info)
+	return response, err
+}
+
+func (mc *meteredClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	return mc.stream(ctx, model, func(ctx context.Context) Stream {
+		return mc.next.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (mc *meteredClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	ctx, info := ensureCallInfo(ctx)
+	response, err := mc.next.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+	mc.record(ctx, model, info)
+	return response, err
+}
+
+func (mc *meteredClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	return mc.stream(ctx, model, func(ctx context.Context) Stream {
+		return mc.next.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+// stream records usage once the stream ends, including when the consumer stops early.
+func (mc *meteredClient) stream(ctx context.Context, model string, next func(context.Context) Stream) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		ctx, info := ensureCallInfo(ctx)
+		defer mc.record(ctx, model, info)
+
+		for chunk, err := range next(ctx) {
+			if !yield(chunk, err) {
+				return
+			}
+		}
+	}
+}
+
+func (mc *meteredClient) record(ctx context.Context, requestedModel string, info *CallInfo) {
+	usage := info.Usage
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+
+	model := info.Model
+	if model == "" {
+		model = requestedModel
+	}
+
+	agent := AgentNameFromContext(ctx)
+	if agent == "" {
+		agent = "unknown"
+	}
+
+	mc.recorder.RecordUsage(models.UsageRecord{
+		SessionID:        mc.sessionID,
+		Agent:            agent,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CachedTokens:     usage.PromptTokensDetails.CachedTokens,
+		ReasoningTokens:  usage.CompletionTokensDetails.ReasoningTokens,
+		Cost:             usage.Cost,
+		Timestamp:        utils.GetCurrentTimestamp(),
+	})
+}
+
+// ensureCallInfo reuses the caller's CallInfo when there is one so both sides see the same details.
+func ensureCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	if info := callInfoFromContext(ctx); info != nil {
+		return ctx, info
+	}
+	info := &CallInfo{}
+	return WithCallInfo(ctx, info), info
+}
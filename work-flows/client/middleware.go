@@ -0,0 +1,379 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+// Middleware wraps a Client with behaviour that applies to every call, whatever the agent.
+type Middleware func(next Client) Client
+
+// Chain wraps c in middlewares; the first one listed is the outermost and sees each call first.
+func Chain(c Client, middlewares ...Middleware) Client {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		c = middlewares[i](c)
+	}
+	return c
+}
+
+// Request is a call as seen by an Interceptor.
+type Request struct {
+	Model          string
+	Temperature    float64
+	MaxTokens      int
+	Messages       []models.ChatMessage
+	ResponseFormat *models.ResponseFormat
+	Stream         bool
+}
+
+// Outcome is how a call ended. For streams, Content is the collected reply.
+type Outcome struct {
+	Content  string
+	Err      error
+	Duration time.Duration
+	Info     *CallInfo
+}
+
+// Interceptor turns a pair of hooks into a Middleware. Before may replace ctx, or fail the
+// call without reaching the next client; After sees every call that got past Before.
+type Interceptor struct {
+	Before func(ctx context.Context, req Request) (context.Context, error)
+	After  func(ctx context.Context, req Request, outcome Outcome)
+}
+
+func (i Interceptor) Middleware() Middleware {
+	return func(next Client) Client {
+		return &interceptedClient{next: next, interceptor: i}
+	}
+}
+
+type interceptedClient struct {
+	next        Client
+	interceptor Interceptor
+}
+
+func (ic *interceptedClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	req := Request{Model: model, Temperature: temperature, MaxTokens: maxTokens, Messages: messages}
+	return ic.complete(ctx, req, func(ctx context.Context) (string, error) {
+		return ic.next.ChatCompletion(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (ic *interceptedClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	req := Request{Model: model, Temperature: temperature, MaxTokens: maxTokens, Messages: messages, Stream: true}
+	return ic.stream(ctx, req, func(ctx context.Context) Stream {
+		return ic.next.ChatCompletionStream(ctx, model, temperature, maxTokens, messages)
+	})
+}
+
+func (ic *interceptedClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	req := Request{Model: model, Temperature: temperature, MaxTokens: maxTokens, Messages: messages, ResponseFormat: responseFormat}
+	return ic.complete(ctx, req, func(ctx context.Context) (string, error) {
+		return ic.next.ChatCompletionWithFormat(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (ic *interceptedClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	req := Request{Model: model, Temperature: temperature, MaxTokens: maxTokens, Messages: messages, ResponseFormat: responseFormat, Stream: true}
+	return ic.stream(ctx, req, func(ctx context.Context) Stream {
+		return ic.next.ChatCompletionWithFormatStream(ctx, model, temperature, maxTokens, messages, responseFormat)
+	})
+}
+
+func (ic *interceptedClient) before(ctx context.Context, req Request) (context.Context, error) {
+	if ic.interceptor.Before == nil {
+		return ctx, nil
+	}
+	return ic.interceptor.Before(ctx, req)
+}
+
+func (ic *interceptedClient) after(ctx context.Context, req Request, outcome Outcome) {
+	if ic.interceptor.After != nil {
+		ic.interceptor.After(ctx, req, outcome)
+	}
+}
+
+func (ic *interceptedClient) complete(ctx context.Context, req Request, call func(context.Context) (string, error)) (string, error) {
+	ctx, err := ic.before(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, info := ensureCallInfo(ctx)
+	start := time.Now()
+	response, err := call(ctx)
+	ic.after(ctx, req, Outcome{Content: response, Err: err, Duration: time.Since(start), Info: info})
+	return response, err
+}
+
+// stream runs After once the stream ends, including when the consumer stops early.
+func (ic *interceptedClient) stream(ctx context.Context, req Request, call func(context.Context) Stream) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		ctx, err := ic.before(ctx, req)
+		if err != nil {
+			yield(models.StreamResponse{}, err)
+			return
+		}
+
+		ctx, info := ensureCallInfo(ctx)
+		start := time.Now()
+		var collector StreamCollector
+		var streamErr error
+		defer func() {
+			ic.after(ctx, req, Outcome{Content: collector.Content(), Err: streamErr, Duration: time.Since(start), Info: info})
+		}()
+
+		for chunk, err := range call(ctx) {
+			if err != nil {
+				streamErr = err
+			} else {
+				collector.Add(chunk)
+			}
+			if !yield(chunk, err) {
+				return
+			}
+		}
+	}
+}
+
+// secretPatterns match credentials that providers sometimes echo back in error messages.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_-]{8,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`(?i)((?:api[_-]?key|x-api-key)["']?\s*[:=]\s*["']?)[A-Za-z0-9._-]{8,}`),
+}
+
+// RedactSecrets masks API keys in text that is about to be logged, both the configured keys
+// and anything shaped like one.
+func RedactSecrets(text string) string {
+	keys := strings.Split(os.Getenv("OPENROUTER_API_KEYS"), ",")
+	for _, name := range []string{"OPENROUTER_API_KEY", "LLM_API_KEY", "ANTHROPIC_API_KEY"} {
+		keys = append(keys, os.Getenv(name))
+	}
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); len(key) >= 8 {
+			text = strings.ReplaceAll(text, key, "[REDACTED]")
+		}
+	}
+	for _, pattern := range secretPatterns {
+		if pattern.NumSubexp() > 0 {
+			text = pattern.ReplaceAllString(text, "${1}[REDACTED]")
+		} else {
+			text = pattern.ReplaceAllString(text, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// Logging prints one line per call with the agent, model, duration and outcome, and the
+// start of the last message. Everything logged goes through RedactSecrets.
+func Logging() Middleware {
+	return Interceptor{
+		After: func(ctx context.Context, req Request, outcome Outcome) {
+			kind := "call"
+			if req.Stream {
+				kind = "stream"
+			}
+			prompt := ""
+			if len(req.Messages) > 0 {
+				prompt = truncate(req.Messages[len(req.Messages)-1].Text(), 80)
+			}
+
+			line := fmt.Sprintf("LLM %s [%s] %s in %s (%d messages, last %q)", kind, tagsFromContext(ctx), modelOf(req, outcome), outcome.Duration.Round(time.Millisecond), len(req.Messages), prompt)
+			if outcome.Err != nil {
+				utils.PrintError(RedactSecrets(fmt.Sprintf("%s failed: %v", line, outcome.Err)))
+				return
+			}
+			utils.PrintInfo(RedactSecrets(fmt.Sprintf("%s -> %d chars, %d tokens", line, len(outcome.Content), outcome.Info.Usage.TotalTokens)))
+		},
+	}.Middleware()
+}
+
+// Timing records each call's duration in its CallInfo and reports calls slower than slow; zero disables the report.
+func Timing(slow time.Duration) Middleware {
+	return Interceptor{
+		After: func(ctx context.Context, req Request, outcome Outcome) {
+			outcome.Info.Duration = outcome.Duration
+			if slow > 0 && outcome.Duration > slow {
+				utils.PrintInfo(fmt.Sprintf("Slow LLM call [%s] %s took %s", tagsFromContext(ctx), modelOf(req, outcome), outcome.Duration.Round(time.Millisecond)))
+			}
+		},
+	}.Middleware()
+}
+
+// Tagging marks every call with sessionID, so providers and the other middleware can attribute it.
+// The agent name is already set by the agents' call context.
+func Tagging(sessionID string) Middleware {
+	return Interceptor{
+		Before: func(ctx context.Context, req Request) (context.Context, error) {
+			if SessionIDFromContext(ctx) == "" && sessionID != "" {
+				ctx = WithSessionID(ctx, sessionID)
+			}
+			return ctx, nil
+		},
+	}.Middleware()
+}
+
+// Metering reports token usage of every call to recorder, attributed to sessionID.
+func Metering(recorder UsageRecorder, sessionID string) Middleware {
+	return func(next Client) Client {
+		return NewMeteredClient(next, recorder, sessionID)
+	}
+}
+
+// FaultConfig controls FaultInjection.
+type FaultConfig struct {
+	ErrorRate  float64       // Fraction of calls, 0 to 1, that fail before reaching the backend
+	StatusCode int           // Status of the injected APIError; defaults to 503
+	Latency    time.Duration // Added before every call
+}
+
+// FaultConfigFromEnv reads LLM_FAULT_RATE, LLM_FAULT_STATUS and LLM_FAULT_LATENCY.
+func FaultConfigFromEnv() FaultConfig {
+	var config FaultConfig
+	if v := os.Getenv("LLM_FAULT_RATE"); v != "" {
+		if rate, err := strconv.ParseFloat(v, 64); err == nil {
+			config.ErrorRate = min(max(rate, 0), 1)
+		}
+	}
+	if v := os.Getenv("LLM_FAULT_STATUS"); v != "" {
+		if status, err := strconv.Atoi(v); err == nil {
+			config.StatusCode = status
+		}
+	}
+	if v := os.Getenv("LLM_FAULT_LATENCY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.Latency = d
+		}
+	}
+	return config
+}
+
+func (fc FaultConfig) Enabled() bool {
+	return fc.ErrorRate > 0 || fc.Latency > 0
+}
+
+// FaultInjection delays calls and fails a share of them with an APIError, for trying out
+// how agents and the UI cope with a slow or failing backend.
+func FaultInjection(config FaultConfig) Middleware {
+	if config.StatusCode == 0 {
+		config.StatusCode = http.StatusServiceUnavailable
+	}
+
+	return Interceptor{
+		Before: func(ctx context.Context, req Request) (context.Context, error) {
+			if config.Latency > 0 {
+				if err := sleepContext(ctx, config.Latency); err != nil {
+					return ctx, err
+				}
+			}
+			if config.ErrorRate > 0 && rand.Float64() < config.ErrorRate {
+				utils.PrintInfo(fmt.Sprintf("Injecting fault into %s call [%s]", req.Model, tagsFromContext(ctx)))
+				return ctx, &APIError{StatusCode: config.StatusCode, Message: "injected fault"}
+			}
+			return ctx, nil
+		},
+	}.Middleware()
+}
+
+const (
+	MiddlewareTagging  = "tagging"
+	MiddlewareLogging  = "logging"
+	MiddlewareTiming   = "timing"
+	MiddlewareMetering = "metering"
+	MiddlewareFaults   = "faults"
+)
+
+// DefaultMiddlewares is the chain used when LLM_MIDDLEWARE is unset. Fault injection is
+// added at the end, closest to the backend, whenever LLM_FAULT_RATE or LLM_FAULT_LATENCY is set.
+var DefaultMiddlewares = []string{MiddlewareTagging, MiddlewareTiming, MiddlewareMetering}
+
+// ChainConfig describes the middleware a manager wraps its backend client in.
+type ChainConfig struct {
+	Middlewares []string // Names, outermost first
+	SessionID   string
+	Recorder    UsageRecorder // Needed by metering; metering is skipped without one
+	SlowCall    time.Duration // Threshold for the timing report
+	Faults      FaultConfig
+}
+
+// ChainConfigFromEnv reads LLM_MIDDLEWARE (comma-separated names, outermost first),
+// LLM_SLOW_CALL and the fault injection settings.
+func ChainConfigFromEnv() ChainConfig {
+	config := ChainConfig{
+		Middlewares: append([]string{}, DefaultMiddlewares...),
+		SlowCall:    20 * time.Second,
+		Faults:      FaultConfigFromEnv(),
+	}
+
+	if v := os.Getenv("LLM_MIDDLEWARE"); v != "" {
+		config.Middlewares = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				config.Middlewares = append(config.Middlewares, name)
+			}
+		}
+	} else if config.Faults.Enabled() {
+		config.Middlewares = append(config.Middlewares, MiddlewareFaults)
+	}
+
+	if v := os.Getenv("LLM_SLOW_CALL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.SlowCall = d
+		}
+	}
+	return config
+}
+
+// NewClientChain wraps next in the middleware named by config. Unknown names are reported and skipped.
+func NewClientChain(next Client, config ChainConfig) Client {
+	var middlewares []Middleware
+	for _, name := range config.Middlewares {
+		switch name {
+		case MiddlewareTagging:
+			middlewares = append(middlewares, Tagging(config.SessionID))
+		case MiddlewareLogging:
+			middlewares = append(middlewares, Logging())
+		case MiddlewareTiming:
+			middlewares = append(middlewares, Timing(config.SlowCall))
+		case MiddlewareMetering:
+			if config.Recorder != nil {
+				middlewares = append(middlewares, Metering(config.Recorder, config.SessionID))
+			}
+		case MiddlewareFaults:
+			middlewares = append(middlewares, FaultInjection(config.Faults))
+		default:
+			utils.PrintError(fmt.Sprintf("Ignoring unknown LLM middleware %q", name))
+		}
+	}
+	return Chain(next, middlewares...)
+}
+
+func modelOf(req Request, outcome Outcome) string {
+	if outcome.Info != nil && outcome.Info.Model != "" {
+		return outcome.Info.Model
+	}
+	return req.Model
+}
+
+// tagsFromContext formats the agent and session a call is attributed to.
+func tagsFromContext(ctx context.Context) string {
+	agent := AgentNameFromContext(ctx)
+	if agent == "" {
+		agent = "unknown"
+	}
+	if session := SessionIDFromContext(ctx); session != "" {
+		return agent + " " + session
+	}
+	return agent
+}
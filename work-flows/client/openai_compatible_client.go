@@ -0,0 +1,403 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	AuthSchemeBearer = "bearer" // Authorization: Bearer <key>
+	AuthSchemeHeader = "header" // Raw key in AuthHeader, e.g. api-key
+	AuthSchemeNone   = "none"
+)
+
+type OpenAICompatibleConfig struct {
+	BaseURL       string // Root that /chat/completions is appended to
+	APIKey        string
+	AuthScheme    string            // bearer (default), header or none
+	AuthHeader    string            // Header name for AuthSchemeHeader, defaults to api-key
+	Headers       map[string]string // Extra headers sent with every request
+	ModelOverride string            // When set, replaces the model of every request (e.g. a local model)
+}
+
+// openAICompatibleClient talks to any server exposing the OpenAI /chat/completions API.
+// With openRouter set it also sends OpenRouter's routing and usage accounting fields.
+type openAICompatibleClient struct {
+	config      OpenAICompatibleConfig
+	client      *http.Client
+	retryPolicy RetryPolicy
+	openRouter  bool
+	keys        *KeyPool // When set, each attempt takes its key from the pool instead of config.APIKey
+}
+
+func NewOpenAICompatibleClient(config OpenAICompatibleConfig) *openAICompatibleClient {
+	return newOpenAICompatibleClient(config, false)
+}
+
+func newOpenAICompatibleClient(config OpenAICompatibleConfig, openRouter bool) *openAICompatibleClient {
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+	if config.AuthScheme == "" {
+		config.AuthScheme = AuthSchemeBearer
+	}
+	if config.AuthScheme == AuthSchemeHeader && config.AuthHeader == "" {
+		config.AuthHeader = "api-key"
+	}
+
+	return &openAICompatibleClient{
+		config:      config,
+		client:      &http.Client{},
+		retryPolicy: RetryPolicyFromEnv(),
+		openRouter:  openRouter,
+	}
+}
+
+// SetKeyPool rotates requests over the pool's keys, moving on to the next key when one is rejected.
+func (oc *openAICompatibleClient) SetKeyPool(pool *KeyPool) {
+	oc.keys = pool
+}
+
+func (oc *openAICompatibleClient) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	oc.retryPolicy = policy
+}
+
+func (oc *openAICompatibleClient) ChatCompletionStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) Stream {
+	reqBody := models.ChatRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		Stream:      true,
+	}
+
+	return oc.stream(ctx, reqBody)
+}
+
+func (oc *openAICompatibleClient) ChatCompletion(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage) (string, error) {
+	reqBody := models.ChatRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		Stream:      false,
+	}
+
+	return oc.complete(ctx, reqBody)
+}
+
+func (oc *openAICompatibleClient) ChatCompletionWithFormat(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) (string, error) {
+	reqBody := models.ChatRequest{
+		Model:          model,
+		Messages:       messages,
+		Temperature:    temperature,
+		MaxTokens:      maxTokens,
+		Stream:         false,
+		ResponseFormat: responseFormat,
+	}
+
+	return oc.complete(ctx, reqBody)
+}
+
+func (oc *openAICompatibleClient) ChatCompletionWithFormatStream(ctx context.Context, model string, temperature float64, maxTokens int, messages []models.ChatMessage, responseFormat *models.ResponseFormat) Stream {
+	reqBody := models.ChatRequest{
+		Model:          model,
+		Messages:       messages,
+		Temperature:    temperature,
+		MaxTokens:      maxTokens,
+		Stream:         true,
+		ResponseFormat: responseFormat,
+	}
+
+	return oc.stream(ctx, reqBody)
+}
+
+// prepare applies the model override, the tools and session tag in ctx, and the backend-specific usage and routing fields.
+func (oc *openAICompatibleClient) prepare(ctx context.Context, reqBody *models.ChatRequest) {
+	if oc.config.ModelOverride != "" {
+		reqBody.Model = oc.config.ModelOverride
+	}
+	reqBody.Tools = toolsFromContext(ctx)
+	reqBody.User = SessionIDFromContext(ctx)
+
+	if oc.openRouter {
+		routingFromContext(ctx).apply(reqBody)
+		reqBody.Usage = &models.UsageOptions{Include: true}
+	} else if reqBody.Stream {
+		reqBody.StreamOptions = &models.StreamOptions{IncludeUsage: true}
+	}
+}
+
+func (oc *openAICompatibleClient) complete(ctx context.Context, reqBody models.ChatRequest) (string, error) {
+	oc.prepare(ctx, &reqBody)
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	failovers := 0
+	for attempt := 1; ; attempt++ {
+		resp, key, err := oc.send(ctx, jsonData)
+		if err != nil {
+			if oc.failover(key, err, &failovers) {
+				attempt--
+				continue
+			}
+			if delay, ok := oc.retryPolicy.retryDelay(err, attempt); ok {
+				utils.PrintInfo(fmt.Sprintf("Retrying %s in %s (attempt %d/%d): %v", reqBody.Model, delay, attempt+1, oc.retryPolicy.MaxAttempts, err))
+				if err := retryBackoff(ctx, delay); err != nil {
+					return "", err
+				}
+				continue
+			}
+			return "", err
+		}
+
+		var chatResp models.ChatResponse
+		err = json.NewDecoder(resp.Body).Decode(&chatResp)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		if len(chatResp.Choices) == 0 {
+			return "", fmt.Errorf("no response from API")
+		}
+
+		oc.recordKeyUsage(key, chatResp.Usage)
+		choice := chatResp.Choices[0]
+		recordCallInfo(ctx, CallInfo{RequestedModel: reqBody.Model, Model: chatResp.Model, Provider: chatResp.Provider, Usage: chatResp.Usage, FinishReason: choice.FinishReason, ToolCalls: choice.Message.ToolCalls})
+
+		return chatResp.Choices[0].Message.Content, nil
+	}
+}
+
+// stream retries until the first chunk has been yielded; after that a failure
+// is reported to the caller, since the partial reply may already be on screen.
+func (oc *openAICompatibleClient) stream(ctx context.Context, reqBody models.ChatRequest) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		oc.prepare(ctx, &reqBody)
+
+		jsonData, err := json.Marshal(reqBody)
+		if err != nil {
+			yield(models.StreamResponse{}, fmt.Errorf("failed to marshal request: %w", err))
+			return
+		}
+
+		failovers := 0
+		for attempt := 1; ; attempt++ {
+			resp, key, err := oc.send(ctx, jsonData)
+			sent := 0
+			if err == nil {
+				info := CallInfo{RequestedModel: reqBody.Model}
+				sent, err = readStream(resp.Body, yield, &info)
+				resp.Body.Close()
+				oc.recordKeyUsage(key, info.Usage)
+				recordCallInfo(ctx, info)
+				if err == nil || errors.Is(err, errStreamStopped) {
+					return
+				}
+				err = fmt.Errorf("failed to read response: %w", err)
+			}
+
+			if sent == 0 {
+				if oc.failover(key, err, &failovers) {
+					attempt--
+					continue
+				}
+				if delay, ok := oc.retryPolicy.retryDelay(err, attempt); ok {
+					utils.PrintInfo(fmt.Sprintf("Retrying %s stream in %s (attempt %d/%d): %v", reqBody.Model, delay, attempt+1, oc.retryPolicy.MaxAttempts, err))
+					if err = retryBackoff(ctx, delay); err == nil {
+						continue
+					}
+				}
+			}
+
+			if sent > 0 && oc.keys != nil {
+				oc.keys.Report(key, err)
+			}
+			yield(models.StreamResponse{}, err)
+			return
+		}
+	}
+}
+
+// failover reports a failed attempt to the key pool and decides whether to retry at once with
+// another key. Each key gets at most one immediate try per request; beyond that the retry policy applies.
+func (oc *openAICompatibleClient) failover(key string, err error, failovers *int) bool {
+	if oc.keys == nil || key == "" {
+		return false
+	}
+	oc.keys.Report(key, err)
+	if !oc.keys.Benches(err) || *failovers >= oc.keys.Len()-1 {
+		return false
+	}
+	*failovers++
+	utils.PrintInfo(fmt.Sprintf("Retrying with another API key: %v", err))
+	return true
+}
+
+func (oc *openAICompatibleClient) recordKeyUsage(key string, usage models.TokenUsage) {
+	if oc.keys != nil {
+		oc.keys.RecordUsage(key, usage)
+	}
+}
+
+// send performs a single POST to /chat/completions and returns the response only on HTTP 200,
+// along with the API key it used.
+func (oc *openAICompatibleClient) send(ctx context.Context, jsonData []byte) (*http.Response, string, error) {
+	apiKey := oc.config.APIKey
+	if oc.keys != nil {
+		key, err := oc.keys.Pick()
+		if err != nil {
+			return nil, "", err
+		}
+		apiKey = key
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", oc.config.BaseURL+"/chat/completions", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, apiKey, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range oc.config.Headers {
+		req.Header.Set(key, value)
+	}
+	switch oc.config.AuthScheme {
+	case AuthSchemeBearer:
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+	case AuthSchemeHeader:
+		req.Header.Set(oc.config.AuthHeader, apiKey)
+	}
+	req.Header.Set("Content-Type", ContentTypeHeader)
+
+	resp, err := oc.client.Do(req)
+	if err != nil {
+		return nil, apiKey, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return nil, apiKey, newAPIError(resp, body)
+	}
+
+	return resp, apiKey, nil
+}
+
+// readStream yields SSE chunks, notes which model answered, the final usage and finish reason,
+// and reports how many chunks were yielded. A chunk that cannot be parsed once the reply has
+// started, or a body that ends without [DONE], is an error: the reply may be missing text.
+func readStream(body io.Reader, yield func(models.StreamResponse, error) bool, info *CallInfo) (int, error) {
+	sent := 0
+	done := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if after, ok := strings.CutPrefix(line, "data: "); ok {
+			data := strings.TrimSpace(after)
+
+			if data == "[DONE]" {
+				done = true
+				break
+			}
+
+			// OpenRouter reports a provider failing mid-stream as an error object in a chunk
+			var payload struct {
+				models.StreamResponse
+				Error *streamErrorPayload `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				if sent > 0 {
+					return sent, fmt.Errorf("unparseable stream chunk %s: %w", truncate(data, 200), err)
+				}
+				utils.PrintError(fmt.Sprintf("Skipping unparseable stream chunk: %v: %s", err, truncate(data, 200)))
+				continue
+			}
+
+			streamResp := payload.StreamResponse
+			if info.Model == "" && streamResp.Model != "" {
+				info.Model = streamResp.Model
+				info.Provider = streamResp.Provider
+			}
+			if streamResp.Usage.TotalTokens > 0 {
+				info.Usage = streamResp.Usage
+			}
+			if len(streamResp.Choices) > 0 {
+				if reason := streamResp.Choices[0].FinishReason; reason != nil && *reason != "" {
+					info.FinishReason = *reason
+				}
+			}
+			if payload.Error != nil {
+				return sent, payload.Error.apiError()
+			}
+
+			if !yield(streamResp, nil) {
+				return sent, errStreamStopped
+			}
+			sent++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return sent, err
+	}
+	if !done {
+		return sent, fmt.Errorf("stream ended without [DONE]: %w", io.ErrUnexpectedEOF)
+	}
+	return sent, nil
+}
+
+// streamErrorPayload is the error object OpenRouter sends as a chunk when a provider fails mid-stream.
+type streamErrorPayload struct {
+	Code    any    `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiError keeps a numeric code as the status, so retry rules apply when nothing was sent yet.
+func (e *streamErrorPayload) apiError() *APIError {
+	apiErr := &APIError{Message: e.Message}
+	if code, ok := e.Code.(float64); ok {
+		apiErr.StatusCode = int(code)
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = fmt.Sprintf("provider error %v", e.Code)
+	}
+	return apiErr
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// recordCallInfo logs fallback usage and early stops, and copies call details to the caller's CallInfo, if any.
+func recordCallInfo(ctx context.Context, info CallInfo) {
+	if info.UsedFallback() {
+		utils.PrintInfo(fmt.Sprintf("Model %s answered in place of %s", info.Model, info.RequestedModel))
+	}
+	if info.FinishReason == "length" || info.FinishReason == "content_filter" {
+		utils.PrintError(fmt.Sprintf("Reply from %s stopped early: finish_reason %s", info.RequestedModel, info.FinishReason))
+	}
+
+	if target := callInfoFromContext(ctx); target != nil {
+		*target = info
+	}
+}
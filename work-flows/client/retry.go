@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how transient upstream failures are retried.
+type RetryPolicy struct {
+	MaxAttempts  int           // Total attempts including the first one; 1 disables retries
+	InitialDelay time.Duration // Backoff before the second attempt
+	MaxDelay     time.Duration // Upper bound for a single wait, including Retry-After
+	Multiplier   float64       // Backoff growth factor per attempt
+	Jitter       float64       // Fraction (0-1) of each delay that is randomized
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     10 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.3,
+	}
+}
+
+// RetryPolicyFromEnv starts from DefaultRetryPolicy and applies any
+// LLM_RETRY_MAX_ATTEMPTS, LLM_RETRY_INITIAL_DELAY and LLM_RETRY_MAX_DELAY overrides.
+func RetryPolicyFromEnv() RetryPolicy {
+	policy := DefaultRetryPolicy()
+
+	if v := os.Getenv("LLM_RETRY_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			policy.MaxAttempts = n
+		}
+	}
+	if v := os.Getenv("LLM_RETRY_INITIAL_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			policy.InitialDelay = d
+		}
+	}
+	if v := os.Getenv("LLM_RETRY_MAX_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			policy.MaxDelay = d
+		}
+	}
+
+	return policy
+}
+
+// backoff returns the jittered wait before the given retry (1 = first retry).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	jitter := min(max(p.Jitter, 0), 1)
+	delay = delay*(1-jitter) + rand.Float64()*delay*jitter
+
+	return time.Duration(delay)
+}
+
+// APIError is returned when the upstream API answers with a non-200 status.
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// newAPIError builds an APIError from a failed response, keeping the upstream error message.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    upstreamErrorMessage(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	return apiErr
+}
+
+func upstreamErrorMessage(body []byte) string {
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error.Message != "" {
+		return payload.Error.Message
+	}
+
+	message := strings.TrimSpace(string(body))
+	if len(message) > 500 {
+		message = message[:500] + "..."
+	}
+	return message
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms of Retry-After.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// retryDelay decides whether err is worth another attempt and how long to wait first.
+func (p RetryPolicy) retryDelay(err error, retry int) (time.Duration, bool) {
+	if retry >= p.MaxAttempts {
+		return 0, false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNoAPIKey) {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if !apiErr.Retryable() {
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			// Waiting longer than MaxDelay would stall the learner, so surface the error instead
+			if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+				return 0, false
+			}
+			return apiErr.RetryAfter, true
+		}
+	}
+
+	return p.backoff(retry), true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
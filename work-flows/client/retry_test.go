@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		min, max time.Duration
+	}{
+		{name: "empty", value: ""},
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "padded zero", value: " 0 "},
+		{name: "negative seconds", value: "-1"},
+		{name: "garbage", value: "soon"},
+		{name: "past date", value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)},
+		{name: "future date", value: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), min: 8 * time.Second, max: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("got %s, want between %s and %s", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestAPIErrorRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusRequestTimeout, true},
+		{http.StatusRequestEntityTooLarge, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{529, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.status), func(t *testing.T) {
+			if got := (&APIError{StatusCode: tt.status}).Retryable(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   20,
+	}
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name      string
+		err       error
+		retry     int
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{name: "first retry", err: unavailable, retry: 1, wantDelay: 100 * time.Millisecond, wantRetry: true},
+		{name: "backoff capped at max delay", err: unavailable, retry: 2, wantDelay: time.Second, wantRetry: true},
+		{name: "attempts used up", err: unavailable, retry: 3},
+		{name: "wrapped api error", err: fmt.Errorf("failed to read response: %w", unavailable), retry: 1, wantDelay: 100 * time.Millisecond, wantRetry: true},
+		{name: "network error", err: errors.New("connection reset"), retry: 1, wantDelay: 100 * time.Millisecond, wantRetry: true},
+		{name: "retry after honoured", err: &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 500 * time.Millisecond}, retry: 1, wantDelay: 500 * time.Millisecond, wantRetry: true},
+		{name: "retry after beyond max delay", err: &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 5 * time.Second}, retry: 1},
+		{name: "client error", err: &APIError{StatusCode: http.StatusBadRequest}, retry: 1},
+		{name: "canceled", err: context.Canceled, retry: 1},
+		{name: "deadline", err: fmt.Errorf("failed to make request: %w", context.DeadlineExceeded), retry: 1},
+		{name: "no api key", err: fmt.Errorf("pool empty: %w", ErrNoAPIKey), retry: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.retryDelay(tt.err, tt.retry)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Errorf("got %s, %v; want %s, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+// StreamCollector accumulates stream chunks and classifies how the stream ended.
+type StreamCollector struct {
+	content            strings.Builder
+	finishReason       string
+	nativeFinishReason string
+	err                string
+	toolCalls          []models.ToolCall
+}
+
+// Add records a chunk and returns its text delta, if any.
+func (sc *StreamCollector) Add(chunk models.StreamResponse) string {
+	if len(chunk.Choices) == 0 {
+		return ""
+	}
+
+	choice := chunk.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		sc.finishReason = *choice.FinishReason
+	}
+	if choice.NativeFinishReason != nil && *choice.NativeFinishReason != "" {
+		sc.nativeFinishReason = *choice.NativeFinishReason
+	}
+
+	for _, delta := range choice.Delta.ToolCalls {
+		sc.addToolCallDelta(delta)
+	}
+
+	sc.content.WriteString(choice.Delta.Content)
+	return choice.Delta.Content
+}
+
+// addToolCallDelta appends argument fragments to the call at the delta's index. A delta with a
+// negative index comes from a malformed chunk and is ignored.
+func (sc *StreamCollector) addToolCallDelta(delta models.ToolCallDelta) {
+	if delta.Index < 0 {
+		utils.PrintError(fmt.Sprintf("Ignoring tool call delta with index %d", delta.Index))
+		return
+	}
+
+	for len(sc.toolCalls) <= delta.Index {
+		sc.toolCalls = append(sc.toolCalls, models.ToolCall{Type: "function"})
+	}
+
+	call := &sc.toolCalls[delta.Index]
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+	call.Function.Name += delta.Function.Name
+	call.Function.Arguments += delta.Function.Arguments
+}
+
+// Fail records the terminal error of the stream.
+func (sc *StreamCollector) Fail(err error) {
+	if err != nil && sc.err == "" {
+		sc.err = err.Error()
+	}
+}
+
+// Collect ranges over stream, passing each text delta to onDelta, and returns the result.
+func (sc *StreamCollector) Collect(stream Stream, onDelta func(string)) models.StreamResult {
+	for chunk, err := range stream {
+		if err != nil {
+			sc.Fail(err)
+			break
+		}
+		if delta := sc.Add(chunk); delta != "" && onDelta != nil {
+			onDelta(delta)
+		}
+	}
+	return sc.Result()
+}
+
+func (sc *StreamCollector) Content() string {
+	return sc.content.String()
+}
+
+func (sc *StreamCollector) Result() models.StreamResult {
+	result := models.StreamResult{
+		Content:            sc.content.String(),
+		FinishReason:       sc.finishReason,
+		NativeFinishReason: sc.nativeFinishReason,
+		Error:              sc.err,
+		ToolCalls:          sc.toolCalls,
+	}
+
+	switch {
+	case sc.err != "" || sc.finishReason == "error":
+		result.Status = models.StreamStatusError
+		if result.Error == "" {
+			result.Error = "provider reported an error"
+		}
+	case sc.finishReason == "length":
+		result.Status = models.StreamStatusTruncated
+	case sc.finishReason == "content_filter":
+		result.Status = models.StreamStatusContentFilter
+	case sc.finishReason == "":
+		result.Status = models.StreamStatusIncomplete
+	default:
+		// stop, tool_calls and provider-specific reasons all mean the model finished on its own
+		result.Status = models.StreamStatusComplete
+	}
+
+	return result
+}
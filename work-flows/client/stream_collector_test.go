@@ -0,0 +1,79 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"ai-agent/work-flows/models"
+)
+
+func contentChunk(text string) models.StreamResponse {
+	return models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{Content: text}}}}
+}
+
+func finishedChunk(reason string) models.StreamResponse {
+	return models.StreamResponse{Choices: []models.StreamChoice{{FinishReason: &reason}}}
+}
+
+// scriptedStream yields chunks, then err if it is not nil.
+func scriptedStream(err error, chunks ...models.StreamResponse) Stream {
+	return func(yield func(models.StreamResponse, error) bool) {
+		for _, chunk := range chunks {
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(models.StreamResponse{}, err)
+		}
+	}
+}
+
+func TestStreamCollectorResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      Stream
+		wantStatus  models.StreamStatus
+		wantContent string
+		wantError   string
+	}{
+		{name: "stop", stream: scriptedStream(nil, contentChunk("Hi"), contentChunk(" there"), finishedChunk("stop")), wantStatus: models.StreamStatusComplete, wantContent: "Hi there"},
+		{name: "tool calls", stream: scriptedStream(nil, finishedChunk("tool_calls")), wantStatus: models.StreamStatusComplete},
+		{name: "provider specific reason", stream: scriptedStream(nil, contentChunk("Hi"), finishedChunk("end_turn")), wantStatus: models.StreamStatusComplete, wantContent: "Hi"},
+		{name: "length", stream: scriptedStream(nil, contentChunk("Hi"), finishedChunk("length")), wantStatus: models.StreamStatusTruncated, wantContent: "Hi"},
+		{name: "content filter", stream: scriptedStream(nil, finishedChunk("content_filter")), wantStatus: models.StreamStatusContentFilter},
+		{name: "no finish reason", stream: scriptedStream(nil, contentChunk("Hi")), wantStatus: models.StreamStatusIncomplete, wantContent: "Hi"},
+		{name: "error finish reason", stream: scriptedStream(nil, finishedChunk("error")), wantStatus: models.StreamStatusError, wantError: "provider reported an error"},
+		{name: "stream error", stream: scriptedStream(errors.New("connection reset"), contentChunk("Hi")), wantStatus: models.StreamStatusError, wantContent: "Hi", wantError: "connection reset"},
+		{name: "error after stop", stream: scriptedStream(errors.New("connection reset"), finishedChunk("stop")), wantStatus: models.StreamStatusError, wantError: "connection reset"},
+		{name: "empty finish reason is ignored", stream: scriptedStream(nil, finishedChunk("stop"), finishedChunk("")), wantStatus: models.StreamStatusComplete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var collector StreamCollector
+			result := collector.Collect(tt.stream, nil)
+
+			if result.Status != tt.wantStatus || result.Content != tt.wantContent || result.Error != tt.wantError {
+				t.Errorf("got %s %q (error %q), want %s %q (error %q)", result.Status, result.Content, result.Error, tt.wantStatus, tt.wantContent, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestStreamCollectorToolCalls(t *testing.T) {
+	var collector StreamCollector
+	collector.Add(models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{ToolCalls: []models.ToolCallDelta{
+		{Index: 0, ID: "call_1", Function: models.ToolCallFunction{Name: "lookup", Arguments: `{"word":`}},
+		{Index: -1, Function: models.ToolCallFunction{Arguments: "ignored"}},
+	}}}}})
+	collector.Add(models.StreamResponse{Choices: []models.StreamChoice{{Delta: models.StreamDelta{ToolCalls: []models.ToolCallDelta{
+		{Index: 0, Function: models.ToolCallFunction{Arguments: `"hike"}`}},
+	}}}}})
+
+	calls := collector.Result().ToolCalls
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Type != "function" ||
+		calls[0].Function.Name != "lookup" || calls[0].Function.Arguments != `{"word":"hike"}` {
+		t.Errorf("got tool calls %+v, want one lookup call with the joined arguments", calls)
+	}
+}
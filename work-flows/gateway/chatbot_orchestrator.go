@@ -2,21 +2,31 @@ package gateway
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"ai-agent/utils"
 	"ai-agent/work-flows/agents"
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/managers"
 	"ai-agent/work-flows/models"
+	"ai-agent/work-flows/services"
 
 	"github.com/fatih/color"
 )
 
+// resumeHistoryMessages is how much of a resumed conversation is shown before continuing it
+const resumeHistoryMessages = 6
+
 type ChatbotOrchestrator struct {
+	apiKey              string
 	conversationManager *managers.ConversationManager
 	personalizeManager  *managers.PersonalizeManager
 	sessionActive       bool
@@ -30,8 +40,9 @@ func NewChatbotOrchestrator(apiKey string, level models.ConversationLevel, topic
 		conversationManager = managers.NewConversationManager(apiKey, level, topic, language, sessionId)
 	}
 
-	personalizeManager := managers.NewPersonalizeManager(client.NewOpenRouterClient(apiKey))
+	personalizeManager := managers.NewPersonalizeManager(client.NewBackendClient(apiKey))
 	orchestrator := &ChatbotOrchestrator{
+		apiKey:              apiKey,
 		conversationManager: conversationManager,
 		personalizeManager:  personalizeManager,
 		sessionActive:       false,
@@ -41,6 +52,79 @@ func NewChatbotOrchestrator(apiKey string, level models.ConversationLevel, topic
 	return orchestrator
 }
 
+// ResumeChatbotOrchestrator rebuilds a CLI session saved in the session store.
+func ResumeChatbotOrchestrator(apiKey string, sessionID string) (*ChatbotOrchestrator, error) {
+	conversationManager, err := managers.LoadConversationManager(apiKey, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatbotOrchestrator{
+		apiKey:              apiKey,
+		conversationManager: conversationManager,
+		personalizeManager:  managers.NewPersonalizeManager(client.NewBackendClient(apiKey)),
+		sessionActive:       false,
+	}, nil
+}
+
+// ImportChatbotOrchestrator starts a CLI session from an imported transcript, to continue it.
+// Topic, level and language are used where the export does not record them.
+func ImportChatbotOrchestrator(apiKey string, transcript *services.ImportedTranscript, topic string, level models.ConversationLevel, language string) *ChatbotOrchestrator {
+	conversationManager := managers.ImportConversationManager(apiKey, transcript, managers.NewImportSessionID(), topic, level, language)
+	conversationManager.Persist()
+
+	return &ChatbotOrchestrator{
+		apiKey:              apiKey,
+		conversationManager: conversationManager,
+		personalizeManager:  managers.NewPersonalizeManager(client.NewBackendClient(apiKey)),
+		sessionActive:       false,
+	}
+}
+
+// AssessTranscriptFiles assesses each history export in paths, shows the result and saves it
+// next to the other exports as <file>_assessment.json. It returns how many were assessed.
+func AssessTranscriptFiles(apiKey string, paths []string) int {
+	yellow := color.New(color.FgYellow, color.Bold)
+	cyan := color.New(color.FgCyan)
+
+	assessed := 0
+	for i, path := range paths {
+		yellow.Printf("\n📊 [%d/%d] %s\n", i+1, len(paths), path)
+
+		transcript, err := services.ReadHistoryExport(path)
+		if err != nil {
+			utils.PrintError(err.Error())
+			continue
+		}
+
+		// The session only lives for the assessment, so it is not saved
+		manager := managers.ImportConversationManager(apiKey, transcript, managers.NewImportSessionID(), "", models.ConversationLevelIntermediate, "Vietnamese")
+		response := manager.Assess(context.Background())
+		if !response.Success {
+			utils.PrintError(fmt.Sprintf("Assessment failed: %s", response.Error))
+			continue
+		}
+		manager.GetAssessmentAgent().DisplayAssessment(response.Result)
+
+		var assessment any = response.Result
+		var parsed map[string]any
+		if err := json.Unmarshal([]byte(response.Result), &parsed); err == nil {
+			assessment = parsed
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "_assessment.json"
+		utils.ExportToJSON(name, map[string]any{
+			"source":     path,
+			"session_id": transcript.SessionID,
+			"assessment": assessment,
+		}, "assessment_export", "/import/assess", 200)
+		assessed++
+	}
+
+	cyan.Printf("\nAssessed %d of %d transcripts\n", assessed, len(paths))
+	return assessed
+}
+
 func (co *ChatbotOrchestrator) printWelcome() {
 	// Welcome message is now integrated into showMainMenu
 }
@@ -53,6 +137,29 @@ func (co *ChatbotOrchestrator) StartConversation() {
 	co.showMainMenu()
 }
 
+// ResumeConversation shows where a resumed session left off and continues it.
+func (co *ChatbotOrchestrator) ResumeConversation() {
+	cyan := color.New(color.FgCyan)
+	blue := color.New(color.FgBlue)
+	green := color.New(color.FgGreen)
+
+	agent := co.conversationManager.GetConversationAgent()
+	cyan.Printf("🔁 Resuming session %s (topic: %s, level: %s)\n", co.conversationManager.GetSessionId(), agent.GetTopic(), agent.GetLevel())
+
+	history := co.conversationManager.GetHistoryManager().GetRecentHistory(resumeHistoryMessages)
+	for _, message := range history {
+		switch message.Role {
+		case models.MessageRoleUser:
+			green.Printf("You: %s\n", message.Content)
+		case models.MessageRoleAssistant:
+			blue.Printf("AI: %s\n", message.Content)
+		}
+	}
+
+	co.sessionActive = true
+	co.interactiveSession()
+}
+
 func (co *ChatbotOrchestrator) StartPersonalizeMode() {
 	co.createPersonalizedLesson()
 }
@@ -125,6 +232,7 @@ func (co *ChatbotOrchestrator) createPersonalizedLesson() {
 	// Create the lesson
 	task := models.JobRequest{
 		Task: "create personalized lesson detail",
+		Type: models.TaskTypePersonalizeLesson,
 		Metadata: map[string]any{
 			"topic":    topic,
 			"level":    level,
@@ -132,7 +240,7 @@ func (co *ChatbotOrchestrator) createPersonalizedLesson() {
 		},
 	}
 
-	response := co.personalizeManager.ProcessTask(task)
+	response := co.personalizeManager.ProcessTask(context.Background(), task)
 	if response.Success {
 		green.Println("\n✅ Personalized lesson created successfully!")
 		fmt.Println(response.Result)
@@ -185,14 +293,15 @@ func (co *ChatbotOrchestrator) startConversationMode() {
 
 	conversationJob := models.JobRequest{
 		Task: "conversation",
+		Type: models.TaskTypeConversation,
 	}
 
-	response := co.conversationManager.ProcessJob(conversationJob)
+	response := co.conversationManager.ProcessJob(context.Background(), conversationJob)
 	if !response.Success {
 		utils.PrintInfo(fmt.Sprintf("Failed to start conversation: %s", response.Error))
 	} else {
-		// Update the most recent AI message or create new one if none exists
-		co.conversationManager.GetHistoryManager().UpdateLastMessage(models.MessageRoleAssistant, response.Result)
+		// The agent has recorded the starter as the first turn
+		starterIndex := recordedTurn(response)
 
 		suggestionAgent, exists := co.conversationManager.GetAgent("SuggestionAgent")
 		if exists && response.Success {
@@ -201,19 +310,20 @@ func (co *ChatbotOrchestrator) startConversationMode() {
 				LastAIMessage: response.Result,
 			}
 
-			suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
+			suggestionResponse := suggestionAgent.ProcessTask(context.Background(), suggestionJob)
 			if suggestionResponse.Success {
 				sa := suggestionAgent.(*agents.SuggestionAgent)
 				sa.DisplaySuggestions(suggestionResponse.Result)
 
-				// Attach suggestions to the most recent AI message
+				// Attach suggestions to the starter message
 				var suggestion models.SuggestionResponse
 				if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
-					co.conversationManager.GetHistoryManager().UpdateLastSuggestion(&suggestion)
+					co.conversationManager.GetHistoryManager().SetSuggestion(starterIndex, &suggestion)
 				}
 			}
 		}
 	}
+	co.conversationManager.Persist()
 
 	co.interactiveSession()
 }
@@ -262,6 +372,26 @@ func (co *ChatbotOrchestrator) interactiveSession() {
 			continue
 		}
 
+		if format, ok := strings.CutPrefix(strings.ToLower(userMessage), "export"); ok && (format == "" || strings.HasPrefix(format, " ")) {
+			co.exportTranscript(strings.TrimSpace(format))
+			continue
+		}
+
+		if strings.ToLower(userMessage) == "undo" {
+			co.undoLastExchange()
+			continue
+		}
+
+		if strings.ToLower(userMessage) == "retry" {
+			co.regenerateReply()
+			continue
+		}
+
+		if arg, ok := strings.CutPrefix(strings.ToLower(userMessage), "edit "); ok {
+			co.editMessage(reader, strings.TrimSpace(arg))
+			continue
+		}
+
 		if strings.ToLower(userMessage) == "assessment" {
 			co.showAssessment()
 			continue
@@ -275,20 +405,15 @@ func (co *ChatbotOrchestrator) interactiveSession() {
 	}
 }
 
-func (co *ChatbotOrchestrator) processUserMessage(userMessage string) {
+// processUserMessage evaluates the learner's message, answers it and records the turn, and
+// reports whether a reply was recorded.
+func (co *ChatbotOrchestrator) processUserMessage(userMessage string) bool {
+	historyManager := co.conversationManager.GetHistoryManager()
 
-	lastAIMessage := ""
-	history := co.conversationManager.GetHistoryManager().GetConversationHistory()
-	if len(history) > 0 {
-		for i := len(history) - 1; i >= 0; i-- {
-			if history[i].Role == models.MessageRoleAssistant {
-				lastAIMessage = history[i].Content
-				break
-			}
-		}
-	}
+	lastAIMessage := historyManager.LastReply()
 
-	// Evaluate user message and attach to exact index
+	// Evaluate user message; it is attached once the conversation agent has recorded the turn
+	var evaluation *models.EvaluationResponse
 	evaluateAgent, evalExists := co.conversationManager.GetAgent("EvaluateAgent")
 	if evalExists && lastAIMessage != "" {
 		evaluateJob := models.JobRequest{
@@ -297,53 +422,166 @@ func (co *ChatbotOrchestrator) processUserMessage(userMessage string) {
 			LastAIMessage: lastAIMessage,
 		}
 
-		evaluateResponse := evaluateAgent.ProcessTask(evaluateJob)
+		evaluateResponse := evaluateAgent.ProcessTask(context.Background(), evaluateJob)
 		if evaluateResponse.Success {
 			ea := evaluateAgent.(*agents.EvaluateAgent)
 			ea.DisplayEvaluation(evaluateResponse.Result)
 
-			// Attach evaluation to the most recent user message
 			if parsed, err := agents.ParseEvaluationResponse(evaluateResponse.Result); err == nil {
-				co.conversationManager.GetHistoryManager().UpdateLastEvaluation(parsed)
+				evaluation = parsed
 			}
 		}
 	}
 
 	conversationJob := models.JobRequest{
 		Task:        "conversation",
+		Type:        models.TaskTypeConversation,
 		UserMessage: userMessage,
 	}
 
 	utils.PrintInfo("Processing your message...")
 
-	conversationResponse := co.conversationManager.ProcessJob(conversationJob)
+	conversationResponse := co.conversationManager.ProcessJob(context.Background(), conversationJob)
 	if !conversationResponse.Success {
 		utils.PrintError(fmt.Sprintf("Conversation failed: %s", conversationResponse.Error))
-		return
+		return false
+	}
+
+	// The agent records the learner's message and the reply as one turn
+	turnIndex := recordedTurn(conversationResponse)
+	if evaluation != nil {
+		historyManager.SetEvaluation(turnIndex, evaluation)
 	}
 
-	// Generate suggestions and attach to exact AI message index
+	co.attachSuggestions(turnIndex, conversationResponse.Result)
+	co.conversationManager.Persist()
+	return true
+}
+
+// attachSuggestions generates suggestions for answering reply, shows them and keeps them on its turn.
+func (co *ChatbotOrchestrator) attachSuggestions(turnIndex int, reply string) {
 	suggestionAgent, exists := co.conversationManager.GetAgent("SuggestionAgent")
-	if exists {
-		suggestionJob := models.JobRequest{
-			Task:          "suggestion",
-			LastAIMessage: conversationResponse.Result,
-		}
+	if !exists {
+		return
+	}
 
-		suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
-		if suggestionResponse.Success {
-			sa := suggestionAgent.(*agents.SuggestionAgent)
-			sa.DisplaySuggestions(suggestionResponse.Result)
+	suggestionJob := models.JobRequest{
+		Task:          "suggestion",
+		LastAIMessage: reply,
+	}
 
-			// Attach suggestions to the most recent AI message
-			var suggestion models.SuggestionResponse
-			if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
-				co.conversationManager.GetHistoryManager().UpdateLastSuggestion(&suggestion)
-			}
+	suggestionResponse := suggestionAgent.ProcessTask(context.Background(), suggestionJob)
+	if suggestionResponse.Success {
+		sa := suggestionAgent.(*agents.SuggestionAgent)
+		sa.DisplaySuggestions(suggestionResponse.Result)
+
+		// Attach suggestions to the reply they were generated for
+		var suggestion models.SuggestionResponse
+		if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
+			co.conversationManager.GetHistoryManager().SetSuggestion(turnIndex, &suggestion)
 		}
 	}
 }
 
+// exportTranscript saves the conversation in format, markdown by default, to the exports folder.
+func (co *ChatbotOrchestrator) exportTranscript(format string) {
+	if err := ExportSessionTranscript(co.conversationManager.Transcript(), format); err != nil {
+		utils.PrintError(err.Error())
+	}
+}
+
+// ExportSessionTranscript writes transcript in format, markdown by default, to the exports folder.
+func ExportSessionTranscript(transcript *services.Transcript, format string) error {
+	if format == "" {
+		format = services.ExportFormatMarkdown
+	}
+
+	data, filename, err := services.ExportTranscript(transcript, format)
+	if err != nil {
+		return err
+	}
+	path, err := utils.WriteExportFile(filename, data)
+	if err != nil {
+		return err
+	}
+
+	color.New(color.FgGreen, color.Bold).Printf("✓ Transcript exported: %s\n", filename)
+	color.New(color.FgCyan).Printf("📁 File location: %s\n", path)
+	return nil
+}
+
+// undoLastExchange drops the learner's last message and its reply from the conversation.
+func (co *ChatbotOrchestrator) undoLastExchange() {
+	yellow := color.New(color.FgYellow)
+	green := color.New(color.FgGreen)
+	blue := color.New(color.FgBlue)
+
+	historyManager := co.conversationManager.GetHistoryManager()
+	turn, ok := historyManager.Undo()
+	if !ok {
+		yellow.Println("Nothing to undo yet.")
+		return
+	}
+	co.conversationManager.Persist()
+
+	green.Printf("↩️  Removed your message: %s\n", turn.User)
+	blue.Printf("AI: %s\n", historyManager.LastReply())
+}
+
+// regenerateReply asks for a different reply to the learner's last message.
+func (co *ChatbotOrchestrator) regenerateReply() {
+	utils.PrintInfo("Regenerating the last reply...")
+
+	response := co.conversationManager.Regenerate(context.Background())
+	if !response.Success {
+		utils.PrintError(fmt.Sprintf("Regenerate failed: %s", response.Error))
+		return
+	}
+
+	co.attachSuggestions(recordedTurn(response), response.Result)
+	co.conversationManager.Persist()
+}
+
+// editMessage replaces the learner's message at position, as numbered by 'history', and continues
+// the conversation from there on a new branch. The old branch is kept but no longer shown.
+func (co *ChatbotOrchestrator) editMessage(reader *bufio.Reader, arg string) {
+	yellow := color.New(color.FgYellow)
+	cyan := color.New(color.FgCyan)
+
+	historyManager := co.conversationManager.GetHistoryManager()
+	position, err := strconv.Atoi(arg)
+	turn, ok := historyManager.TurnAt(position)
+	if err != nil || !ok || turn.User == "" {
+		yellow.Println("❌ Usage: edit <n>, where n is the number of one of your messages in 'history'")
+		return
+	}
+
+	cyan.Printf("✏️  Editing [%d]: %s\n", position, turn.User)
+	fmt.Print("➤ New message: ")
+	input, _ := reader.ReadString('\n')
+	newMessage := strings.TrimSpace(input)
+	if newMessage == "" {
+		yellow.Println("Edit cancelled.")
+		return
+	}
+
+	previous := historyManager.Head()
+	historyManager.Rewind(turn.Index)
+	if !co.processUserMessage(newMessage) {
+		historyManager.Checkout(previous)
+		yellow.Println("Your conversation is unchanged.")
+	}
+}
+
+// recordedTurn returns the index of the turn a conversation job recorded, or -1, which no
+// annotation attaches to.
+func recordedTurn(response *models.JobResponse) int {
+	if response.Turn == nil {
+		return -1
+	}
+	return response.Turn.Index
+}
+
 func (co *ChatbotOrchestrator) endSession() {
 	co.sessionActive = false
 	green := color.New(color.FgGreen, color.Bold)
@@ -373,10 +611,14 @@ func (co *ChatbotOrchestrator) showHelp() {
 
 	cyan.Println("\nConversation Mode Commands:")
 	white.Println("• quit/exit - End the conversation")
-	white.Println("• stats - Show conversation statistics")
+	white.Println("• stats - Show conversation statistics, token usage and cost")
 	white.Println("• history - Show conversation history and export it")
 	white.Println("• assessment - Show assessment of the conversation")
 	white.Println("• reset - Reset conversation history")
+	white.Println("• export [markdown|html|csv|jsonl] - Save the transcript to the exports folder")
+	white.Println("• undo - Remove your last message and its reply")
+	white.Println("• retry - Get a different reply to your last message")
+	white.Println("• edit <n> - Rewrite your message [n] from 'history' and continue from there")
 	white.Println("• level - Show current conversation level")
 	white.Println("• set level - Change conversation difficulty level")
 	white.Println("• Any other text - Continue the conversation with your response")
@@ -396,6 +638,47 @@ func (co *ChatbotOrchestrator) showStats() {
 	green.Printf("• Your messages: %d\n", stats["user_messages"])
 	green.Printf("• My responses: %d\n", stats["bot_messages"])
 	green.Printf("• Session ID: %s\n", co.conversationManager.GetSessionId())
+
+	usage := co.conversationManager.GetUsageSummary()
+	cyan.Println("\n💰 Token Usage & Cost:")
+	green.Printf("• LLM calls: %d\n", usage.Total.Calls)
+	green.Printf("• Tokens: %d prompt (%d cached), %d completion (%d reasoning)\n",
+		usage.Total.PromptTokens, usage.Total.CachedTokens, usage.Total.CompletionTokens, usage.Total.ReasoningTokens)
+	green.Printf("• Cost: %.6f %s\n", usage.Total.Cost, usage.Currency)
+
+	for _, agent := range sortedKeys(usage.ByAgent) {
+		totals := usage.ByAgent[agent]
+		green.Printf("  - %s: %d calls, %d tokens, %.6f %s\n",
+			agent, totals.Calls, totals.PromptTokens+totals.CompletionTokens, totals.Cost, usage.Currency)
+	}
+	for _, model := range sortedKeys(usage.ByModel) {
+		totals := usage.ByModel[model]
+		green.Printf("  - %s: %d calls, %d tokens, %.6f %s\n",
+			model, totals.Calls, totals.PromptTokens+totals.CompletionTokens, totals.Cost, usage.Currency)
+	}
+
+	cyan.Println("\n🗄️  Response Cache:")
+	green.Printf("• %s\n", client.SharedResponseCache().Stats())
+
+	if client.Backend() == client.BackendOpenRouter {
+		cyan.Println("\n🔑 API Keys:")
+		for _, key := range client.SharedKeyPool(co.apiKey).Stats() {
+			green.Printf("• %s: %d calls, %d tokens, %.6f %s", key.Key, key.Calls, key.Tokens, key.Spend, usage.Currency)
+			if key.BenchedUntil.After(time.Now()) {
+				green.Printf(" (benched until %s: %s)", key.BenchedUntil.Format(time.Kitchen), key.LastError)
+			}
+			green.Println()
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (co *ChatbotOrchestrator) setLevelInteractive() {
@@ -433,6 +716,7 @@ func (co *ChatbotOrchestrator) setLevelInteractive() {
 	}
 
 	co.conversationManager.GetConversationAgent().SetLevel(newLevel)
+	co.conversationManager.Persist()
 
 	green.Printf("✅ Level changed to: %s\n", newLevel)
 
@@ -515,15 +799,15 @@ func (co *ChatbotOrchestrator) resetConversation() {
 
 	conversationJob := models.JobRequest{
 		Task: "conversation",
+		Type: models.TaskTypeConversation,
 	}
 
-	response := co.conversationManager.ProcessJob(conversationJob)
+	response := co.conversationManager.ProcessJob(context.Background(), conversationJob)
 	if !response.Success {
 		utils.PrintInfo(fmt.Sprintf("Conversation reset: %s", response.Result))
 	} else {
-		// Update the most recent AI message or create new one if none exists
-		co.conversationManager.GetHistoryManager().UpdateLastMessage(models.MessageRoleAssistant, response.Result)
-		// co.manager.GetHistoryManager().EnforceMax(20)
+		// The agent has recorded the starter as the first turn
+		starterIndex := recordedTurn(response)
 
 		suggestionAgent, exists := co.conversationManager.GetAgent("SuggestionAgent")
 		if exists && response.Success {
@@ -532,19 +816,20 @@ func (co *ChatbotOrchestrator) resetConversation() {
 				LastAIMessage: response.Result,
 			}
 
-			suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
+			suggestionResponse := suggestionAgent.ProcessTask(context.Background(), suggestionJob)
 			if suggestionResponse.Success {
 				sa := suggestionAgent.(*agents.SuggestionAgent)
 				sa.DisplaySuggestions(suggestionResponse.Result)
 
-				// Attach suggestions to the most recent AI message
+				// Attach suggestions to the starter message
 				var suggestion models.SuggestionResponse
 				if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
-					co.conversationManager.GetHistoryManager().UpdateLastSuggestion(&suggestion)
+					co.conversationManager.GetHistoryManager().SetSuggestion(starterIndex, &suggestion)
 				}
 			}
 		}
 	}
+	co.conversationManager.Persist()
 }
 
 func (co *ChatbotOrchestrator) showConversationHistory() {
@@ -567,20 +852,19 @@ func (co *ChatbotOrchestrator) showConversationHistory() {
 	cyan.Printf("Total messages: %d\n", len(history))
 	cyan.Printf("Session ID: %s\n\n", co.conversationManager.GetSessionId())
 
-	for i, message := range history {
-		switch message.Role {
-		case models.MessageRoleUser:
-			green.Printf("[%d] You: %s\n", i+1, message.Content)
-		case models.MessageRoleAssistant:
-			blue.Printf("    AI: %s\n", message.Content)
-		case models.MessageRoleSystem:
-			continue
+	for position, turn := range co.conversationManager.GetHistoryManager().Turns() {
+		if turn.User != "" {
+			green.Printf("[%d] You: %s\n", position, turn.User)
 		}
+		blue.Printf("    AI: %s\n", turn.Reply)
 	}
 
 	white.Println()
 	exportData := map[string]any{
 		"session_id": co.conversationManager.GetSessionId(),
+		"topic":      co.conversationManager.GetTopic(),
+		"level":      co.conversationManager.GetConversationAgent().GetLevel(),
+		"language":   co.conversationManager.GetLanguage(),
 		"history":    history,
 	}
 	utils.ExportToJSON("conversation_history.json", exportData, "conversation_export", "/export/history", 200)
@@ -608,14 +892,8 @@ func (co *ChatbotOrchestrator) showAssessment() {
 	yellow.Println("\n📊 Assessment")
 	cyan.Println("Starting comprehensive assessment...")
 
-	// Create progress channel
-	progressChan := make(chan models.AssessmentStreamResponse, 100)
-
-	// Start streaming assessment
-	go assessmentAgent.GenerateAssessmentStream(historyManager, progressChan)
-
 	// Handle progress events
-	for response := range progressChan {
+	for response := range assessmentAgent.GenerateAssessmentStream(context.Background(), historyManager) {
 		if response.Error != "" {
 			utils.PrintError(fmt.Sprintf("Assessment failed: %s", response.Error))
 			return
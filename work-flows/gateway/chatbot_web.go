@@ -7,21 +7,31 @@ import (
 	"ai-agent/work-flows/managers"
 	"ai-agent/work-flows/models"
 	"ai-agent/work-flows/services"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+// streamRequestTimeout bounds how long a single SSE request may keep upstream LLM calls open.
+const streamRequestTimeout = 2 * time.Minute
+
 type ChatbotWeb struct {
 	conversationSessions map[string]*managers.ConversationManager
+	streaming            map[string]bool // Sessions with a reply streaming
 	personalizeManager   *managers.PersonalizeManager
 	mu                   sync.Mutex
 	apiKey               string
@@ -30,6 +40,7 @@ type ChatbotWeb struct {
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	Turn    int    `json:"turn"` // Index of the turn the message belongs to, which edits refer to
 }
 
 type ChatRequest struct {
@@ -54,6 +65,9 @@ type ChatResponse struct {
 	Evaluation  any           `json:"evaluation,omitzero"`
 	Suggestions any           `json:"suggestions,omitzero"`
 	SessionID   string        `json:"session_id,omitzero"`
+	Keys        any           `json:"keys,omitzero"`
+	TopicID     string        `json:"topic_id,omitzero"` // Topic as used in prompt file names, for selecting it again
+	Assessments any           `json:"assessments,omitzero"`
 }
 
 type PromptInfo struct {
@@ -95,11 +109,12 @@ type LessonsResponse struct {
 func NewChatbotWeb(apiKey string) *ChatbotWeb {
 	web := &ChatbotWeb{
 		conversationSessions: make(map[string]*managers.ConversationManager),
+		streaming:            make(map[string]bool),
 		apiKey:               apiKey,
 	}
 
 	// Initialize PersonalizeManager once and reuse
-	personalizeClient := client.NewOpenRouterClient(apiKey)
+	personalizeClient := client.NewBackendClient(apiKey)
 	web.personalizeManager = managers.NewPersonalizeManager(personalizeClient)
 
 	return web
@@ -110,12 +125,19 @@ func (cw *ChatbotWeb) StartWebServer(port string) {
 	http.HandleFunc("/", cw.serveChatHTML)
 	// Orchestrator
 	http.HandleFunc("/api/create-session", cw.handleCreateSession)
+	http.HandleFunc("/api/session", cw.handleGetSession)
+	http.HandleFunc("/api/undo", cw.handleUndo)
+	http.HandleFunc("/api/regenerate", cw.handleRegenerate)
+	http.HandleFunc("/api/export", cw.handleExport)
+	http.HandleFunc("/api/import", cw.handleImport)
 	http.HandleFunc("/api/stream", cw.handleStream)
 	http.HandleFunc("/api/translate", cw.handleTranslate)
 	http.HandleFunc("/api/suggestions", cw.handleGetSuggestions)
 	http.HandleFunc("/api/assessment", cw.handleGetAssessmentStream)
+	http.HandleFunc("/api/usage", cw.handleGetUsage)
 	// Personalize
 	http.HandleFunc("/api/personalize", cw.handlePersonalize)
+	http.HandleFunc("/api/personalize/stream", cw.handlePersonalizeStream)
 	// Prompts + Topics
 	http.HandleFunc("/api/prompts", cw.handleGetPrompts)
 	http.HandleFunc("/api/topics", cw.handleGetTopics)
@@ -138,6 +160,9 @@ func (cw *ChatbotWeb) StartWebServer(port string) {
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
 
+// handleStream streams the reply to the learner's message. With an edit query parameter, the
+// message replaces the one of the turn with that index: the conversation continues from just
+// before that turn on a new branch, and goes back to where it was if no reply is recorded.
 func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 	userMessage := r.URL.Query().Get("message")
 	sessionID := r.URL.Query().Get("session_id")
@@ -149,6 +174,15 @@ func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No session ID provided", http.StatusBadRequest)
 		return
 	}
+	editTurn := -1
+	if edit := r.URL.Query().Get("edit"); edit != "" {
+		turn, err := strconv.Atoi(edit)
+		if err != nil || turn < 0 {
+			http.Error(w, "Invalid edit turn", http.StatusBadRequest)
+			return
+		}
+		editTurn = turn
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -161,58 +195,51 @@ func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cw.mu.Lock()
+	ctx, cancel := context.WithTimeout(r.Context(), streamRequestTimeout)
+	defer cancel()
 
-	manager, exists := cw.conversationSessions[sessionID]
+	manager, exists := cw.session(sessionID)
 	if !exists {
-		cw.mu.Unlock()
 		http.Error(w, "Invalid session ID", http.StatusBadRequest)
 		return
 	}
+	if !cw.beginStream(sessionID) {
+		http.Error(w, "A reply is already streaming for this session", http.StatusConflict)
+		return
+	}
+	defer cw.endStream(sessionID)
 
-	conversationLevel := manager.GetConversationAgent().GetLevel()
-	pathPrompts := filepath.Join(utils.GetPromptsDir(), manager.GetConversationAgent().Topic+"_prompt.yaml")
-	levelPrompt := agents.GetLevelSpecificPrompt(pathPrompts, conversationLevel, "conversational")
+	conversationAgent := manager.GetConversationAgent()
+	historyManager := manager.GetHistoryManager()
 
-	messages := []models.Message{
-		{
-			Role:    models.MessageRoleSystem,
-			Content: levelPrompt,
-		},
-	}
-	history := manager.GetHistoryManager().GetConversationHistory()
-	if len(history) > 0 {
-		messages = append(messages, history...)
+	turnIndex := -1 // Set once the reply is recorded as a new turn
+	if editTurn >= 0 {
+		_, previousHead, previousSummary := historyManager.SummarizedTree()
+		if _, ok := historyManager.Rewind(editTurn); !ok {
+			http.Error(w, "No such message to edit", http.StatusBadRequest)
+			return
+		}
+		// Nothing is persisted until the edited turn is recorded; without it the rewind is undone
+		defer func() {
+			if turnIndex < 0 {
+				historyManager.Checkout(previousHead)
+				historyManager.SetSummary(previousSummary)
+			}
+		}()
 	}
 
-	messages = append(messages, models.Message{
-		Role:    models.MessageRoleUser,
-		Content: userMessage,
-	})
-
-	streamResponseChan := make(chan models.StreamResponse, 10)
-	done := make(chan bool)
-	evaluationChan := make(chan map[string]any, 1)
+	lastAIMessage := historyManager.LastReply()
+	messages := conversationAgent.BuildMessages(ctx, userMessage)
 
-	// Record user's message first
-	manager.GetHistoryManager().AddMessage(models.MessageRoleUser, userMessage)
-	// manager.GetHistoryManager().EnforceMax(20)
+	// Buffered so the evaluation goroutine never blocks, even if the stream ends first
+	evaluationChan := make(chan streamEvaluation, 1)
 
-	// Run evaluation in parallel (non-blocking) and attach to the exact user message index
+	// Run evaluation in parallel (non-blocking); it is attached once the turn is recorded
 	evaluateAgent, evalExists := manager.GetAgent("EvaluateAgent")
 	if evalExists {
 		go func() {
 			defer close(evaluationChan)
 
-			lastAIMessage := ""
-			history := manager.GetHistoryManager().GetConversationHistory()
-			for i := len(history) - 1; i >= 0; i-- {
-				if history[i].Role == models.MessageRoleAssistant {
-					lastAIMessage = history[i].Content
-					break
-				}
-			}
-
 			utils.PrintInfo(fmt.Sprintf("Evaluating user message: '%s', Last AI: '%s'", userMessage, lastAIMessage))
 
 			evaluateJob := models.JobRequest{
@@ -220,18 +247,25 @@ func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 				UserMessage:   userMessage,
 				LastAIMessage: lastAIMessage,
 			}
-			evaluateResponse := evaluateAgent.ProcessTask(evaluateJob)
+			// Fields are passed on as they stream in; the send gives up once the request is over
+			evaluateCtx := agents.WithFieldListener(ctx, func(event utils.JSONFieldEvent) {
+				select {
+				case evaluationChan <- streamEvaluation{partial: &event}:
+				case <-ctx.Done():
+				}
+			})
+			evaluateResponse := evaluateAgent.ProcessTask(evaluateCtx, evaluateJob)
 			if evaluateResponse.Success {
 				utils.PrintInfo("Evaluation successful, preparing to send to client")
 				var evaluationMap map[string]any
 				if err := json.Unmarshal([]byte(evaluateResponse.Result), &evaluationMap); err == nil {
 					utils.PrintInfo("Sending evaluation to channel")
-					evaluationChan <- evaluationMap
-					utils.PrintInfo("Evaluation sent to channel successfully")
-					// Attach parsed evaluation to the most recent user message
-					if parsed, err := agents.ParseEvaluationResponse(evaluateResponse.Result); err == nil {
-						manager.GetHistoryManager().UpdateLastEvaluation(parsed)
+					parsed, _ := agents.ParseEvaluationResponse(evaluateResponse.Result)
+					select {
+					case evaluationChan <- streamEvaluation{data: evaluationMap, parsed: parsed}:
+					case <-ctx.Done():
 					}
+					utils.PrintInfo("Evaluation sent to channel successfully")
 				} else {
 					utils.PrintError(fmt.Sprintf("Failed to unmarshal evaluation: %v", err))
 				}
@@ -244,101 +278,81 @@ func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 		close(evaluationChan)
 	}
 
-	go manager.GetConversationAgent().GetClient().ChatCompletionStream(
-		manager.GetConversationAgent().GetModel(),
-		manager.GetConversationAgent().GetTemperature(),
-		manager.GetConversationAgent().GetMaxTokens(),
-		messages,
-		streamResponseChan,
-		done,
-	)
-
-	var fullResponse strings.Builder
+	var collector client.StreamCollector
 	evaluationSent := false
-	historyManager := manager.GetHistoryManager()
+	var evaluation *models.EvaluationResponse
 
-	for {
-		select {
-		case <-done:
-			aiResponse := fullResponse.String()
-			// Update the most recent AI message or create new one if none exists
-			historyManager.UpdateLastMessage(models.MessageRoleAssistant, aiResponse)
-
-			// Generate suggestions for the AI message and attach to most recent AI message
-			// if suggestionAgent, ok := manager.GetAgent("SuggestionAgent"); ok {
-			// 	suggestionJob := models.JobRequest{Task: "suggestion", LastAIMessage: aiResponse}
-			// 	suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
-			// 	if suggestionResponse.Success {
-			// 		var suggestion models.SuggestionResponse
-			// 		if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
-			// 			historyManager.UpdateLastSuggestion(&suggestion)
-			// 		}
-			// 	}
-			// }
-
-			// Send message completion signal
-			messageDoneData := map[string]any{
-				"done": true,
-				"type": "message",
+	forwardEvaluation := func(eval streamEvaluation, ok bool) {
+		if ok && eval.partial != nil {
+			partialData := map[string]any{
+				"done": false,
+				"type": "partial",
+				"data": eval.partial,
 			}
-			messageDoneJSON, _ := json.Marshal(messageDoneData)
-			fmt.Fprintf(w, "data: %s\n\n", messageDoneJSON)
+			partialJSON, _ := json.Marshal(partialData)
+			fmt.Fprintf(w, "data: %s\n\n", partialJSON)
 			flusher.Flush()
+			return
+		}
 
-			// Wait for evaluation if not yet received
-			if !evaluationSent {
-				utils.PrintInfo("Waiting for evaluation before sending done...")
-				evalMap, ok := <-evaluationChan
-				if ok && evalMap != nil {
-					utils.PrintInfo("Received evaluation in done handler, sending to client")
-					evalData := map[string]any{
-						"done": false,
-						"type": "evaluation",
-						"data": evalMap,
-					}
-					evalJSON, _ := json.Marshal(evalData)
-					fmt.Fprintf(w, "data: %s\n\n", evalJSON)
-					flusher.Flush()
-					evaluationSent = true
-				} else {
-					utils.PrintInfo("Evaluation channel closed in done handler")
-					evaluationSent = true
-				}
-			}
-
-			// Send evaluation completion signal
-			evaluationDoneData := map[string]any{
-				"done": true,
-				"type": "evaluation",
-			}
-			evaluationDoneJSON, _ := json.Marshal(evaluationDoneData)
-			fmt.Fprintf(w, "data: %s\n\n", evaluationDoneJSON)
-			flusher.Flush()
-			cw.mu.Unlock()
+		evaluationSent = true
+		if !ok || eval.data == nil {
+			utils.PrintInfo("Evaluation channel closed without data")
 			return
+		}
+		evaluation = eval.parsed
 
-		case evalMap, ok := <-evaluationChan:
-			if ok && evalMap != nil && !evaluationSent {
-				utils.PrintInfo("Sending evaluation to client via SSE")
-				evalData := map[string]any{
-					"done": false,
-					"type": "evaluation",
-					"data": evalMap,
-				}
-				evalJSON, _ := json.Marshal(evalData)
-				utils.PrintInfo(fmt.Sprintf("Evaluation JSON: %s", string(evalJSON)))
-				fmt.Fprintf(w, "data: %s\n\n", evalJSON)
-				flusher.Flush()
-				evaluationSent = true
-			} else if !ok {
-				utils.PrintInfo("Evaluation channel closed without data")
+		utils.PrintInfo("Sending evaluation to client via SSE")
+		evalData := map[string]any{
+			"done": false,
+			"type": "evaluation",
+			"data": eval.data,
+		}
+		evalJSON, _ := json.Marshal(evalData)
+		utils.PrintInfo(fmt.Sprintf("Evaluation JSON: %s", string(evalJSON)))
+		fmt.Fprintf(w, "data: %s\n\n", evalJSON)
+		flusher.Flush()
+	}
+
+	stream := conversationAgent.StreamReply(
+		conversationAgent.CallContext(ctx),
+		conversationAgent.GetModel(),
+		conversationAgent.GetTemperature(),
+		conversationAgent.GetMaxTokens(),
+		messages,
+	)
+
+	// The stream is pumped into a channel so the evaluation can be passed on as soon as it is
+	// ready, even while the reply is slow to start or a tool round yields no text.
+	chunks := make(chan streamChunk)
+	go func() {
+		defer close(chunks)
+		for streamResponse, err := range stream {
+			select {
+			case chunks <- streamChunk{response: streamResponse, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
 			}
+		}
+	}()
 
-		case streamResponse := <-streamResponseChan:
-			if len(streamResponse.Choices) > 0 && streamResponse.Choices[0].Delta.Content != "" {
-				content := streamResponse.Choices[0].Delta.Content
-				fullResponse.WriteString(content)
+	evaluations := evaluationChan
+streaming:
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				break streaming
+			}
+			if chunk.err != nil {
+				collector.Fail(chunk.err)
+				break streaming
+			}
 
+			if content := collector.Add(chunk.response); content != "" {
 				data := map[string]any{
 					"content": content,
 					"done":    false,
@@ -348,8 +362,100 @@ func (cw *ChatbotWeb) handleStream(w http.ResponseWriter, r *http.Request) {
 				fmt.Fprintf(w, "data: %s\n\n", jsonData)
 				flusher.Flush()
 			}
+		case eval, ok := <-evaluations:
+			forwardEvaluation(eval, ok)
+			if evaluationSent {
+				evaluations = nil
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		// Client went away or the deadline passed; an unfinished turn is not recorded,
+		// so the learner can simply send the message again.
+		utils.PrintInfo(fmt.Sprintf("Stream for session %s stopped: %v", sessionID, ctx.Err()))
+		return
+	}
+
+	result := collector.Result()
+	if result.Complete() {
+		// Record the learner's message and the reply as a new turn, as the CLI does
+		turnIndex = historyManager.AppendTurn(models.Turn{User: userMessage, Reply: result.Content})
+	} else {
+		// Tell the client why the reply stopped instead of saving a half sentence
+		utils.PrintError(fmt.Sprintf("Stream for session %s ended %s: %s", sessionID, result.Status, result.Message()))
+		statusData := map[string]any{
+			"done":          false,
+			"type":          "stream_status",
+			"status":        result.Status,
+			"finish_reason": result.FinishReason,
+			"message":       result.Message(),
+		}
+		statusJSON, _ := json.Marshal(statusData)
+		fmt.Fprintf(w, "data: %s\n\n", statusJSON)
+		flusher.Flush()
+	}
+
+	// Generate suggestions for the AI message and attach them to the turn's reply
+	// if suggestionAgent, ok := manager.GetAgent("SuggestionAgent"); ok {
+	// 	suggestionJob := models.JobRequest{Task: "suggestion", LastAIMessage: aiResponse}
+	// 	suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
+	// 	if suggestionResponse.Success {
+	// 		var suggestion models.SuggestionResponse
+	// 		if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
+	// 			historyManager.SetSuggestion(turnIndex, &suggestion)
+	// 		}
+	// 	}
+	// }
+
+	// Send message completion signal, with the new turn's index (-1 if none) for editing it later
+	messageDoneData := map[string]any{
+		"done": true,
+		"type": "message",
+		"turn": turnIndex,
+	}
+	messageDoneJSON, _ := json.Marshal(messageDoneData)
+	fmt.Fprintf(w, "data: %s\n\n", messageDoneJSON)
+	flusher.Flush()
+
+	// Wait for evaluation if not yet received
+	if !evaluationSent {
+		utils.PrintInfo("Waiting for evaluation before sending done...")
+	}
+	for !evaluationSent {
+		eval, ok := <-evaluationChan
+		forwardEvaluation(eval, ok)
+	}
+
+	if turnIndex >= 0 {
+		if evaluation != nil {
+			historyManager.SetEvaluation(turnIndex, evaluation)
 		}
+		manager.Persist()
 	}
+
+	// Send evaluation completion signal
+	evaluationDoneData := map[string]any{
+		"done": true,
+		"type": "evaluation",
+	}
+	evaluationDoneJSON, _ := json.Marshal(evaluationDoneData)
+	fmt.Fprintf(w, "data: %s\n\n", evaluationDoneJSON)
+	flusher.Flush()
+}
+
+// streamChunk is one item of a reply stream, passed from the goroutine ranging over it.
+type streamChunk struct {
+	response models.StreamResponse
+	err      error
+}
+
+// streamEvaluation carries a turn's evaluation from the evaluation goroutine, both as sent
+// to the client and as recorded on the turn, or one field of it that has streamed in.
+type streamEvaluation struct {
+	data    map[string]any
+	parsed  *models.EvaluationResponse
+	partial *utils.JSONFieldEvent
 }
 
 func (cw *ChatbotWeb) handleGetTopics(w http.ResponseWriter, r *http.Request) {
@@ -396,6 +502,7 @@ func (cw *ChatbotWeb) handlePersonalize(w http.ResponseWriter, r *http.Request)
 
 	task := models.JobRequest{
 		Task: "create personalized lesson detail",
+		Type: models.TaskTypePersonalizeLesson,
 		Metadata: map[string]any{
 			"topic":    req.Topic,
 			"level":    req.Level,
@@ -403,7 +510,7 @@ func (cw *ChatbotWeb) handlePersonalize(w http.ResponseWriter, r *http.Request)
 		},
 	}
 
-	resp := cw.personalizeManager.ProcessTask(task)
+	resp := cw.personalizeManager.ProcessTask(r.Context(), task)
 	if !resp.Success {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Success: false,
@@ -418,6 +525,80 @@ func (cw *ChatbotWeb) handlePersonalize(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// handlePersonalizeStream generates a personalized lesson like handlePersonalize, sending each
+// field of the lesson as a "partial" event as soon as it has streamed in.
+func (cw *ChatbotWeb) handlePersonalizeStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	topic, level, userLanguage := query.Get("topic"), query.Get("level"), query.Get("language")
+	if topic == "" || level == "" || userLanguage == "" {
+		http.Error(w, "Topic, level, and language are required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), streamRequestTimeout)
+	defer cancel()
+
+	// The listener runs on this goroutine, inside ProcessTask, so it can write to the response
+	ctx = agents.WithFieldListener(ctx, func(event utils.JSONFieldEvent) {
+		partialData := map[string]any{
+			"done": false,
+			"type": "partial",
+			"data": event,
+		}
+		partialJSON, _ := json.Marshal(partialData)
+		fmt.Fprintf(w, "data: %s\n\n", partialJSON)
+		flusher.Flush()
+	})
+
+	task := models.JobRequest{
+		Task: "create personalized lesson detail",
+		Type: models.TaskTypePersonalizeLesson,
+		Metadata: map[string]any{
+			"topic":    topic,
+			"level":    level,
+			"language": userLanguage,
+		},
+	}
+
+	resp := cw.personalizeManager.ProcessTask(ctx, task)
+	if !resp.Success {
+		errorData := map[string]any{
+			"done":  true,
+			"type":  "error",
+			"error": resp.Error,
+		}
+		errorJSON, _ := json.Marshal(errorData)
+		fmt.Fprintf(w, "data: %s\n\n", errorJSON)
+		flusher.Flush()
+		return
+	}
+
+	finalData := map[string]any{
+		"done":    true,
+		"type":    "lesson",
+		"content": resp.Result,
+	}
+	finalJSON, _ := json.Marshal(finalData)
+	fmt.Fprintf(w, "data: %s\n\n", finalJSON)
+	flusher.Flush()
+}
+
 func (cw *ChatbotWeb) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -438,54 +619,408 @@ func (cw *ChatbotWeb) handleCreateSession(w http.ResponseWriter, r *http.Request
 	if req.Topic == "" || req.Level == "" {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Success: false,
-			Message: "Topic and level are required",
+			Message: "Topic and level are required",
+		})
+		return
+	}
+
+	level := models.ConversationLevel(req.Level)
+	if !models.IsValidConversationLevel(string(level)) {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Invalid level",
+		})
+		return
+	}
+
+	userLanguage := req.Language
+	if userLanguage == "" {
+		userLanguage = "Vietnamese"
+	}
+
+	if req.SessionID != "" {
+		if err := services.ValidateSessionID(req.SessionID); err != nil {
+			json.NewEncoder(w).Encode(ChatResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	cw.mu.Lock()
+	var sessionID string
+	if req.SessionID != "" {
+		sessionID = req.SessionID
+		// If session exists, remove it to create a new one
+		delete(cw.conversationSessions, sessionID)
+	} else {
+		sessionID = fmt.Sprintf("web_%d", utils.GetCurrentTimestamp())
+	}
+
+	manager := managers.NewConversationManager(cw.apiKey, level, req.Topic, userLanguage, sessionID)
+	cw.conversationSessions[sessionID] = manager
+	cw.mu.Unlock()
+
+	conversationJob := models.JobRequest{
+		Task: "conversation",
+		Type: models.TaskTypeConversation,
+	}
+	response := manager.ProcessJob(r.Context(), conversationJob)
+	manager.Persist()
+
+	conversationAgent := manager.GetConversationAgent()
+	stats := manager.GetHistoryManager().GetConversationStats()
+
+	json.NewEncoder(w).Encode(ChatResponse{
+		Success:   response.Success,
+		Message:   response.Result,
+		Stats:     stats,
+		Level:     string(conversationAgent.GetLevel()),
+		Topic:     cases.Title(language.English).String(conversationAgent.Topic),
+		TopicID:   conversationAgent.Topic,
+		SessionID: sessionID,
+	})
+}
+
+// session returns the live session for sessionID, rebuilding it from the session store
+// when it is not in memory, e.g. after a restart.
+func (cw *ChatbotWeb) session(sessionID string) (*managers.ConversationManager, bool) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if manager, exists := cw.conversationSessions[sessionID]; exists {
+		return manager, true
+	}
+
+	manager, err := managers.LoadConversationManager(cw.apiKey, sessionID)
+	if err != nil {
+		if !errors.Is(err, services.ErrSessionNotFound) {
+			utils.PrintError(fmt.Sprintf("Failed to restore session %s: %v", sessionID, err))
+		}
+		return nil, false
+	}
+	cw.conversationSessions[sessionID] = manager
+	return manager, true
+}
+
+// beginStream marks a reply as streaming for sessionID, and reports false if one already is.
+// Two turns streamed at once would be built on the same history and both appended after it.
+func (cw *ChatbotWeb) beginStream(sessionID string) bool {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.streaming[sessionID] {
+		return false
+	}
+	cw.streaming[sessionID] = true
+	return true
+}
+
+func (cw *ChatbotWeb) endStream(sessionID string) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	delete(cw.streaming, sessionID)
+}
+
+// handleGetSession resumes a session, returning its settings and the conversation so far.
+func (cw *ChatbotWeb) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	sessionID := r.URL.Query().Get("session_id")
+	manager, exists := cw.session(sessionID)
+	if !exists {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Invalid session ID",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessionResponse(manager))
+}
+
+// sessionResponse describes a session for the client to open: its settings and the conversation so far.
+func sessionResponse(manager *managers.ConversationManager) ChatResponse {
+	conversationAgent := manager.GetConversationAgent()
+	return ChatResponse{
+		Success:   true,
+		Stats:     manager.GetHistoryManager().GetConversationStats(),
+		Level:     string(conversationAgent.GetLevel()),
+		Topic:     cases.Title(language.English).String(conversationAgent.Topic),
+		TopicID:   conversationAgent.Topic,
+		History:   transcript(manager),
+		SessionID: manager.GetSessionId(),
+	}
+}
+
+// TranscriptAssessment is the outcome of assessing one uploaded transcript.
+type TranscriptAssessment struct {
+	File       string `json:"file"`
+	SessionID  string `json:"session_id,omitzero"` // Session ID recorded in the transcript
+	Success    bool   `json:"success"`
+	Assessment any    `json:"assessment,omitzero"`
+	Error      string `json:"error,omitzero"`
+}
+
+// handleImport loads history exports uploaded as "file" parts. With assess=true every file is
+// assessed and the results are returned; otherwise the single file becomes a new session to
+// continue, using the topic, level and language fields where the export does not record them.
+func (cw *ChatbotWeb) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 10*services.MaxImportSize)
+	if err := r.ParseMultipartForm(services.MaxImportSize); err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Invalid upload: " + err.Error(),
+		})
+		return
+	}
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "No file uploaded",
+		})
+		return
+	}
+
+	if r.FormValue("assess") == "true" {
+		var results []TranscriptAssessment
+		for _, file := range files {
+			results = append(results, cw.assessUpload(r.Context(), file))
+		}
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success:     true,
+			Assessments: results,
+		})
+		return
+	}
+
+	if len(files) > 1 {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Upload one transcript to continue, or set assess=true to assess several",
+		})
+		return
+	}
+
+	transcript, err := readUpload(files[0])
+	if err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	level := models.ConversationLevel(r.FormValue("level"))
+	if !models.IsValidConversationLevel(string(level)) {
+		level = models.ConversationLevelIntermediate
+	}
+	userLanguage := r.FormValue("language")
+	if userLanguage == "" {
+		userLanguage = "Vietnamese"
+	}
+	manager := managers.ImportConversationManager(cw.apiKey, transcript, managers.NewImportSessionID(),
+		r.FormValue("topic"), level, userLanguage)
+	manager.Persist()
+
+	cw.mu.Lock()
+	cw.conversationSessions[manager.GetSessionId()] = manager
+	cw.mu.Unlock()
+
+	json.NewEncoder(w).Encode(sessionResponse(manager))
+}
+
+// assessUpload runs the assessment agent over one uploaded transcript. No session is kept for it.
+func (cw *ChatbotWeb) assessUpload(ctx context.Context, file *multipart.FileHeader) TranscriptAssessment {
+	result := TranscriptAssessment{File: file.Filename}
+
+	transcript, err := readUpload(file)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.SessionID = transcript.SessionID
+
+	manager := managers.ImportConversationManager(cw.apiKey, transcript, managers.NewImportSessionID(), "", models.ConversationLevelIntermediate, "Vietnamese")
+	response := manager.Assess(ctx)
+	if !response.Success {
+		result.Error = response.Error
+		return result
+	}
+
+	result.Success = true
+	var assessment map[string]any
+	if err := json.Unmarshal([]byte(response.Result), &assessment); err == nil {
+		result.Assessment = assessment
+	} else {
+		result.Assessment = response.Result
+	}
+	return result
+}
+
+func readUpload(file *multipart.FileHeader) (*services.ImportedTranscript, error) {
+	if file.Size > services.MaxImportSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", services.ErrInvalidTranscript, file.Filename, services.MaxImportSize)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Filename, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Filename, err)
+	}
+	return services.ParseHistoryExport(data)
+}
+
+// transcript returns the current branch of the conversation as chat messages.
+func transcript(manager *managers.ConversationManager) []ChatMessage {
+	var history []ChatMessage
+	for _, turn := range manager.GetHistoryManager().Turns() {
+		for _, msg := range turn.Messages() {
+			history = append(history, ChatMessage{Role: msg.Role.String(), Content: msg.Content, Turn: turn.Index})
+		}
+	}
+	return history
+}
+
+// handleExport downloads a session's transcript as markdown, html, csv or jsonl (format query
+// parameter, markdown by default).
+func (cw *ChatbotWeb) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manager, exists := cw.session(r.URL.Query().Get("session_id"))
+	if !exists {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.ExportFormatMarkdown
+	}
+	formatter, err := services.TranscriptFormatterFor(format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, filename, err := services.ExportTranscript(manager.Transcript(), formatter.Name())
+	if err != nil {
+		utils.PrintError(err.Error())
+		http.Error(w, "Failed to export transcript", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatter.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
+
+// BranchRequest is the body of the undo and regenerate endpoints.
+type BranchRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// branchSession decodes a BranchRequest and finds its session, answering the request itself
+// when either fails.
+func (cw *ChatbotWeb) branchSession(w http.ResponseWriter, r *http.Request) (*managers.ConversationManager, bool) {
+	var req BranchRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Invalid request",
+		})
+		return nil, false
+	}
+
+	manager, exists := cw.session(req.SessionID)
+	if !exists {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: "Invalid session ID",
 		})
+		return nil, false
+	}
+	return manager, true
+}
+
+// handleUndo drops the learner's last message and its reply.
+func (cw *ChatbotWeb) handleUndo(w http.ResponseWriter, r *http.Request) {
+	manager, ok := cw.branchSession(w, r)
+	if !ok {
 		return
 	}
 
-	level := models.ConversationLevel(req.Level)
-	if !models.IsValidConversationLevel(string(level)) {
+	turn, ok := manager.GetHistoryManager().Undo()
+	if !ok {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Success: false,
-			Message: "Invalid level",
+			Message: "Nothing to undo yet",
 		})
 		return
 	}
+	manager.Persist()
 
-	userLanguage := req.Language
-	if userLanguage == "" {
-		userLanguage = "Vietnamese"
-	}
+	json.NewEncoder(w).Encode(ChatResponse{
+		Success: true,
+		Message: turn.User,
+		History: transcript(manager),
+		Stats:   manager.GetHistoryManager().GetConversationStats(),
+	})
+}
 
-	cw.mu.Lock()
-	var sessionID string
-	if req.SessionID != "" {
-		sessionID = req.SessionID
-		// If session exists, remove it to create a new one
-		delete(cw.conversationSessions, sessionID)
-	} else {
-		sessionID = fmt.Sprintf("web_%d", utils.GetCurrentTimestamp())
+// handleRegenerate asks for a different reply to the learner's last message.
+func (cw *ChatbotWeb) handleRegenerate(w http.ResponseWriter, r *http.Request) {
+	manager, ok := cw.branchSession(w, r)
+	if !ok {
+		return
 	}
 
-	manager := managers.NewConversationManager(cw.apiKey, level, req.Topic, userLanguage, sessionID)
-	cw.conversationSessions[sessionID] = manager
-	cw.mu.Unlock()
-
-	conversationJob := models.JobRequest{
-		Task: "conversation",
+	response := manager.Regenerate(r.Context())
+	if !response.Success {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Success: false,
+			Message: response.Error,
+		})
+		return
 	}
-	response := manager.ProcessJob(conversationJob)
-
-	conversationAgent := manager.GetConversationAgent()
-	stats := manager.GetHistoryManager().GetConversationStats()
+	manager.Persist()
 
 	json.NewEncoder(w).Encode(ChatResponse{
-		Success:   response.Success,
-		Message:   response.Result,
-		Stats:     stats,
-		Level:     string(conversationAgent.GetLevel()),
-		Topic:     cases.Title(language.English).String(conversationAgent.Topic),
-		SessionID: sessionID,
+		Success: true,
+		Message: response.Result,
+		History: transcript(manager),
+		Stats:   manager.GetHistoryManager().GetConversationStats(),
 	})
 }
 
@@ -918,10 +1453,7 @@ func (cw *ChatbotWeb) handleGetSuggestions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	cw.mu.Lock()
-	defer cw.mu.Unlock()
-
-	manager, exists := cw.conversationSessions[req.SessionID]
+	manager, exists := cw.session(req.SessionID)
 	if !exists {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Success: false,
@@ -944,7 +1476,7 @@ func (cw *ChatbotWeb) handleGetSuggestions(w http.ResponseWriter, r *http.Reques
 		LastAIMessage: req.Message,
 	}
 
-	suggestionResponse := suggestionAgent.ProcessTask(suggestionJob)
+	suggestionResponse := suggestionAgent.ProcessTask(r.Context(), suggestionJob)
 	if !suggestionResponse.Success {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Success: false,
@@ -962,12 +1494,54 @@ func (cw *ChatbotWeb) handleGetSuggestions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Hints for the latest reply are kept on its turn, as the CLI does for every reply
+	historyManager := manager.GetHistoryManager()
+	if turn, ok := historyManager.LastTurn(); ok && turn.Reply == req.Message {
+		var suggestion models.SuggestionResponse
+		if err := json.Unmarshal([]byte(suggestionResponse.Result), &suggestion); err == nil {
+			historyManager.SetSuggestion(turn.Index, &suggestion)
+			manager.Persist()
+		}
+	}
+
 	json.NewEncoder(w).Encode(ChatResponse{
 		Success:     true,
 		Suggestions: suggestionsMap,
 	})
 }
 
+// handleGetUsage returns token and cost totals for one session, or for all sessions when session_id is omitted.
+// The all-sessions view also lists each OpenRouter key's calls, spend and bench state.
+func (cw *ChatbotWeb) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID != "" && sessionID != managers.PersonalizeSessionID {
+		if _, exists := cw.session(sessionID); !exists {
+			json.NewEncoder(w).Encode(ChatResponse{
+				Success: false,
+				Message: "Invalid session ID",
+			})
+			return
+		}
+	}
+
+	response := ChatResponse{
+		Success:   true,
+		Stats:     services.GetUsageLedger().Summary(sessionID),
+		SessionID: sessionID,
+	}
+	if sessionID == "" && client.Backend() == client.BackendOpenRouter {
+		response.Keys = client.SharedKeyPool(cw.apiKey).Stats()
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
 func (cw *ChatbotWeb) handleGetLessons(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -1527,10 +2101,10 @@ func (cw *ChatbotWeb) handleGetAssessmentStream(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	cw.mu.Lock()
-	defer cw.mu.Unlock()
+	ctx, cancel := context.WithTimeout(r.Context(), streamRequestTimeout)
+	defer cancel()
 
-	manager, exists := cw.conversationSessions[sessionID]
+	manager, exists := cw.session(sessionID)
 	if !exists {
 		http.Error(w, "Invalid session ID", http.StatusBadRequest)
 		return
@@ -1555,22 +2129,21 @@ func (cw *ChatbotWeb) handleGetAssessmentStream(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Create progress channel
-	progressChan := make(chan models.AssessmentStreamResponse, 100)
-
-	// Start streaming assessment
-	go func() {
-		if aa, ok := assessmentAgent.(*agents.AssessmentAgent); ok {
-			aa.GenerateAssessmentStream(historyManager, progressChan)
-		} else {
-			progressChan <- models.AssessmentStreamResponse{
-				Error: "Assessment agent type assertion failed",
-			}
+	aa, ok := assessmentAgent.(*agents.AssessmentAgent)
+	if !ok {
+		errorData := map[string]any{
+			"done":  true,
+			"type":  "error",
+			"error": "Assessment agent type assertion failed",
 		}
-	}()
+		errorJSON, _ := json.Marshal(errorData)
+		fmt.Fprintf(w, "data: %s\n\n", errorJSON)
+		flusher.Flush()
+		return
+	}
 
 	// Handle progress events
-	for response := range progressChan {
+	for response := range aa.GenerateAssessmentStream(ctx, historyManager) {
 		if response.Error != "" {
 			errorData := map[string]any{
 				"done":  true,
@@ -1583,6 +2156,17 @@ func (cw *ChatbotWeb) handleGetAssessmentStream(w http.ResponseWriter, r *http.R
 			return
 		}
 
+		if response.Partial != nil {
+			partialData := map[string]any{
+				"done": false,
+				"type": "partial",
+				"data": response.Partial,
+			}
+			partialJSON, _ := json.Marshal(partialData)
+			fmt.Fprintf(w, "data: %s\n\n", partialJSON)
+			flusher.Flush()
+		}
+
 		if response.ProgressEvent != nil {
 			event := response.ProgressEvent
 			progressData := map[string]any{
@@ -1977,6 +2561,16 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             font-size: 12px;
         }
 
+        .stream-status-notice {
+            margin-top: 8px;
+            padding: 8px 12px;
+            background: #fff8e1;
+            border: 1px solid #ffe082;
+            border-radius: 8px;
+            color: #8d6e00;
+            font-size: 13px;
+        }
+
         .message-evaluation {
             max-width: 70%;
             margin-top: 12px;
@@ -2159,6 +2753,34 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             opacity: 0.5;
             cursor: not-allowed;
         }
+
+        .btn-branch {
+            padding: 12px 16px;
+            background: #607D8B;
+            color: white;
+            border: none;
+            border-radius: 10px;
+            cursor: pointer;
+            font-weight: 600;
+            font-size: 14px;
+        }
+
+        .btn-branch:hover:not(:disabled) {
+            background: #546E7A;
+            transform: translateY(-1px);
+        }
+
+        .btn-branch:disabled {
+            opacity: 0.5;
+            cursor: not-allowed;
+        }
+
+        .export-select {
+            padding: 10px 8px;
+            border: 1px solid #ddd;
+            border-radius: 10px;
+            font-size: 14px;
+        }
         
         .btn-assessment {
             padding: 12px 24px;
@@ -2674,7 +3296,18 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             <div class="chat-input-container">
                 <div class="chat-input-wrapper">
                     <textarea id="chatInput" class="chat-input" placeholder="Type your message..." rows="1"></textarea>
+                    <button id="undoBtn" class="btn-branch" title="Remove your last message and its reply" disabled>↩️ Undo</button>
+                    <button id="retryBtn" class="btn-branch" title="Get a different reply to your last message" disabled>🔁 Retry</button>
                     <button id="hintBtn" class="btn-hint" disabled>💡 Hint</button>
+                    <select id="exportFormat" class="export-select" title="Transcript format">
+                        <option value="markdown">Markdown</option>
+                        <option value="html">HTML</option>
+                        <option value="csv">CSV</option>
+                        <option value="jsonl">JSONL</option>
+                    </select>
+                    <button id="exportBtn" class="btn-branch" title="Download the transcript" disabled>⬇️ Export</button>
+                    <button id="importBtn" class="btn-branch" title="Continue a history export, or assess several at once">📂 Import</button>
+                    <input id="importFile" type="file" accept=".json,application/json" multiple hidden />
                     <button id="assessmentBtn" class="btn-assessment" disabled>📊 End Conversation</button>
                     <button id="sendBtn" class="btn-send" disabled>Send</button>
                 </div>
@@ -2887,12 +3520,191 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
         let editingLessonIndex = -1;
 
         async function init() {
-            await loadTopics();
-            await loadPrompts();
             document.querySelector('[data-level="intermediate"]').classList.add('selected');
+            await loadTopics(false);
+            if (!(await resumeSession())) {
+                await createSession();
+            }
+            await loadPrompts();
+        }
+
+        // resumeSession reopens the session saved in this browser, if the server still has it
+        async function resumeSession() {
+            const savedSessionID = localStorage.getItem('sessionId');
+            if (!savedSessionID) return false;
+
+            try {
+                const response = await fetch('/api/session?session_id=' + encodeURIComponent(savedSessionID));
+                const data = await response.json();
+
+                if (!data.success) {
+                    localStorage.removeItem('sessionId');
+                    return false;
+                }
+
+                openSession(data);
+                return true;
+            } catch (error) {
+                console.error('Error resuming session:', error);
+                return false;
+            }
+        }
+
+        // openSession shows a session loaded from the server with its topic, level and history
+        function openSession(data) {
+            currentTopic = data.topic_id;
+            currentLevel = data.level;
+            document.getElementById('topicSelect').value = currentTopic;
+            document.querySelectorAll('.level-option').forEach(o => {
+                o.classList.toggle('selected', o.getAttribute('data-level') === currentLevel);
+            });
+            activateSession(data);
+            renderHistory(data.history);
+        }
+
+        // importFiles continues a single history export as a new session; several are assessed
+        // together and the results downloaded as one JSON file
+        async function importFiles(files) {
+            if (!files.length || isSending) return;
+
+            const assess = files.length > 1;
+            const form = new FormData();
+            Array.from(files).forEach(file => form.append('file', file));
+            form.append('assess', assess ? 'true' : 'false');
+            form.append('topic', currentTopic);
+            form.append('level', currentLevel);
+
+            isSending = true;
+            const importBtn = document.getElementById('importBtn');
+            importBtn.disabled = true;
+            if (assess) showNotification('Assessing ' + files.length + ' transcripts...');
+            try {
+                const response = await fetch('/api/import', {method: 'POST', body: form});
+                const data = await response.json();
+                if (!data.success) {
+                    showNotification(data.message, true);
+                    return;
+                }
+                if (!assess) {
+                    openSession(data);
+                    showNotification('Transcript imported');
+                    return;
+                }
+
+                const failed = data.assessments.filter(a => !a.success).length;
+                const blob = new Blob([JSON.stringify(data.assessments, null, 2)], {type: 'application/json'});
+                const link = document.createElement('a');
+                link.href = URL.createObjectURL(blob);
+                link.download = 'assessments.json';
+                link.click();
+                URL.revokeObjectURL(link.href);
+                showNotification('Assessed ' + (data.assessments.length - failed) + ' of ' + data.assessments.length + ' transcripts', failed > 0);
+            } catch (error) {
+                console.error('Error importing transcripts:', error);
+                showNotification('Failed to import transcripts', true);
+            } finally {
+                importBtn.disabled = false;
+                isSending = false;
+            }
+        }
+
+        function activateSession(data) {
+            sessionActive = true;
+            currentSessionID = data.session_id;
+            localStorage.setItem('sessionId', currentSessionID);
+            document.getElementById('chatTitle').textContent = data.topic + ' - ' + capitalizeLevel(data.level);
+            document.getElementById('chatInfo').textContent = 'Level: ' + capitalizeLevel(data.level);
+            document.getElementById('sendBtn').disabled = false;
+            document.getElementById('hintBtn').disabled = false;
+            document.getElementById('assessmentBtn').disabled = false;
+            document.getElementById('undoBtn').disabled = false;
+            document.getElementById('retryBtn').disabled = false;
+            document.getElementById('exportBtn').disabled = false;
+            document.getElementById('chatMessages').innerHTML = '';
+        }
+
+        function renderHistory(history) {
+            document.getElementById('chatMessages').innerHTML = '';
+            (history || []).forEach(msg => addMessage(msg.role, msg.content, null, msg.turn));
+        }
+
+        // reloadHistory redraws the conversation as the server has it, after a change the server did not keep
+        async function reloadHistory() {
+            try {
+                const response = await fetch('/api/session?session_id=' + encodeURIComponent(currentSessionID));
+                const data = await response.json();
+                if (data.success) {
+                    renderHistory(data.history);
+                }
+            } catch (error) {
+                console.error('Error reloading history:', error);
+            }
+        }
+
+        // postBranch calls the undo or regenerate endpoint and redraws the conversation
+        async function postBranch(endpoint, body) {
+            const response = await fetch(endpoint, {
+                method: 'POST',
+                headers: {'Content-Type': 'application/json'},
+                body: JSON.stringify(Object.assign({session_id: currentSessionID}, body))
+            });
+            const data = await response.json();
+            if (data.success) {
+                renderHistory(data.history);
+            } else {
+                showNotification(data.message, true);
+            }
+            return data;
+        }
+
+        async function undoLast() {
+            if (!sessionActive || isSending) return;
+            try {
+                await postBranch('/api/undo', {});
+            } catch (error) {
+                console.error('Error undoing message:', error);
+            }
+        }
+
+        async function retryLast() {
+            if (!sessionActive || isSending) return;
+            isSending = true;
+            const retryBtn = document.getElementById('retryBtn');
+            retryBtn.disabled = true;
+            const typingIndicator = addTypingIndicator();
+            try {
+                await postBranch('/api/regenerate', {});
+            } catch (error) {
+                console.error('Error regenerating reply:', error);
+            } finally {
+                removeTypingIndicator(typingIndicator);
+                retryBtn.disabled = false;
+                isSending = false;
+            }
+        }
+
+        // editMessage rewrites one of the learner's messages. The edited message is sent in place of the
+        // original, by its turn index, and the conversation continues from it on a new branch.
+        async function editMessage(messageDiv) {
+            if (!sessionActive || isSending) return;
+            // A message is editable once the server has recorded its turn
+            if (messageDiv.dataset.turn === undefined) return;
+
+            const turn = Number(messageDiv.dataset.turn);
+            const current = messageDiv.querySelector('.message-content').textContent;
+            const edited = prompt('Edit your message:', current);
+            if (edited === null || !edited.trim() || edited.trim() === current) return;
+
+            // The original message and everything after it give way to the new branch
+            while (messageDiv.nextSibling) {
+                messageDiv.nextSibling.remove();
+            }
+            messageDiv.remove();
+            document.getElementById('chatInput').value = edited.trim();
+            await sendMessage(turn);
         }
 
-        async function loadTopics() {
+        async function loadTopics(startSession = true) {
             try {
                 const response = await fetch('/api/topics');
                 const data = await response.json();
@@ -2908,7 +3720,9 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                     });
                     currentTopic = data.topics[0];
                     select.value = currentTopic;
-                    await createSession();
+                    if (startSession) {
+                        await createSession();
+                    }
                 }
             } catch (error) {
                 console.error('Error loading topics:', error);
@@ -3021,6 +3835,45 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // streamPersonalize generates a lesson, showing its fields as they stream in, and resolves
+        // with {success, content} or {success: false, message} like /api/personalize
+        function streamPersonalize(topic, level, language, resultDiv) {
+            return new Promise((resolve, reject) => {
+                const params = new URLSearchParams({ topic, level, language });
+                const eventSource = new EventSource('/api/personalize/stream?' + params.toString());
+                const partialLesson = {};
+                let finished = false;
+
+                eventSource.onmessage = (event) => {
+                    const data = JSON.parse(event.data);
+                    if (data.type === 'partial') {
+                        const field = data.data.field;
+                        if (data.data.index >= 0) {
+                            partialLesson[field] = partialLesson[field] || [];
+                            partialLesson[field][data.data.index] = data.data.value;
+                        } else {
+                            partialLesson[field] = data.data.value;
+                        }
+                        resultDiv.innerHTML = '<pre style="background: #1e1e1e; color: #d4d4d4; padding: 15px; border-radius: 8px; border: 1px solid #333; font-family: \'Courier New\', monospace; font-size: 13px; line-height: 1.5; overflow-x: auto; white-space: pre-wrap; word-wrap: break-word;">' +
+                            formatJSON(partialLesson) + '</pre>';
+                    } else if (data.done) {
+                        finished = true;
+                        eventSource.close();
+                        if (data.type === 'error') {
+                            resolve({ success: false, message: data.error });
+                        } else {
+                            resolve({ success: true, content: data.content });
+                        }
+                    }
+                };
+
+                eventSource.onerror = () => {
+                    eventSource.close();
+                    if (!finished) reject(new Error('connection lost'));
+                };
+            });
+        }
+
         async function submitPersonalize() {
             const topic = document.getElementById('personalizeTopic').value.trim();
             const level = document.getElementById('personalizeLevel').value;
@@ -3042,12 +3895,7 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                 errorDiv.textContent = '';
                 resultDiv.textContent = '';
                 if (generateBtn) { generateBtn.disabled = true; generateBtn.textContent = '⏳ Generating...'; }
-                const response = await fetch('/api/personalize', {
-                    method: 'POST',
-                    headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ topic, level, language })
-                });
-                const data = await response.json();
+                const data = await streamPersonalize(topic, level, language, resultDiv);
                 if (data.success) {
                     // Pretty-print JSON result (handle optional code fences)
                     let raw = (data.content || '').trim();
@@ -3249,15 +4097,7 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                 const data = await response.json();
                 
                 if (data.success) {
-                    sessionActive = true;
-                    currentSessionID = data.session_id;
-                    document.getElementById('chatTitle').textContent = data.topic + ' - ' + capitalizeLevel(data.level);
-                    document.getElementById('chatInfo').textContent = 'Level: ' + capitalizeLevel(data.level);
-                    document.getElementById('sendBtn').disabled = false;
-                    document.getElementById('hintBtn').disabled = false;
-                    document.getElementById('assessmentBtn').disabled = false;
-                    
-                    document.getElementById('chatMessages').innerHTML = '';
+                    activateSession(data);
                     addMessage('assistant', data.message, null);
                 }
             } catch (error) {
@@ -3280,6 +4120,29 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
         document.getElementById('hintBtn').addEventListener('click', () => {
             showHint();
         });
+
+        document.getElementById('undoBtn').addEventListener('click', () => {
+            undoLast();
+        });
+
+        document.getElementById('retryBtn').addEventListener('click', () => {
+            retryLast();
+        });
+
+        document.getElementById('exportBtn').addEventListener('click', () => {
+            if (!sessionActive) return;
+            const format = document.getElementById('exportFormat').value;
+            window.location.href = '/api/export?session_id=' + encodeURIComponent(currentSessionID) + '&format=' + encodeURIComponent(format);
+        });
+
+        document.getElementById('importBtn').addEventListener('click', () => {
+            document.getElementById('importFile').click();
+        });
+
+        document.getElementById('importFile').addEventListener('change', async (e) => {
+            await importFiles(e.target.files);
+            e.target.value = '';
+        });
         
         document.getElementById('assessmentBtn').addEventListener('click', () => {
             showAssessment();
@@ -3292,7 +4155,37 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             }
         });
 
-        async function sendMessage() {
+        // showEvaluation renders an evaluation, complete or partial, under the learner's message
+        function showEvaluation(userMessageDiv, evaluationDiv, evaluation) {
+            if (!userMessageDiv) {
+                console.error('userMessageDiv not found!');
+                return evaluationDiv;
+            }
+            if (!evaluationDiv) {
+                evaluationDiv = document.createElement('div');
+                evaluationDiv.className = 'message-evaluation';
+                userMessageDiv.appendChild(evaluationDiv);
+            }
+
+            const statusEmoji = {
+                'excellent': '✨',
+                'good': '👍',
+                'needs_improvement': '📚'
+            };
+            const status = evaluation.status || '';
+            const emoji = statusEmoji[status] || '✍️';
+            const statusText = status ? status.split('_').map(w => w.charAt(0).toUpperCase() + w.slice(1)).join(' ') : 'Evaluating...';
+            evaluationDiv.innerHTML = '<div class="evaluation-header">' + emoji + ' ' + statusText + '</div><div class="evaluation-content">' +
+                    (evaluation.short_description ? '<div style="margin-bottom: 8px;"><b>' + evaluation.short_description + '</b></div>' : '') +
+                    (evaluation.long_description || '') +
+                    (evaluation.correct ? '<div style="margin-top: 8px; color: #2e7d32;"><b>✅ Correct:</b> ' + evaluation.correct + '</div>' : '') +
+                '</div>';
+            scrollToBottom();
+            return evaluationDiv;
+        }
+
+        // sendMessage streams the reply to the message in the input; editTurn, if given, is the turn it replaces
+        async function sendMessage(editTurn) {
             const input = document.getElementById('chatInput');
             const message = input.value.trim();
             input.value = '';
@@ -3310,11 +4203,16 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             const typingIndicator = addTypingIndicator();
             
             try {
-                const eventSource = new EventSource('/api/stream?message=' + encodeURIComponent(message) + '&session_id=' + encodeURIComponent(currentSessionID));
+                const editing = Number.isInteger(editTurn);
+                const eventSource = new EventSource('/api/stream?message=' + encodeURIComponent(message) + '&session_id=' + encodeURIComponent(currentSessionID) +
+                    (editing ? '&edit=' + editTurn : ''));
                 let messageStarted = false;
+                let streamIncomplete = false;
                 let contentDiv, translationDiv;
                 
                 let userMessageDiv = null;
+                let evaluationDiv = null;
+                const partialEvaluation = {};
                 const messagesContainer = document.getElementById('chatMessages');
                 const userMessages = messagesContainer.querySelectorAll('.message.user');
                 if (userMessages.length > 0) {
@@ -3325,9 +4223,28 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                     const data = JSON.parse(event.data);
                     console.log('SSE Event received:', data.type, data);
                     
-                    if (data.done && data.type === 'message') {
+                    if (data.type === 'stream_status') {
+                        // The reply was cut off, filtered or failed; it is not saved to history
+                        streamIncomplete = true;
+                        if (!messageStarted) {
+                            removeTypingIndicator(typingIndicator);
+                            const result = addMessage('assistant', '', null);
+                            contentDiv = result.contentDiv;
+                            translationDiv = result.translationDiv;
+                            messageStarted = true;
+                        }
+                        const noticeDiv = document.createElement('div');
+                        noticeDiv.className = 'stream-status-notice';
+                        noticeDiv.textContent = '⚠️ ' + data.message + ' Please send your message again.';
+                        contentDiv.parentNode.appendChild(noticeDiv);
+                        scrollToBottom();
+                    } else if (data.done && data.type === 'message') {
+                        // The recorded turn's index makes the message editable
+                        if (userMessageDiv && data.turn >= 0) {
+                            userMessageDiv.dataset.turn = data.turn;
+                        }
                         // Message streaming is complete, trigger translation and Google Translate
-                        if (translationDiv && contentDiv && contentDiv.textContent) {
+                        if (!streamIncomplete && translationDiv && contentDiv && contentDiv.textContent) {
                             translateMessage(contentDiv.textContent, translationDiv);
                             // Use Google Translate to read the English text
                             readWithGoogleTranslate(contentDiv.textContent);
@@ -3341,30 +4258,18 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                         sendBtn.textContent = 'Send';
                         isSending = false;
                         document.getElementById('chatInput').focus();
+                        if (editing && streamIncomplete) {
+                            // The server kept the conversation as it was before the edit
+                            showNotification('Your edit was not saved.', true);
+                            await reloadHistory();
+                        }
+                    } else if (data.type === 'partial') {
+                        // Show the evaluation field by field while it streams in
+                        partialEvaluation[data.data.field] = data.data.value;
+                        evaluationDiv = showEvaluation(userMessageDiv, evaluationDiv, partialEvaluation);
                     } else if (data.type === 'evaluation' && !data.done) {
                         console.log('Evaluation received:', data.data);
-                        console.log('User message div:', userMessageDiv);
-                        const evaluationDiv = document.createElement('div');
-                        evaluationDiv.className = 'message-evaluation';
-                        const statusEmoji = {
-                            'excellent': '✨',
-                            'good': '👍',
-                            'needs_improvement': '📚'
-                        };
-                        const emoji = statusEmoji[data.data.status] || '✍️';
-                        const statusText = data.data.status.split('_').map(w => w.charAt(0).toUpperCase() + w.slice(1)).join(' ');
-                        evaluationDiv.innerHTML = '<div class="evaluation-header">' + emoji + ' ' + statusText + '</div><div class="evaluation-content">' +
-                                '<div style="margin-bottom: 8px;"><b>' + data.data.short_description + '</b></div>' +
-                                data.data.long_description +
-                                (data.data.correct ? '<div style="margin-top: 8px; color: #2e7d32;"><b>✅ Correct:</b> ' + data.data.correct + '</div>' : '') +
-                            '</div>';
-                        if (userMessageDiv) {
-                            console.log('Appending evaluation to user message');
-                            userMessageDiv.appendChild(evaluationDiv);
-                        } else {
-                            console.error('userMessageDiv not found!');
-                        }
-                        scrollToBottom();
+                        evaluationDiv = showEvaluation(userMessageDiv, evaluationDiv, data.data);
                     } else if (data.content) {
                         if (!messageStarted) {
                             removeTypingIndicator(typingIndicator);
@@ -3384,6 +4289,9 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                     sendBtn.disabled = false;
                     sendBtn.textContent = 'Send';
                     isSending = false;
+                    if (editing) {
+                        reloadHistory();
+                    }
                 };
             } catch (error) {
                 console.error('Error sending message:', error);
@@ -3444,7 +4352,8 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             scrollToBottom();
         }
 
-        function addMessage(role, content, translation) {
+        // addMessage appends a message; turn is the index of its recorded turn, if known
+        function addMessage(role, content, translation, turn) {
             const messagesDiv = document.getElementById('chatMessages');
             const messageDiv = document.createElement('div');
             messageDiv.className = 'message ' + role;
@@ -3454,6 +4363,14 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             contentDiv.textContent = content;
             
             messageDiv.appendChild(contentDiv);
+
+            if (role === 'user') {
+                if (turn !== undefined) {
+                    messageDiv.dataset.turn = turn;
+                }
+                messageDiv.title = 'Double-click to edit';
+                messageDiv.addEventListener('dblclick', () => editMessage(messageDiv));
+            }
             
             // Add audio button below content for assistant messages
             if (role === 'assistant' && content) {
@@ -3608,6 +4525,8 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
 
             try {
                 const eventSource = new EventSource('/api/assessment?session_id=' + encodeURIComponent(currentSessionID));
+                const partialAssessment = {};
+                let progressHTML = '';
                 
                 eventSource.onmessage = (event) => {
                     const data = JSON.parse(event.data);
@@ -3627,6 +4546,18 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                         } else if (data.type === 'assessment') {
                             displayAssessment(data.assessment);
                         }
+                    } else if (data.type === 'partial') {
+                        // Show each field as soon as it has streamed in; list items arrive one by one
+                        const field = data.data.field;
+                        if (data.data.index >= 0) {
+                            partialAssessment[field] = partialAssessment[field] || [];
+                            partialAssessment[field][data.data.index] = data.data.value;
+                        } else {
+                            partialAssessment[field] = data.data.value;
+                        }
+                        displayAssessment(partialAssessment);
+                        document.getElementById('assessmentContent').insertAdjacentHTML('beforeend',
+                            '<div id="progressIndicator" style="margin-top: 20px; font-size: 14px; color: #666;">' + progressHTML + '</div>');
                     } else if (data.type === 'progress') {
                         // Update progress indicator
                         const progressDiv = document.getElementById('progressIndicator');
@@ -3641,7 +4572,8 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
                                 'completed': '✅'
                             };
                             const emojiIcon = emoji[data.data.type] || '⏳';
-                            progressDiv.innerHTML = emojiIcon + ' ' + escapeHtml(data.data.message) + ' (' + data.data.progress + '%)';
+                            progressHTML = emojiIcon + ' ' + escapeHtml(data.data.message) + ' (' + data.data.progress + '%)';
+                            progressDiv.innerHTML = progressHTML;
                         }
                     }
                 };
@@ -3673,7 +4605,7 @@ func (cw *ChatbotWeb) serveChatHTML(w http.ResponseWriter, r *http.Request) {
             
             console.log('Assessment object:', assessment);
             
-            let html = '<div class="assessment-level">Level: ' + escapeHtml(assessment.level) + '</div>';
+            let html = assessment.level ? '<div class="assessment-level">Level: ' + escapeHtml(assessment.level) + '</div>' : '';
             
             if (assessment.general_skills) {
                 html += '<div class="assessment-section">' +
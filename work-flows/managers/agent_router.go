@@ -0,0 +1,183 @@
+package managers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ai-agent/work-flows/models"
+)
+
+// Agent priorities. When two agents match a task equally well the higher priority wins.
+const (
+	PriorityDefault = 0
+	PriorityPrimary = 10
+)
+
+var (
+	ErrNoAgent        = errors.New("no suitable agent")
+	ErrAmbiguousRoute = errors.New("ambiguous agent routing")
+)
+
+type agentRoute struct {
+	agent    models.Agent
+	priority int
+}
+
+// AgentRouter picks the agent for a job. A job with a task type, set in Type or given as the
+// whole task text, goes to the agent that declares that type. Any other task is scored by how
+// many of its words appear in each agent's capabilities. Candidates are ranked by score, then
+// priority; a tie on both is an error rather than a choice left to registration order.
+type AgentRouter struct {
+	routes []agentRoute
+}
+
+func NewAgentRouter() *AgentRouter {
+	return &AgentRouter{}
+}
+
+// Register adds an agent, or replaces the one with the same name.
+func (r *AgentRouter) Register(agent models.Agent, priority int) {
+	route := agentRoute{agent: agent, priority: priority}
+	for i := range r.routes {
+		if r.routes[i].agent.Name() == agent.Name() {
+			r.routes[i] = route
+			return
+		}
+	}
+	r.routes = append(r.routes, route)
+}
+
+func (r *AgentRouter) Get(name string) (models.Agent, bool) {
+	for _, route := range r.routes {
+		if route.agent.Name() == name {
+			return route.agent, true
+		}
+	}
+	return nil, false
+}
+
+// Agents returns the registered agents in registration order.
+func (r *AgentRouter) Agents() []models.Agent {
+	agents := make([]models.Agent, len(r.routes))
+	for i, route := range r.routes {
+		agents[i] = route.agent
+	}
+	return agents
+}
+
+// RouteCandidate is an agent that matched a task.
+type RouteCandidate struct {
+	Agent    string
+	Priority int
+	Score    int
+	Matched  []string // Task type, or the task words found in the agent's capabilities
+}
+
+// RouteDecision records how a task was routed, for logging and debugging.
+type RouteDecision struct {
+	Task       string
+	Type       models.TaskType // Empty when the task was matched against capabilities
+	Agent      models.Agent    // nil when routing failed
+	Candidates []RouteCandidate
+}
+
+// Explain describes the decision on one line, e.g.
+// `task "evaluation" by capabilities: EvaluateAgent (score 1, priority 0, matched evaluation)`.
+func (d *RouteDecision) Explain() string {
+	var b strings.Builder
+	if d.Type != "" {
+		fmt.Fprintf(&b, "task %q by type %s: ", d.Task, d.Type)
+	} else {
+		fmt.Fprintf(&b, "task %q by capabilities: ", d.Task)
+	}
+	if len(d.Candidates) == 0 {
+		b.WriteString("no candidates")
+		return b.String()
+	}
+	for i, c := range d.Candidates {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s (score %d, priority %d, matched %s)", c.Agent, c.Score, c.Priority, strings.Join(c.Matched, " "))
+	}
+	return b.String()
+}
+
+// Route ranks the agents for job. The decision is returned with the error too, so a failed
+// route can be explained.
+func (r *AgentRouter) Route(job models.JobRequest) (*RouteDecision, error) {
+	decision := &RouteDecision{Task: job.Task, Type: job.Type}
+	if decision.Type == "" {
+		decision.Type, _ = models.ParseTaskType(strings.ToLower(strings.TrimSpace(job.Task)))
+	}
+
+	if decision.Type != "" {
+		for _, route := range r.routes {
+			if slices.Contains(route.agent.TaskTypes(), decision.Type) {
+				decision.Candidates = append(decision.Candidates, RouteCandidate{
+					Agent:    route.agent.Name(),
+					Priority: route.priority,
+					Score:    1,
+					Matched:  []string{string(decision.Type)},
+				})
+			}
+		}
+	} else {
+		words := taskWords(job.Task)
+		for _, route := range r.routes {
+			if matched := capabilityMatches(words, route.agent.Capabilities()); len(matched) > 0 {
+				decision.Candidates = append(decision.Candidates, RouteCandidate{
+					Agent:    route.agent.Name(),
+					Priority: route.priority,
+					Score:    len(matched),
+					Matched:  matched,
+				})
+			}
+		}
+	}
+
+	candidates := decision.Candidates
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Priority > candidates[j].Priority
+	})
+
+	if len(candidates) == 0 {
+		return decision, fmt.Errorf("%w for task: %s", ErrNoAgent, job.Task)
+	}
+	if len(candidates) > 1 && candidates[0].Score == candidates[1].Score && candidates[0].Priority == candidates[1].Priority {
+		return decision, fmt.Errorf("%w: %s and %s match task %q equally", ErrAmbiguousRoute, candidates[0].Agent, candidates[1].Agent, job.Task)
+	}
+
+	decision.Agent, _ = r.Get(candidates[0].Agent)
+	return decision, nil
+}
+
+// taskWords splits a task into distinct lower-case words.
+func taskWords(task string) []string {
+	words := strings.FieldsFunc(strings.ToLower(task), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// capabilityMatches returns the words that appear in a capability name such as "response_evaluation".
+func capabilityMatches(words []string, capabilities []string) []string {
+	var matched []string
+	for _, word := range words {
+		for _, capability := range capabilities {
+			if slices.Contains(strings.Split(strings.ToLower(capability), "_"), word) {
+				matched = append(matched, word)
+				break
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,121 @@
+package managers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ai-agent/work-flows/models"
+)
+
+type fakeAgent struct {
+	name         string
+	capabilities []string
+	taskTypes    []models.TaskType
+}
+
+func (a *fakeAgent) Name() string                 { return a.name }
+func (a *fakeAgent) GetDescription() string       { return a.name }
+func (a *fakeAgent) Capabilities() []string       { return a.capabilities }
+func (a *fakeAgent) TaskTypes() []models.TaskType { return a.taskTypes }
+func (a *fakeAgent) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
+	return &models.JobResponse{Success: true}
+}
+
+func TestAgentRouterRoute(t *testing.T) {
+	conversation := &fakeAgent{name: "Conversation", capabilities: []string{"conversation", "english_practice"}, taskTypes: []models.TaskType{models.TaskTypeConversation}}
+	evaluate := &fakeAgent{name: "Evaluate", capabilities: []string{"response_evaluation", "grammar_check"}, taskTypes: []models.TaskType{models.TaskTypeEvaluation}}
+	grammar := &fakeAgent{name: "Grammar", capabilities: []string{"grammar_check", "english_practice"}}
+	suggest := &fakeAgent{name: "Suggest", capabilities: []string{"reply_suggestion"}, taskTypes: []models.TaskType{models.TaskTypeSuggestion}}
+	suggestToo := &fakeAgent{name: "SuggestToo", capabilities: []string{"reply_suggestion"}, taskTypes: []models.TaskType{models.TaskTypeSuggestion}}
+
+	type route struct {
+		agent    models.Agent
+		priority int
+	}
+	tests := []struct {
+		name      string
+		routes    []route
+		job       models.JobRequest
+		wantAgent string
+		wantErr   error
+	}{
+		{
+			name:      "explicit task type",
+			routes:    []route{{conversation, PriorityPrimary}, {evaluate, PriorityDefault}},
+			job:       models.JobRequest{Task: "check this please", Type: models.TaskTypeEvaluation},
+			wantAgent: "Evaluate",
+		},
+		{
+			name:      "task text naming a type",
+			routes:    []route{{conversation, PriorityPrimary}, {evaluate, PriorityDefault}},
+			job:       models.JobRequest{Task: " Evaluate "},
+			wantAgent: "Evaluate",
+		},
+		{
+			name:      "most matching capability words win",
+			routes:    []route{{evaluate, PriorityDefault}, {grammar, PriorityDefault}},
+			job:       models.JobRequest{Task: "grammar check for english practice"},
+			wantAgent: "Grammar",
+		},
+		{
+			name:      "priority breaks a score tie",
+			routes:    []route{{grammar, PriorityDefault}, {conversation, PriorityPrimary}},
+			job:       models.JobRequest{Task: "english"},
+			wantAgent: "Conversation",
+		},
+		{
+			name:    "tie on score and priority is ambiguous",
+			routes:  []route{{evaluate, PriorityDefault}, {grammar, PriorityDefault}},
+			job:     models.JobRequest{Task: "grammar"},
+			wantErr: ErrAmbiguousRoute,
+		},
+		{
+			name:    "two agents declaring the same type are ambiguous",
+			routes:  []route{{suggest, PriorityDefault}, {suggestToo, PriorityDefault}},
+			job:     models.JobRequest{Type: models.TaskTypeSuggestion},
+			wantErr: ErrAmbiguousRoute,
+		},
+		{
+			name:      "re-registering replaces the priority",
+			routes:    []route{{suggest, PriorityDefault}, {suggestToo, PriorityDefault}, {suggestToo, PriorityPrimary}},
+			job:       models.JobRequest{Type: models.TaskTypeSuggestion},
+			wantAgent: "SuggestToo",
+		},
+		{
+			name:    "no agent for the type",
+			routes:  []route{{conversation, PriorityPrimary}},
+			job:     models.JobRequest{Type: models.TaskTypeAssessment},
+			wantErr: ErrNoAgent,
+		},
+		{
+			name:    "no matching words",
+			routes:  []route{{conversation, PriorityPrimary}, {evaluate, PriorityDefault}},
+			job:     models.JobRequest{Task: "translate this"},
+			wantErr: ErrNoAgent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewAgentRouter()
+			for _, r := range tt.routes {
+				router.Register(r.agent, r.priority)
+			}
+
+			decision, err := router.Route(tt.job)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v\n%s", err, tt.wantErr, decision.Explain())
+			}
+			if tt.wantErr != nil {
+				if decision.Agent != nil {
+					t.Errorf("got agent %s with error %v, want none", decision.Agent.Name(), err)
+				}
+				return
+			}
+			if decision.Agent == nil || decision.Agent.Name() != tt.wantAgent {
+				t.Errorf("got decision %s, want %s", decision.Explain(), tt.wantAgent)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package managers
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"ai-agent/utils"
 	"ai-agent/work-flows/agents"
@@ -15,26 +18,132 @@ import (
 
 type ConversationManager struct {
 	apiClient      client.Client
-	agents         map[string]models.Agent
+	router         *AgentRouter
 	currentJob     *models.JobRequest
 	sessionId      string
+	topic          string
+	language       string
+	createdAt      time.Time
 	historyManager *services.ConversationHistoryManager
+	store          services.SessionStore
+	persistMu      sync.Mutex
 }
 
 func NewConversationManager(apiKey string, level models.ConversationLevel, topic string, language string, sessionId string) *ConversationManager {
-	client := client.NewOpenRouterClient(apiKey)
+	apiClient := newClientChain(client.NewBackendClient(apiKey), sessionId)
 
 	manager := &ConversationManager{
-		apiClient:      client,
-		agents:         make(map[string]models.Agent),
+		apiClient:      apiClient,
+		router:         NewAgentRouter(),
 		sessionId:      sessionId,
+		topic:          topic,
+		language:       language,
+		createdAt:      time.Now(),
 		historyManager: services.NewConversationHistoryManager(),
+		store:          services.SharedSessionStore(),
 	}
 
 	manager.RegisterAgents(level, topic, language)
 	return manager
 }
 
+// RestoreConversationManager rebuilds a session saved in the session store, with its history,
+// evaluations, suggestions and running summary.
+func RestoreConversationManager(apiKey string, record *services.SessionRecord) *ConversationManager {
+	manager := NewConversationManager(apiKey, record.Level, record.Topic, record.Language, record.SessionID)
+	manager.historyManager.Restore(record.Turns, record.Head, record.Summary)
+	if !record.CreatedAt.IsZero() {
+		manager.createdAt = record.CreatedAt
+	}
+	utils.PrintSuccess(fmt.Sprintf("Resumed session %s with %d turns", record.SessionID, manager.historyManager.Len()))
+	return manager
+}
+
+// ImportConversationManager starts session sessionID from an imported transcript. Its topic,
+// level and language fall back to the given ones when the export does not record them.
+func ImportConversationManager(apiKey string, transcript *services.ImportedTranscript, sessionID string, topic string, level models.ConversationLevel, language string) *ConversationManager {
+	if transcript.Topic != "" {
+		topic = transcript.Topic
+	}
+	if transcript.Level != "" {
+		level = transcript.Level
+	}
+	if transcript.Language != "" {
+		language = transcript.Language
+	}
+
+	manager := NewConversationManager(apiKey, level, topic, language, sessionID)
+	if dropped := manager.historyManager.SetConversationHistory(transcript.History); dropped > 0 {
+		utils.PrintError(fmt.Sprintf("Dropped %d learner messages without a reply from the imported transcript", dropped))
+	}
+	utils.PrintSuccess(fmt.Sprintf("Imported %d messages into session %s", manager.historyManager.Len(), sessionID))
+	return manager
+}
+
+// NewImportSessionID returns a fresh session ID for an imported transcript.
+func NewImportSessionID() string {
+	return fmt.Sprintf("import_%d", time.Now().UnixNano())
+}
+
+// LoadConversationManager restores sessionID from the shared session store.
+func LoadConversationManager(apiKey string, sessionID string) (*ConversationManager, error) {
+	store := services.SharedSessionStore()
+	if store == nil {
+		return nil, fmt.Errorf("%w: session storage is disabled", services.ErrSessionNotFound)
+	}
+	record, err := store.Load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return RestoreConversationManager(apiKey, record), nil
+}
+
+// Record captures the session as it is now, for the session store.
+func (m *ConversationManager) Record() *services.SessionRecord {
+	turns, head, summary := m.historyManager.SummarizedTree()
+	return &services.SessionRecord{
+		SessionID: m.sessionId,
+		Topic:     m.topic,
+		Level:     m.GetConversationAgent().GetLevel(),
+		Language:  m.language,
+		CreatedAt: m.createdAt,
+		UpdatedAt: time.Now(),
+		Turns:     turns,
+		Head:      head,
+		Summary:   summary,
+	}
+}
+
+// Transcript returns the session's final branch, ready for export.
+func (m *ConversationManager) Transcript() *services.Transcript {
+	return services.NewTranscript(m.Record())
+}
+
+// Persist saves the session to the store, if one is configured. Failures are logged, since
+// the conversation itself can carry on without them.
+func (m *ConversationManager) Persist() {
+	if m.store == nil {
+		return
+	}
+
+	// Snapshot and write together, so an older snapshot never overwrites a newer one
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	if err := m.store.Save(m.Record()); err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to save session %s: %v", m.sessionId, err))
+	}
+}
+
+// newClientChain wraps a backend client in the middleware chain from LLM_MIDDLEWARE,
+// attributing calls and their usage to sessionID.
+func newClientChain(apiClient client.Client, sessionID string) client.Client {
+	config := client.ChainConfigFromEnv()
+	config.SessionID = sessionID
+	config.Recorder = services.GetUsageLedger()
+	return client.NewClientChain(apiClient, config)
+}
+
 func (m *ConversationManager) RegisterAgents(level models.ConversationLevel, topic string, language string) {
 	conversationAgent := agents.NewConversationAgent(m.apiClient, level, topic, m.historyManager)
 	// Get title from conversation agent
@@ -46,32 +155,42 @@ func (m *ConversationManager) RegisterAgents(level models.ConversationLevel, top
 	evaluateAgent := agents.NewEvaluateAgent(m.apiClient, level, title, language)
 	assessmentAgent := agents.NewAssessmentAgent(m.apiClient, language)
 
-	m.agents[conversationAgent.Name()] = conversationAgent
-	m.agents[suggestionAgent.Name()] = suggestionAgent
-	m.agents[evaluateAgent.Name()] = evaluateAgent
-	m.agents[assessmentAgent.Name()] = assessmentAgent
+	// The conversation agent is the one to talk to, so it wins tasks that match others equally.
+	m.router.Register(conversationAgent, PriorityPrimary)
+	m.router.Register(suggestionAgent, PriorityDefault)
+	m.router.Register(evaluateAgent, PriorityDefault)
+	m.router.Register(assessmentAgent, PriorityDefault)
 
 	utils.PrintSuccess("Agent Manager initialized with agents:")
-	for _, agent := range m.agents {
+	for _, agent := range m.router.Agents() {
 		cyan := color.New(color.FgCyan)
 		cyan.Printf("- %s: %s\n", agent.Name(), agent.GetDescription())
 	}
 }
 
 func (m *ConversationManager) SelectAgent(task models.JobRequest) (models.Agent, error) {
-	for _, agent := range m.agents {
-		if agent.CanHandle(task.Task) {
-			utils.PrintInfo(fmt.Sprintf("Selected agent: %s for task: %s", agent.Name(), task.Task))
-			return agent, nil
-		}
+	decision, err := m.router.Route(task)
+	if err != nil {
+		utils.PrintInfo(fmt.Sprintf("Routing: %s", decision.Explain()))
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("no suitable agent found for task: %s", task.Task)
+	utils.PrintInfo(fmt.Sprintf("Selected agent: %s for %s", decision.Agent.Name(), decision.Explain()))
+	return decision.Agent, nil
+}
+
+// ExplainRoute describes which agent would take task and why, without running it.
+func (m *ConversationManager) ExplainRoute(task models.JobRequest) string {
+	decision, err := m.router.Route(task)
+	if err != nil {
+		return fmt.Sprintf("%s (%v)", decision.Explain(), err)
+	}
+	return decision.Explain()
 }
 
 func (m *ConversationManager) ListAgents() {
 	utils.PrintInfo("Available Agents:")
-	for _, agent := range m.agents {
+	for _, agent := range m.router.Agents() {
 		cyan := color.New(color.FgCyan)
 		yellow := color.New(color.FgYellow)
 		cyan.Printf("• %s\n", agent.Name())
@@ -81,8 +200,7 @@ func (m *ConversationManager) ListAgents() {
 }
 
 func (m *ConversationManager) GetAgent(name string) (models.Agent, bool) {
-	agent, exists := m.agents[name]
-	return agent, exists
+	return m.router.Get(name)
 }
 
 func (m *ConversationManager) GetHistoryManager() *services.ConversationHistoryManager {
@@ -109,7 +227,19 @@ func (m *ConversationManager) GetSessionId() string {
 	return m.sessionId
 }
 
-func (m *ConversationManager) ProcessJob(job models.JobRequest) *models.JobResponse {
+func (m *ConversationManager) GetTopic() string {
+	return m.topic
+}
+
+func (m *ConversationManager) GetLanguage() string {
+	return m.language
+}
+
+func (m *ConversationManager) GetUsageSummary() services.UsageSummary {
+	return services.GetUsageLedger().Summary(m.sessionId)
+}
+
+func (m *ConversationManager) ProcessJob(ctx context.Context, job models.JobRequest) *models.JobResponse {
 	m.currentJob = &job
 
 	agent, err := m.SelectAgent(job)
@@ -129,5 +259,54 @@ func (m *ConversationManager) ProcessJob(job models.JobRequest) *models.JobRespo
 	}
 
 	utils.PrintInfo(fmt.Sprintf("Processing job with agent: %s", agent.Name()))
-	return agent.ProcessTask(job)
+	return agent.ProcessTask(ctx, job)
+}
+
+// Assess runs the assessment agent over the current branch of the conversation.
+func (m *ConversationManager) Assess(ctx context.Context) *models.JobResponse {
+	assessmentAgent := m.GetAssessmentAgent()
+	if assessmentAgent == nil {
+		return &models.JobResponse{
+			AgentName: "none",
+			Success:   false,
+			Error:     "Assessment agent not available",
+		}
+	}
+
+	return assessmentAgent.ProcessTask(ctx, models.JobRequest{
+		Task:     "assessment",
+		Type:     models.TaskTypeAssessment,
+		Metadata: m.historyManager,
+	})
+}
+
+// Regenerate asks the conversation agent again for the last reply. The new reply starts a branch
+// beside the old one, keeping the learner's message and its evaluation; if it fails, the old
+// reply stays current.
+func (m *ConversationManager) Regenerate(ctx context.Context) *models.JobResponse {
+	previous := m.historyManager.Head()
+	last, ok := m.historyManager.Rewind(previous)
+	if !ok {
+		return &models.JobResponse{
+			AgentName: "none",
+			Success:   false,
+			Error:     "There is no reply to regenerate yet",
+		}
+	}
+
+	response := m.ProcessJob(ctx, models.JobRequest{
+		Task:        "conversation",
+		Type:        models.TaskTypeConversation,
+		UserMessage: last.User,
+	})
+	if !response.Success || response.Turn == nil {
+		m.historyManager.Checkout(previous)
+		return response
+	}
+
+	if last.Evaluation != nil {
+		m.historyManager.SetEvaluation(response.Turn.Index, last.Evaluation)
+		response.Turn.Evaluation = last.Evaluation
+	}
+	return response
 }
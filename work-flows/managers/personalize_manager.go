@@ -5,20 +5,24 @@ import (
 	"ai-agent/work-flows/agents"
 	"ai-agent/work-flows/client"
 	"ai-agent/work-flows/models"
+	"context"
 	"fmt"
 )
 
+// PersonalizeSessionID attributes personalize calls in the usage ledger, as they have no conversation session.
+const PersonalizeSessionID = "personalize"
+
 type PersonalizeManager struct {
 	name   string
 	client client.Client
-	agents map[string]models.Agent
+	router *AgentRouter
 }
 
-func NewPersonalizeManager(client client.Client) *PersonalizeManager {
+func NewPersonalizeManager(apiClient client.Client) *PersonalizeManager {
 	manager := &PersonalizeManager{
 		name:   "PersonalizeManager",
-		client: client,
-		agents: make(map[string]models.Agent),
+		client: newClientChain(apiClient, PersonalizeSessionID),
+		router: NewAgentRouter(),
 	}
 
 	manager.RegisterAgents()
@@ -27,10 +31,10 @@ func NewPersonalizeManager(client client.Client) *PersonalizeManager {
 
 func (pm *PersonalizeManager) RegisterAgents() {
 	personalizeLessonAgent := agents.NewPersonalizeLessonAgent(pm.client)
-	pm.agents[personalizeLessonAgent.Name()] = personalizeLessonAgent
+	pm.router.Register(personalizeLessonAgent, PriorityDefault)
 
 	utils.PrintSuccess("PersonalizeManager initialized with agents:")
-	for _, agent := range pm.agents {
+	for _, agent := range pm.router.Agents() {
 		utils.PrintInfo(fmt.Sprintf("- %s: %s", agent.Name(), agent.GetDescription()))
 	}
 }
@@ -43,7 +47,7 @@ func (pm *PersonalizeManager) GetDescription() string {
 	return "Manages and coordinates personalize-related agents for lesson detail creation"
 }
 
-func (pm *PersonalizeManager) ProcessTask(task models.JobRequest) *models.JobResponse {
+func (pm *PersonalizeManager) ProcessTask(ctx context.Context, task models.JobRequest) *models.JobResponse {
 	utils.PrintInfo(fmt.Sprintf("PersonalizeManager processing task: %s", task.Task))
 
 	agent, err := pm.SelectAgent(task)
@@ -58,21 +62,20 @@ func (pm *PersonalizeManager) ProcessTask(task models.JobRequest) *models.JobRes
 	}
 
 	utils.PrintInfo(fmt.Sprintf("Delegating to agent: %s", agent.Name()))
-	return agent.ProcessTask(task)
+	return agent.ProcessTask(ctx, task)
 }
 
 func (pm *PersonalizeManager) SelectAgent(task models.JobRequest) (models.Agent, error) {
-	for _, agent := range pm.agents {
-		if agent.CanHandle(task.Task) {
-			utils.PrintInfo(fmt.Sprintf("Selected agent: %s for task: %s", agent.Name(), task.Task))
-			return agent, nil
-		}
+	decision, err := pm.router.Route(task)
+	if err != nil {
+		utils.PrintInfo(fmt.Sprintf("Routing: %s", decision.Explain()))
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("no suitable agent found for task: %s", task.Task)
+	utils.PrintInfo(fmt.Sprintf("Selected agent: %s for %s", decision.Agent.Name(), decision.Explain()))
+	return decision.Agent, nil
 }
 
 func (pm *PersonalizeManager) GetAgent(name string) (models.Agent, bool) {
-	agent, exists := pm.agents[name]
-	return agent, exists
+	return pm.router.Get(name)
 }
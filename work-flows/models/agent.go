@@ -1,9 +1,34 @@
 package models
 
+import "context"
+
+// TaskType names a kind of job explicitly, so a manager can route it without guessing from the task text.
+type TaskType string
+
+const (
+	TaskTypeConversation      TaskType = "conversation"
+	TaskTypeSuggestion        TaskType = "suggestion"
+	TaskTypeEvaluation        TaskType = "evaluate"
+	TaskTypeAssessment        TaskType = "assessment"
+	TaskTypePersonalizeLesson TaskType = "personalize_lesson"
+)
+
+// ParseTaskType returns the task type named by s, if any.
+func ParseTaskType(s string) (TaskType, bool) {
+	switch taskType := TaskType(s); taskType {
+	case TaskTypeConversation, TaskTypeSuggestion, TaskTypeEvaluation,
+		TaskTypeAssessment, TaskTypePersonalizeLesson:
+		return taskType, true
+	default:
+		return "", false
+	}
+}
+
 type Agent interface {
 	Name() string
 	GetDescription() string
 	Capabilities() []string
-	CanHandle(task string) bool
-	ProcessTask(task JobRequest) *JobResponse
+	// TaskTypes lists the task types the agent handles when a job names one.
+	TaskTypes() []TaskType
+	ProcessTask(ctx context.Context, task JobRequest) *JobResponse
 }
@@ -1,5 +1,12 @@
 package models
 
+import (
+	"encoding/json"
+	"strings"
+
+	"ai-agent/utils"
+)
+
 // Message roles
 
 type MessageRole string
@@ -8,6 +15,7 @@ const (
 	MessageRoleUser      MessageRole = "user"
 	MessageRoleAssistant MessageRole = "assistant"
 	MessageRoleSystem    MessageRole = "system"
+	MessageRoleTool      MessageRole = "tool" // Result of a tool call, sent back to the model
 )
 
 func (r MessageRole) String() string {
@@ -19,6 +27,12 @@ type VocabOption struct {
 	Emoji string `json:"emoji"` // Relevant emoji
 }
 
+// SavedVocab is a phrase suggested earlier in the session and whether the learner has used it since.
+type SavedVocab struct {
+	Text string `json:"text"`
+	Used bool   `json:"used"`
+}
+
 type SuggestionResponse struct {
 	LeadingSentence string        `json:"leading_sentence"`
 	VocabOptions    []VocabOption `json:"vocab_options"`
@@ -31,6 +45,8 @@ type EvaluationResponse struct {
 	Correct          string `json:"correct"`           // Corrected version in English
 }
 
+// Message is one message of the stored history with our own annotations, as flattened from
+// its Turn. It never goes to the provider as is; see ChatMessage.
 type Message struct {
 	Index      int                 `json:"index"`
 	Role       MessageRole         `json:"role"`
@@ -39,6 +55,127 @@ type Message struct {
 	Evaluation *EvaluationResponse `json:"evaluation,omitempty"` // Only for user messages
 }
 
+// Turn is one exchange of the conversation: the learner's message with its evaluation, then the
+// tutor's reply with the suggestions offered for answering it. The conversation starter is a turn
+// without a user message. Turns form a tree, as editing or regenerating starts a new branch
+// from an earlier turn.
+type Turn struct {
+	Index      int                 `json:"index"`
+	Parent     int                 `json:"parent"` // Turn this one follows, or -1 for the first turn
+	User       string              `json:"user,omitempty"`
+	Evaluation *EvaluationResponse `json:"evaluation,omitempty"`
+	Reply      string              `json:"reply"`
+	Suggestion *SuggestionResponse `json:"suggestion,omitempty"`
+}
+
+// UserMessageIndex and ReplyMessageIndex give a turn's messages stable indexes in the flat
+// message view of the history, so summaries can refer to a point in it.
+func (t Turn) UserMessageIndex() int  { return 2 * t.Index }
+func (t Turn) ReplyMessageIndex() int { return 2*t.Index + 1 }
+
+// Messages flattens the turn into its user message, if any, and its reply.
+func (t Turn) Messages() []Message {
+	var messages []Message
+	if t.User != "" {
+		messages = append(messages, Message{
+			Index:      t.UserMessageIndex(),
+			Role:       MessageRoleUser,
+			Content:    t.User,
+			Evaluation: t.Evaluation,
+		})
+	}
+	return append(messages, Message{
+		Index:      t.ReplyMessageIndex(),
+		Role:       MessageRoleAssistant,
+		Content:    t.Reply,
+		Suggestion: t.Suggestion,
+	})
+}
+
+// ConversationSummary is the running summary of the turns that no longer fit in the context
+// window: every message with an Index below UpTo has been folded into Text.
+type ConversationSummary struct {
+	Text string `json:"text"`
+	UpTo int    `json:"up_to"`
+}
+
+// ChatMessage is a message as sent to the LLM provider. When Parts is set it is sent as
+// the content instead of Content, for multi-part input such as images.
+type ChatMessage struct {
+	Role       MessageRole   `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"-"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // Tools the assistant asked to run
+	ToolCallID string        `json:"tool_call_id,omitempty"` // Only for tool messages
+}
+
+// ContentPart is one element of a multi-part message, in the OpenAI format.
+type ContentPart struct {
+	Type     string    `json:"type"` // text or image_url
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// Text returns the message's text, joining the text parts of a multi-part message.
+func (m ChatMessage) Text() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type wire ChatMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(wire(m))
+	}
+	return json.Marshal(struct {
+		wire
+		Content []ContentPart `json:"content"`
+	}{wire(m), m.Parts})
+}
+
+// Tool is a function definition offered to the model, in the OpenAI tools format.
+type Tool struct {
+	Type     string       `json:"type"` // Always "function"
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"` // JSON schema of the arguments
+}
+
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON-encoded arguments
+}
+
+// ToolCallDelta is a fragment of a streamed tool call; fragments with the same Index belong together.
+type ToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
 type ConversationLevel string
 
 const (
@@ -67,6 +204,7 @@ func IsValidConversationLevel(level string) bool {
 
 type JobRequest struct {
 	Task          string            `json:"task"`
+	Type          TaskType          `json:"type,omitempty"` // Routes the job directly; otherwise Task is matched against agent capabilities
 	UserMessage   string            `json:"user_message"`
 	LastAIMessage string            `json:"last_ai_message"`
 	Level         ConversationLevel `json:"level,omitempty"`
@@ -78,7 +216,10 @@ type JobResponse struct {
 	Success   bool   `json:"success"`
 	Result    string `json:"result"`
 	Error     string `json:"error,omitempty"`
+	Model     string `json:"model,omitempty"` // Model that answered, which may be a fallback
 	Metadata  any    `json:"metadata,omitempty"`
+	// Turn is the turn the job recorded in the history, if any
+	Turn *Turn `json:"turn,omitempty"`
 }
 
 type ResponseFormat struct {
@@ -92,59 +233,137 @@ type JSONSchemaSpec struct {
 	Schema map[string]any `json:"schema"`
 }
 
+// ProviderPreferences maps to OpenRouter's provider routing object.
+type ProviderPreferences struct {
+	Sort string `json:"sort,omitempty"` // price, throughput or latency
+}
+
 type ChatRequest struct {
-	Model     string   `json:"model"`
-	Models    []string `json:"models,omitempty"`
-	Providers struct {
-		Sort string `json:"sort"`
-	} `json:"providers"`
-	Usage struct {
-		Include bool `json:"include"`
-	} `json:"usage"`
-	Messages       []Message       `json:"messages"`
-	Temperature    float64         `json:"temperature"`
-	MaxTokens      int             `json:"max_tokens"`
-	Stream         bool            `json:"stream"`
-	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Model          string               `json:"model"`
+	Models         []string             `json:"models,omitempty"` // Primary model followed by fallbacks, in order
+	Providers      *ProviderPreferences `json:"provider,omitempty"`
+	Usage          *UsageOptions        `json:"usage,omitempty"` // OpenRouter usage accounting
+	Messages       []ChatMessage        `json:"messages"`
+	Temperature    float64              `json:"temperature"`
+	MaxTokens      int                  `json:"max_tokens"`
+	Stream         bool                 `json:"stream"`
+	StreamOptions  *StreamOptions       `json:"stream_options,omitempty"` // OpenAI-style usage in the final stream chunk
+	ResponseFormat *ResponseFormat      `json:"response_format,omitempty"`
+	Tools          []Tool               `json:"tools,omitempty"`
+	User           string               `json:"user,omitempty"` // Session tag, for the provider's abuse monitoring and logs
+}
+
+type UsageOptions struct {
+	Include bool `json:"include"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type ChatResponse struct {
-	Choices []struct {
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	Choices  []struct {
 		Message struct {
-			Content string `json:"content"`
+			Content   string     `json:"content"`
+			ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage TokenUsage `json:"usage,omitzero"`
+}
+
+type TokenUsage struct {
+	PromptTokens        int     `json:"prompt_tokens,omitzero"`
+	CompletionTokens    int     `json:"completion_tokens,omitzero"`
+	TotalTokens         int     `json:"total_tokens,omitzero"`
+	Cost                float64 `json:"cost,omitzero"` // Provider-reported cost in credits, when available
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens,omitzero"`
+		AudioTokens  int `json:"audio_tokens,omitzero"`
+	} `json:"prompt_tokens_details,omitzero"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens,omitzero"`
+	} `json:"completion_tokens_details,omitzero"`
+}
+
+// UsageRecord is one metered LLM call, attributed to a session and agent.
+type UsageRecord struct {
+	SessionID        string  `json:"session_id"`
+	Agent            string  `json:"agent"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	Cost             float64 `json:"cost"`
+	Timestamp        int64   `json:"timestamp"`
 }
 
 type StreamResponse struct {
-	ID       string `json:"id"`
-	Provider string `json:"provider,omitzero"`
-	Model    string `json:"model,omitzero"`
-	Object   string `json:"object,omitzero"`
-	Created  int64  `json:"created,omitzero"`
-	Error    string `json:"error,omitzero"`
-	Choices  []struct {
-		Index int `json:"index,omitzero"`
-		Delta struct {
-			Role    string `json:"role,omitzero"`
-			Content string `json:"content,omitzero"`
-		} `json:"delta,omitzero"`
-		FinishReason       *string `json:"finish_reason,omitzero"`
-		NativeFinishReason *string `json:"native_finish_reason,omitzero"`
-		Logprobs           *string `json:"logprobs,omitzero"`
-	} `json:"choices,omitzero"`
-	Usage struct {
-		PromptTokens        int `json:"prompt_tokens,omitzero"`
-		CompletionTokens    int `json:"completion_tokens,omitzero"`
-		TotalTokens         int `json:"total_tokens,omitzero"`
-		PromptTokensDetails struct {
-			CachedTokens int `json:"cached_tokens,omitzero"`
-			AudioTokens  int `json:"audio_tokens,omitzero"`
-		} `json:"prompt_tokens_details,omitzero"`
-		CompletionTokensDetails struct {
-			ReasoningTokens int `json:"reasoning_tokens,omitzero"`
-		} `json:"completion_tokens_details,omitzero"`
-	} `json:"usage,omitzero"`
+	ID       string         `json:"id"`
+	Provider string         `json:"provider,omitzero"`
+	Model    string         `json:"model,omitzero"`
+	Object   string         `json:"object,omitzero"`
+	Created  int64          `json:"created,omitzero"`
+	Choices  []StreamChoice `json:"choices,omitzero"`
+	Usage    TokenUsage     `json:"usage,omitzero"`
+}
+
+type StreamChoice struct {
+	Index              int         `json:"index,omitzero"`
+	Delta              StreamDelta `json:"delta,omitzero"`
+	FinishReason       *string     `json:"finish_reason,omitzero"`
+	NativeFinishReason *string     `json:"native_finish_reason,omitzero"`
+	Logprobs           *string     `json:"logprobs,omitzero"`
+}
+
+type StreamDelta struct {
+	Role      string          `json:"role,omitzero"`
+	Content   string          `json:"content,omitzero"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitzero"`
+}
+
+// StreamStatus says how a streamed reply ended.
+type StreamStatus string
+
+const (
+	StreamStatusComplete      StreamStatus = "complete"
+	StreamStatusTruncated     StreamStatus = "truncated"      // Hit max_tokens (finish_reason "length")
+	StreamStatusContentFilter StreamStatus = "content_filter" // Stopped by the provider's moderation
+	StreamStatusError         StreamStatus = "error"          // Upstream or transport error mid-stream
+	StreamStatusIncomplete    StreamStatus = "incomplete"     // Ended without any finish reason
+)
+
+// StreamResult is the outcome of a whole stream: the text received and why it stopped.
+type StreamResult struct {
+	Content            string       `json:"content"`
+	Status             StreamStatus `json:"status"`
+	FinishReason       string       `json:"finish_reason,omitempty"`
+	NativeFinishReason string       `json:"native_finish_reason,omitempty"`
+	Error              string       `json:"error,omitempty"`
+	ToolCalls          []ToolCall   `json:"tool_calls,omitempty"` // Assembled from the streamed deltas
+}
+
+func (r StreamResult) Complete() bool {
+	return r.Status == StreamStatusComplete
+}
+
+// Message explains a non-complete result in words suitable for the learner.
+func (r StreamResult) Message() string {
+	switch r.Status {
+	case StreamStatusTruncated:
+		return "The response was cut off because it reached the length limit."
+	case StreamStatusContentFilter:
+		return "The response was stopped by the provider's content filter."
+	case StreamStatusError:
+		return "The response failed: " + r.Error
+	case StreamStatusIncomplete:
+		return "The response ended unexpectedly."
+	default:
+		return ""
+	}
 }
 
 type AssessmentProgressEvent struct {
@@ -156,6 +375,7 @@ type AssessmentProgressEvent struct {
 
 type AssessmentStreamResponse struct {
 	ProgressEvent *AssessmentProgressEvent `json:"progress_event,omitempty"`
+	Partial       *utils.JSONFieldEvent    `json:"partial,omitempty"` // A field or list item of the assessment that has streamed in
 	FinalResult   string                   `json:"final_result,omitempty"`
 	Error         string                   `json:"error,omitempty"`
 }
@@ -1,137 +1,456 @@
 package services
 
 import (
+	"slices"
+	"strings"
+	"sync"
+
 	"ai-agent/utils"
 	"ai-agent/work-flows/models"
 )
 
+// ConversationHistoryManager keeps the conversation as a tree of turns and is safe for
+// concurrent use. Editing or regenerating starts a new branch, and the head marks the branch
+// the conversation continues on; every read other than Tree sees only that branch. Turns are
+// only recorded once the reply is complete, through AppendTurn, and evaluations and suggestions
+// are attached by the turn's stable index, so a late annotation lands on its own turn even if
+// the learner has sent more messages since.
 type ConversationHistoryManager struct {
-	conversationHistory []models.Message
-	nextIndex           int
+	mu        sync.RWMutex
+	turns     []models.Turn
+	head      int
+	nextIndex int
+	summary   models.ConversationSummary
 }
 
 func NewConversationHistoryManager() *ConversationHistoryManager {
 	return &ConversationHistoryManager{
-		conversationHistory: []models.Message{},
-		nextIndex:           0,
+		turns:     []models.Turn{},
+		head:      -1,
+		nextIndex: 0,
 	}
 }
 
-// AddMessage appends a message, assigns a stable index, and returns that index.
-func (chm *ConversationHistoryManager) AddMessage(role models.MessageRole, content string) int {
-	idx := chm.nextIndex
+// AppendTurn records a finished turn after the head, makes it the new head, and returns its
+// stable index. Any index or parent set on turn is ignored.
+func (chm *ConversationHistoryManager) AppendTurn(turn models.Turn) int {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	turn.Index = chm.nextIndex
+	turn.Parent = chm.head
 	chm.nextIndex++
-	chm.conversationHistory = append(chm.conversationHistory, models.Message{
-		Index:   idx,
-		Role:    models.MessageRole(role),
-		Content: content,
-	})
-	return idx
-}
-
-// UpdateLastMessage updates the most recent message of the specified role with new content
-func (chm *ConversationHistoryManager) UpdateLastMessage(role models.MessageRole, content string) int {
-	// Find the most recent message of the specified role
-	for i := len(chm.conversationHistory) - 1; i >= 0; i-- {
-		if chm.conversationHistory[i].Role == role {
-			// Update the existing message
-			chm.conversationHistory[i].Content = content
-			return chm.conversationHistory[i].Index
+	chm.turns = append(chm.turns, turn)
+	chm.head = turn.Index
+	return turn.Index
+}
+
+// SetSuggestion attaches suggestions to the reply of the turn at turnIndex and reports whether it exists.
+func (chm *ConversationHistoryManager) SetSuggestion(turnIndex int, suggestion *models.SuggestionResponse) bool {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	i := chm.position(turnIndex)
+	if i < 0 {
+		return false
+	}
+	chm.turns[i].Suggestion = suggestion
+	return true
+}
+
+// SetEvaluation attaches an evaluation to the user message of the turn at turnIndex and reports
+// whether the turn exists and has one.
+func (chm *ConversationHistoryManager) SetEvaluation(turnIndex int, evaluation *models.EvaluationResponse) bool {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	i := chm.position(turnIndex)
+	if i < 0 || chm.turns[i].User == "" {
+		return false
+	}
+	chm.turns[i].Evaluation = evaluation
+	return true
+}
+
+func (chm *ConversationHistoryManager) GetTurn(turnIndex int) (models.Turn, bool) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	i := chm.position(turnIndex)
+	if i < 0 {
+		return models.Turn{}, false
+	}
+	return chm.turns[i], true
+}
+
+// LastTurn returns the most recent turn of the current branch.
+func (chm *ConversationHistoryManager) LastTurn() (models.Turn, bool) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	i := chm.position(chm.head)
+	if i < 0 {
+		return models.Turn{}, false
+	}
+	return chm.turns[i], true
+}
+
+// LastReply returns the tutor's most recent reply, or "" before the conversation has started.
+func (chm *ConversationHistoryManager) LastReply() string {
+	turn, _ := chm.LastTurn()
+	return turn.Reply
+}
+
+// TurnAt returns the turn at position on the current branch, counting the starter as 0, which
+// is how turns are numbered for the learner.
+func (chm *ConversationHistoryManager) TurnAt(position int) (models.Turn, bool) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	branch := chm.branch()
+	if position < 0 || position >= len(branch) {
+		return models.Turn{}, false
+	}
+	return branch[position], true
+}
+
+func (chm *ConversationHistoryManager) Head() int {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return chm.head
+}
+
+// Checkout makes the branch ending at turnIndex the current one, or empties the current branch
+// for -1, and reports whether the turn exists. Later turns stay in the tree. The running summary
+// is dropped if it covers turns that are not on the new branch.
+func (chm *ConversationHistoryManager) Checkout(turnIndex int) bool {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	return chm.checkout(turnIndex)
+}
+
+// checkout is Checkout for callers that hold chm.mu.
+func (chm *ConversationHistoryManager) checkout(turnIndex int) bool {
+	if turnIndex != -1 && chm.position(turnIndex) < 0 {
+		return false
+	}
+	chm.head = turnIndex
+
+	if chm.summary.UpTo > 0 {
+		// The last folded message belongs to this turn; the summary is valid while it is on the branch
+		covered := (chm.summary.UpTo - 1) / 2
+		if !slices.ContainsFunc(chm.branch(), func(turn models.Turn) bool { return turn.Index == covered }) {
+			chm.summary = models.ConversationSummary{}
 		}
 	}
+	return true
+}
+
+// Rewind moves the head back to just before the turn at turnIndex, so that its user message can
+// be sent again, edited or not, as a new branch. It returns that turn and reports whether it is
+// on the current branch and has a user message to send; the starter cannot be rewound.
+func (chm *ConversationHistoryManager) Rewind(turnIndex int) (models.Turn, bool) {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
 
-	// If no message of this role exists, create a new one
-	return chm.AddMessage(role, content)
+	for _, turn := range chm.branch() {
+		if turn.Index == turnIndex && turn.User != "" {
+			chm.checkout(turn.Parent)
+			return turn, true
+		}
+	}
+	return models.Turn{}, false
 }
 
-// Backward compatibility for existing callers
-func (chm *ConversationHistoryManager) AddToHistory(role models.MessageRole, content string) {
-	chm.AddMessage(role, content)
+// Undo drops the last exchange from the current branch and returns it. The starter is never
+// dropped. The turn stays in the tree, so the conversation can still be exported in full.
+func (chm *ConversationHistoryManager) Undo() (models.Turn, bool) {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	i := chm.position(chm.head)
+	if i < 0 || chm.turns[i].User == "" {
+		return models.Turn{}, false
+	}
+	chm.checkout(chm.turns[i].Parent)
+	return chm.turns[i], true
 }
 
-// UpdateLastSuggestion updates suggestion for the most recent assistant message
-func (chm *ConversationHistoryManager) UpdateLastSuggestion(suggestion *models.SuggestionResponse) {
-	for i := len(chm.conversationHistory) - 1; i >= 0; i-- {
-		if chm.conversationHistory[i].Role == models.MessageRoleAssistant {
-			msg := chm.conversationHistory[i]
-			msg.Suggestion = suggestion
-			chm.conversationHistory[i] = msg
-			return
+// position finds the slice position of turnIndex, or -1. Callers hold chm.mu.
+func (chm *ConversationHistoryManager) position(turnIndex int) int {
+	for i := len(chm.turns) - 1; i >= 0; i-- {
+		if chm.turns[i].Index == turnIndex {
+			return i
 		}
 	}
+	return -1
+}
+
+// branch returns the turns from the first one to the head, in order. Callers hold chm.mu.
+func (chm *ConversationHistoryManager) branch() []models.Turn {
+	var branch []models.Turn
+	for i := chm.position(chm.head); i >= 0; i = chm.position(chm.turns[i].Parent) {
+		branch = append(branch, chm.turns[i])
+	}
+	slices.Reverse(branch)
+	return branch
 }
 
-// UpdateLastEvaluation updates evaluation for the most recent user message
-func (chm *ConversationHistoryManager) UpdateLastEvaluation(evaluation *models.EvaluationResponse) {
-	for i := len(chm.conversationHistory) - 1; i >= 0; i-- {
-		if chm.conversationHistory[i].Role == models.MessageRoleUser {
-			msg := chm.conversationHistory[i]
-			msg.Evaluation = evaluation
-			chm.conversationHistory[i] = msg
-			return
+// SavedVocabulary returns the vocabulary suggested to the learner on the current branch, oldest
+// first, and whether the learner has used each phrase in a later message.
+func (chm *ConversationHistoryManager) SavedVocabulary() []models.SavedVocab {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	branch := chm.branch()
+	var saved []models.SavedVocab
+	seen := make(map[string]bool)
+	for i, turn := range branch {
+		if turn.Suggestion == nil {
+			continue
+		}
+		for _, option := range turn.Suggestion.VocabOptions {
+			key := strings.ToLower(strings.TrimSpace(option.Text))
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			saved = append(saved, models.SavedVocab{
+				Text: option.Text,
+				Used: usedAfter(branch[i+1:], key),
+			})
 		}
 	}
+	return saved
 }
 
-func (chm *ConversationHistoryManager) GetMessageByIndex(messageIndex int) (models.Message, bool) {
-	for i := len(chm.conversationHistory) - 1; i >= 0; i-- {
-		if chm.conversationHistory[i].Index == messageIndex {
-			return chm.conversationHistory[i], true
+// usedAfter reports whether the learner's message in any of turns contains phrase.
+func usedAfter(turns []models.Turn, phrase string) bool {
+	for _, turn := range turns {
+		if strings.Contains(strings.ToLower(turn.User), phrase) {
+			return true
 		}
 	}
-	return models.Message{}, false
+	return false
 }
 
+// Len returns the number of messages on the current branch.
 func (chm *ConversationHistoryManager) Len() int {
-	return len(chm.conversationHistory)
-}
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
 
-// func (chm *ConversationHistoryManager) EnforceMax(maxMessages int) {
-// 	if maxMessages <= 0 {
-// 		return
-// 	}
-// 	for len(chm.conversationHistory) > maxMessages {
-// 		chm.conversationHistory = chm.conversationHistory[1:]
-// 	}
-// }
+	branch := chm.branch()
+	return countMessagesByRole(branch, models.MessageRoleUser) + len(branch)
+}
 
 func (chm *ConversationHistoryManager) GetRecentHistory(maxMessages int) []models.Message {
-	start := max(len(chm.conversationHistory)-maxMessages, 0)
-	return chm.conversationHistory[start:]
+	messages := chm.Snapshot()
+	start := max(len(messages)-maxMessages, 0)
+	return messages[start:]
 }
 
 func (chm *ConversationHistoryManager) ResetConversation() {
-	chm.conversationHistory = []models.Message{}
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	chm.turns = []models.Turn{}
+	chm.head = -1
 	chm.nextIndex = 0
+	chm.summary = models.ConversationSummary{}
 	utils.PrintSuccess("Conversation history reset")
 }
 
+// Turns returns a copy of the current branch taken under the lock, so later appends and
+// annotations never show up half-applied in a slice the caller is reading.
+func (chm *ConversationHistoryManager) Turns() []models.Turn {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return chm.branch()
+}
+
+// Tree returns a copy of every turn on every branch, in the order recorded, and the head.
+func (chm *ConversationHistoryManager) Tree() ([]models.Turn, int) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return slices.Clone(chm.turns), chm.head
+}
+
+// Snapshot returns a copy of the current branch as a flat list of messages.
+func (chm *ConversationHistoryManager) Snapshot() []models.Message {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return flattenTurns(chm.branch())
+}
+
+// SummarizedSnapshot returns a snapshot of the current branch as messages together with the
+// running summary that was current at the same moment.
+func (chm *ConversationHistoryManager) SummarizedSnapshot() ([]models.Message, models.ConversationSummary) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return flattenTurns(chm.branch()), chm.summary
+}
+
+// SummarizedTree is Tree together with the running summary that was current at the same moment.
+func (chm *ConversationHistoryManager) SummarizedTree() ([]models.Turn, int, models.ConversationSummary) {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return slices.Clone(chm.turns), chm.head, chm.summary
+}
+
+func (chm *ConversationHistoryManager) Summary() models.ConversationSummary {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	return chm.summary
+}
+
+// SetSummary replaces the running summary unless it covers fewer messages than the current one,
+// so two turns folding at once cannot move the summary backwards.
+func (chm *ConversationHistoryManager) SetSummary(summary models.ConversationSummary) bool {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	if summary.UpTo < chm.summary.UpTo {
+		return false
+	}
+	chm.summary = summary
+	return true
+}
+
+// GetConversationHistory returns a snapshot of the current branch as messages.
 func (chm *ConversationHistoryManager) GetConversationHistory() []models.Message {
-	return chm.conversationHistory
+	return chm.Snapshot()
 }
 
-func (chm *ConversationHistoryManager) SetConversationHistory(history []models.Message) {
-	chm.conversationHistory = history
+// SetConversationHistory replaces the history with messages, such as an imported transcript,
+// pairing each user message with the reply that follows it, and returns how many user messages
+// were dropped for having no reply. The running summary belonged to the old history and is
+// dropped; new turns are numbered after the imported ones.
+func (chm *ConversationHistoryManager) SetConversationHistory(history []models.Message) int {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	turns, dropped := TurnsFromMessages(history)
+	chm.restore(turns, len(turns)-1, models.ConversationSummary{})
+	return dropped
+}
+
+// Restore replaces the tree, head and summary with a saved session's, continuing the index
+// sequence after the highest saved index.
+func (chm *ConversationHistoryManager) Restore(turns []models.Turn, head int, summary models.ConversationSummary) {
+	chm.mu.Lock()
+	defer chm.mu.Unlock()
+
+	chm.restore(slices.Clone(turns), head, summary)
+}
+
+// restore is Restore for callers that hold chm.mu and own turns.
+func (chm *ConversationHistoryManager) restore(turns []models.Turn, head int, summary models.ConversationSummary) {
+	chm.turns = turns
+	chm.head = head
+	chm.nextIndex = 0
+	for _, turn := range turns {
+		chm.nextIndex = max(chm.nextIndex, turn.Index+1)
+	}
+	chm.summary = summary
 }
 
 func (chm *ConversationHistoryManager) GetConversationStats() map[string]int {
+	chm.mu.RLock()
+	defer chm.mu.RUnlock()
+
+	branch := chm.branch()
+	userMessages := countMessagesByRole(branch, models.MessageRoleUser)
 	return map[string]int{
-		"total_messages": len(chm.conversationHistory),
-		"user_messages":  chm.countMessagesByRole(models.MessageRoleUser),
-		"bot_messages":   chm.countMessagesByRole(models.MessageRoleAssistant),
+		"total_messages": userMessages + len(branch),
+		"user_messages":  userMessages,
+		"bot_messages":   len(branch),
+		"turns":          len(branch),
+		"branches":       chm.countBranches(),
 	}
 }
 
-func (chm *ConversationHistoryManager) countMessagesByRole(role models.MessageRole) int {
+// countBranches counts the leaves of the tree. Callers hold chm.mu.
+func (chm *ConversationHistoryManager) countBranches() int {
+	parents := make(map[int]bool, len(chm.turns))
+	for _, turn := range chm.turns {
+		parents[turn.Parent] = true
+	}
 	count := 0
-	for _, msg := range chm.conversationHistory {
-		if msg.Role == models.MessageRole(role) {
+	for _, turn := range chm.turns {
+		if !parents[turn.Index] {
 			count++
 		}
 	}
 	return count
 }
 
+// countMessagesByRole counts messages with role in turns. Every turn has a reply; only turns
+// after the starter have a user message.
+func countMessagesByRole(turns []models.Turn, role models.MessageRole) int {
+	count := 0
+	for _, turn := range turns {
+		switch {
+		case role == models.MessageRoleAssistant,
+			role == models.MessageRoleUser && turn.User != "":
+			count++
+		}
+	}
+	return count
+}
+
+func flattenTurns(turns []models.Turn) []models.Message {
+	messages := make([]models.Message, 0, 2*len(turns))
+	for _, turn := range turns {
+		messages = append(messages, turn.Messages()...)
+	}
+	return messages
+}
+
+// TurnsFromMessages groups a flat message list into a single branch of turns: each user message
+// opens a turn that the next assistant message completes, and an assistant message with no user
+// message before it is a turn of its own. A user message without a reply, followed by another
+// user message or ending the list, is dropped as it would be in a live session; the number
+// dropped is returned with the turns. Turns are numbered from zero in order.
+func TurnsFromMessages(messages []models.Message) ([]models.Turn, int) {
+	var turns []models.Turn
+	var pending *models.Message
+	dropped := 0
+	for _, msg := range messages {
+		switch msg.Role {
+		case models.MessageRoleUser:
+			if pending != nil {
+				dropped++
+			}
+			pending = &msg
+		case models.MessageRoleAssistant:
+			turn := models.Turn{
+				Index:      len(turns),
+				Parent:     len(turns) - 1,
+				Reply:      msg.Content,
+				Suggestion: msg.Suggestion,
+			}
+			if pending != nil {
+				turn.User = pending.Content
+				turn.Evaluation = pending.Evaluation
+				pending = nil
+			}
+			turns = append(turns, turn)
+		}
+	}
+	if pending != nil {
+		dropped++
+	}
+	return turns, dropped
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
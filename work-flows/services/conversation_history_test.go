@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"ai-agent/work-flows/models"
+)
+
+// newTestHistory records a starter and the given number of exchanges, indexed 0 to exchanges.
+func newTestHistory(exchanges int) *ConversationHistoryManager {
+	chm := NewConversationHistoryManager()
+	chm.AppendTurn(models.Turn{Reply: "Hello!"})
+	for i := 1; i <= exchanges; i++ {
+		chm.AppendTurn(models.Turn{User: fmt.Sprintf("user %d", i), Reply: fmt.Sprintf("reply %d", i)})
+	}
+	return chm
+}
+
+func branchIndexes(chm *ConversationHistoryManager) []int {
+	var indexes []int
+	for _, turn := range chm.Turns() {
+		indexes = append(indexes, turn.Index)
+	}
+	return indexes
+}
+
+func TestConversationHistoryBranching(t *testing.T) {
+	tests := []struct {
+		name       string
+		exchanges  int
+		op         func(chm *ConversationHistoryManager) bool
+		wantOK     bool
+		wantBranch []int
+	}{
+		{
+			name:       "undo drops the last exchange",
+			exchanges:  3,
+			op:         func(chm *ConversationHistoryManager) bool { _, ok := chm.Undo(); return ok },
+			wantOK:     true,
+			wantBranch: []int{0, 1, 2},
+		},
+		{
+			name:       "undo keeps the starter",
+			op:         func(chm *ConversationHistoryManager) bool { _, ok := chm.Undo(); return ok },
+			wantBranch: []int{0},
+		},
+		{
+			name:       "rewind moves before the turn",
+			exchanges:  3,
+			op:         func(chm *ConversationHistoryManager) bool { _, ok := chm.Rewind(2); return ok },
+			wantOK:     true,
+			wantBranch: []int{0, 1},
+		},
+		{
+			name:       "starter cannot be rewound",
+			exchanges:  3,
+			op:         func(chm *ConversationHistoryManager) bool { _, ok := chm.Rewind(0); return ok },
+			wantBranch: []int{0, 1, 2, 3},
+		},
+		{
+			name:      "turn off the current branch cannot be rewound",
+			exchanges: 3,
+			op: func(chm *ConversationHistoryManager) bool {
+				chm.Rewind(2)
+				chm.AppendTurn(models.Turn{User: "edited", Reply: "reply"})
+				_, ok := chm.Rewind(3)
+				return ok
+			},
+			wantBranch: []int{0, 1, 4},
+		},
+		{
+			name:      "checkout returns to an earlier branch",
+			exchanges: 3,
+			op: func(chm *ConversationHistoryManager) bool {
+				chm.Rewind(2)
+				chm.AppendTurn(models.Turn{User: "edited", Reply: "reply"})
+				return chm.Checkout(3)
+			},
+			wantOK:     true,
+			wantBranch: []int{0, 1, 2, 3},
+		},
+		{
+			name:      "checkout -1 empties the branch",
+			exchanges: 1,
+			op:        func(chm *ConversationHistoryManager) bool { return chm.Checkout(-1) },
+			wantOK:    true,
+		},
+		{
+			name:       "checkout of an unknown turn changes nothing",
+			exchanges:  1,
+			op:         func(chm *ConversationHistoryManager) bool { return chm.Checkout(7) },
+			wantBranch: []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chm := newTestHistory(tt.exchanges)
+			if ok := tt.op(chm); ok != tt.wantOK {
+				t.Errorf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if got := branchIndexes(chm); !slices.Equal(got, tt.wantBranch) {
+				t.Errorf("got branch %v, want %v", got, tt.wantBranch)
+			}
+		})
+	}
+}
+
+func TestConversationHistorySummaryInvalidation(t *testing.T) {
+	// The summary covers the messages of turns 0 and 1
+	summary := models.ConversationSummary{Text: "The learner likes hiking.", UpTo: 4}
+
+	tests := []struct {
+		name     string
+		op       func(chm *ConversationHistoryManager)
+		wantKept bool
+	}{
+		{name: "undo after the summarized turns", op: func(chm *ConversationHistoryManager) { chm.Undo() }, wantKept: true},
+		{name: "rewind after the summarized turns", op: func(chm *ConversationHistoryManager) { chm.Rewind(2) }, wantKept: true},
+		{name: "rewind into the summarized turns", op: func(chm *ConversationHistoryManager) { chm.Rewind(1) }},
+		{
+			name: "checkout of a branch sharing the summarized turns",
+			op: func(chm *ConversationHistoryManager) {
+				chm.Rewind(3)
+				chm.AppendTurn(models.Turn{User: "edited", Reply: "reply"})
+			},
+			wantKept: true,
+		},
+		{name: "checkout -1", op: func(chm *ConversationHistoryManager) { chm.Checkout(-1) }},
+		{name: "replaced history", op: func(chm *ConversationHistoryManager) { chm.SetConversationHistory(chm.Snapshot()) }},
+		{
+			name: "older summary is refused",
+			op: func(chm *ConversationHistoryManager) {
+				chm.SetSummary(models.ConversationSummary{Text: "old", UpTo: 2})
+			},
+			wantKept: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chm := newTestHistory(3)
+			if !chm.SetSummary(summary) {
+				t.Fatal("summary was refused")
+			}
+			tt.op(chm)
+
+			want := models.ConversationSummary{}
+			if tt.wantKept {
+				want = summary
+			}
+			if got := chm.Summary(); got != want {
+				t.Errorf("got summary %+v, want %+v", got, want)
+			}
+		})
+	}
+}
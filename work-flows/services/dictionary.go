@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DictionaryAPIURL      = "https://api.dictionaryapi.dev/api/v2/entries/en/"
+	maxDictionaryMeanings = 3
+)
+
+// DictionaryEntry is the part of a dictionary lookup the agents pass back to the model.
+type DictionaryEntry struct {
+	Word     string              `json:"word"`
+	Phonetic string              `json:"phonetic,omitempty"`
+	Meanings []DictionaryMeaning `json:"meanings"`
+}
+
+type DictionaryMeaning struct {
+	PartOfSpeech string `json:"part_of_speech"`
+	Definition   string `json:"definition"`
+	Example      string `json:"example,omitempty"`
+}
+
+type dictionaryAPIEntry struct {
+	Word     string `json:"word"`
+	Phonetic string `json:"phonetic"`
+	Meanings []struct {
+		PartOfSpeech string `json:"partOfSpeech"`
+		Definitions  []struct {
+			Definition string `json:"definition"`
+			Example    string `json:"example"`
+		} `json:"definitions"`
+	} `json:"meanings"`
+}
+
+var dictionaryHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// LookupWord fetches the first definition of each part of speech for an English word.
+func LookupWord(ctx context.Context, word string) (*DictionaryEntry, error) {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if word == "" {
+		return nil, fmt.Errorf("word is empty")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, DictionaryAPIURL+url.PathEscape(word), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := dictionaryHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dictionary lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("no dictionary entry for %q", word)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dictionary lookup failed with status %d", resp.StatusCode)
+	}
+
+	var entries []dictionaryAPIEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode dictionary response: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no dictionary entry for %q", word)
+	}
+
+	entry := &DictionaryEntry{Word: entries[0].Word, Phonetic: entries[0].Phonetic}
+	for _, meaning := range entries[0].Meanings {
+		if len(meaning.Definitions) == 0 {
+			continue
+		}
+		entry.Meanings = append(entry.Meanings, DictionaryMeaning{
+			PartOfSpeech: meaning.PartOfSpeech,
+			Definition:   meaning.Definitions[0].Definition,
+			Example:      meaning.Definitions[0].Example,
+		})
+		if len(entry.Meanings) >= maxDictionaryMeanings {
+			break
+		}
+	}
+
+	return entry, nil
+}
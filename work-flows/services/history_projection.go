@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"ai-agent/work-flows/models"
+)
+
+// HistoryProjection chooses what of the stored history an agent sends to the model.
+// The zero value sends only roles and content.
+type HistoryProjection struct {
+	// Evaluations appends a compact summary of each user message's evaluation to its content
+	Evaluations bool
+}
+
+// ProjectHistory converts stored messages to wire messages. Indexes and suggestions are
+// never sent; evaluations only when the projection asks for them.
+func ProjectHistory(history []models.Message, projection HistoryProjection) []models.ChatMessage {
+	messages := make([]models.ChatMessage, 0, len(history))
+	for _, msg := range history {
+		content := msg.Content
+		if projection.Evaluations && msg.Role == models.MessageRoleUser && msg.Evaluation != nil {
+			content += "\n" + EvaluationSummary(msg.Evaluation)
+		}
+		messages = append(messages, models.ChatMessage{
+			Role:    msg.Role,
+			Content: content,
+		})
+	}
+	return messages
+}
+
+// EvaluationSummary is a one-line form of an evaluation, short enough to repeat for every turn.
+// The long HTML description is left out.
+func EvaluationSummary(evaluation *models.EvaluationResponse) string {
+	summary := fmt.Sprintf("[Evaluation: %s", evaluation.Status)
+	if short := strings.TrimSpace(evaluation.ShortDescription); short != "" {
+		summary += " - " + short
+	}
+	if correct := strings.TrimSpace(evaluation.Correct); correct != "" {
+		summary += fmt.Sprintf("; correct: %q", correct)
+	}
+	return summary + "]"
+}
+
+// Project returns a consistent snapshot of the history as wire messages.
+func (chm *ConversationHistoryManager) Project(projection HistoryProjection) []models.ChatMessage {
+	return ProjectHistory(chm.Snapshot(), projection)
+}
+
+// EstimateTokens approximates the token count of text at four characters per token, which is
+// close enough for budgeting English conversation without a tokenizer per model.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// EstimateMessageTokens adds the few tokens of framing each message costs on the wire.
+func EstimateMessageTokens(msg models.ChatMessage) int {
+	return EstimateTokens(msg.Text()) + 4
+}
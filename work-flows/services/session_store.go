@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const DefaultSessionDir = "sessions"
+
+// ErrSessionNotFound is returned by SessionStore.Load for an unknown session ID.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRecord is everything needed to rebuild a conversation session after a restart,
+// including each turn's evaluation and suggestions and the branches left behind by edits.
+type SessionRecord struct {
+	SessionID string                     `json:"session_id"`
+	Topic     string                     `json:"topic"`
+	Level     models.ConversationLevel   `json:"level"`
+	Language  string                     `json:"language"`
+	CreatedAt time.Time                  `json:"created_at"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+	Turns     []models.Turn              `json:"turns"`
+	Head      int                        `json:"head"` // Last turn of the branch that is the transcript
+	Summary   models.ConversationSummary `json:"summary,omitzero"`
+}
+
+// Transcript returns the turns of the branch ending at Head, from the first one.
+func (r *SessionRecord) Transcript() []models.Turn {
+	history := NewConversationHistoryManager()
+	history.Restore(r.Turns, r.Head, r.Summary)
+	return history.Turns()
+}
+
+// SessionInfo describes a stored session without its history, for listing.
+type SessionInfo struct {
+	SessionID string                   `json:"session_id"`
+	Topic     string                   `json:"topic"`
+	Level     models.ConversationLevel `json:"level"`
+	Language  string                   `json:"language"`
+	Turns     int                      `json:"turns"`
+	UpdatedAt time.Time                `json:"updated_at"`
+}
+
+// SessionStore keeps conversation sessions across restarts.
+type SessionStore interface {
+	Save(record *SessionRecord) error
+	Load(sessionID string) (*SessionRecord, error)
+	List() ([]SessionInfo, error)
+	Delete(sessionID string) error
+}
+
+// validSessionID keeps session IDs usable as file names.
+var validSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+func ValidateSessionID(sessionID string) error {
+	if !validSessionID.MatchString(sessionID) {
+		return fmt.Errorf("invalid session ID %q: use letters, digits, '_' and '-'", sessionID)
+	}
+	return nil
+}
+
+// FileSessionStore keeps one JSON file per session in a directory.
+type FileSessionStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileSessionStore(dir string) *FileSessionStore {
+	return &FileSessionStore{dir: dir}
+}
+
+func (fs *FileSessionStore) path(sessionID string) string {
+	return filepath.Join(fs.dir, sessionID+".json")
+}
+
+// Save writes the record to a temporary file and renames it into place, so a crash mid-write
+// never leaves a truncated session behind.
+func (fs *FileSessionStore) Save(record *SessionRecord) error {
+	if err := ValidateSessionID(record.SessionID); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := os.MkdirAll(fs.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(fs.dir, record.SessionID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fs.path(record.SessionID)); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (fs *FileSessionStore) Load(sessionID string) (*SessionRecord, error) {
+	if err := ValidateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(fs.path(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var record SessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", sessionID, err)
+	}
+	return &record, nil
+}
+
+// List returns the stored sessions, most recently updated first. Unreadable files are skipped.
+func (fs *FileSessionStore) List() ([]SessionInfo, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	var sessions []SessionInfo
+	for _, entry := range entries {
+		sessionID, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		record, err := fs.Load(sessionID)
+		if err != nil {
+			utils.PrintError(fmt.Sprintf("Skipping session file %s: %v", entry.Name(), err))
+			continue
+		}
+		sessions = append(sessions, SessionInfo{
+			SessionID: record.SessionID,
+			Topic:     record.Topic,
+			Level:     record.Level,
+			Language:  record.Language,
+			Turns:     len(record.Transcript()),
+			UpdatedAt: record.UpdatedAt,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+func (fs *FileSessionStore) Delete(sessionID string) error {
+	if err := ValidateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := os.Remove(fs.path(sessionID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+var (
+	sharedSessionStore     SessionStore
+	sharedSessionStoreOnce sync.Once
+)
+
+// SharedSessionStore returns the process-wide store: files in SESSION_DIR (default "sessions"),
+// or nil when SESSION_STORE=off, in which case sessions live only in memory.
+func SharedSessionStore() SessionStore {
+	sharedSessionStoreOnce.Do(func() {
+		switch strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_STORE"))) {
+		case "off", "none", "memory":
+			return
+		}
+		dir := os.Getenv("SESSION_DIR")
+		if dir == "" {
+			dir = DefaultSessionDir
+		}
+		sharedSessionStore = NewFileSessionStore(dir)
+	})
+	return sharedSessionStore
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+const (
+	ExportFormatMarkdown = "markdown"
+	ExportFormatHTML     = "html"
+	ExportFormatCSV      = "csv"
+	ExportFormatJSONL    = "jsonl"
+)
+
+// Transcript is the final branch of a session, ready for export.
+type Transcript struct {
+	SessionID  string
+	Topic      string
+	Level      models.ConversationLevel
+	Language   string
+	CreatedAt  time.Time
+	ExportedAt time.Time
+	Turns      []models.Turn
+}
+
+// NewTranscript takes the transcript branch of a saved session, with invalid UTF-8 replaced.
+func NewTranscript(record *SessionRecord) *Transcript {
+	turns := record.Transcript()
+	for i := range turns {
+		turns[i] = sanitizeTurn(turns[i])
+	}
+
+	return &Transcript{
+		SessionID:  record.SessionID,
+		Topic:      utils.SanitizeString(record.Topic),
+		Level:      record.Level,
+		Language:   utils.SanitizeString(record.Language),
+		CreatedAt:  record.CreatedAt,
+		ExportedAt: time.Now(),
+		Turns:      turns,
+	}
+}
+
+func sanitizeTurn(turn models.Turn) models.Turn {
+	turn.User = utils.SanitizeString(turn.User)
+	turn.Reply = utils.SanitizeString(turn.Reply)
+	if turn.Evaluation != nil {
+		evaluation := *turn.Evaluation
+		evaluation.ShortDescription = utils.SanitizeString(evaluation.ShortDescription)
+		evaluation.LongDescription = utils.SanitizeString(evaluation.LongDescription)
+		evaluation.Correct = utils.SanitizeString(evaluation.Correct)
+		turn.Evaluation = &evaluation
+	}
+	return turn
+}
+
+// TranscriptFormatter renders a transcript in one export format.
+type TranscriptFormatter interface {
+	Name() string
+	Extension() string
+	ContentType() string
+	Format(w io.Writer, transcript *Transcript) error
+}
+
+var (
+	transcriptFormattersMu sync.RWMutex
+	transcriptFormatters   = map[string]TranscriptFormatter{
+		ExportFormatMarkdown: markdownFormatter{},
+		ExportFormatHTML:     htmlFormatter{},
+		ExportFormatCSV:      csvFormatter{},
+		ExportFormatJSONL:    jsonlFormatter{},
+	}
+)
+
+// RegisterTranscriptFormatter adds a format, or replaces the one with the same name.
+func RegisterTranscriptFormatter(formatter TranscriptFormatter) {
+	transcriptFormattersMu.Lock()
+	defer transcriptFormattersMu.Unlock()
+
+	transcriptFormatters[strings.ToLower(formatter.Name())] = formatter
+}
+
+// TranscriptFormatterFor returns the formatter for a format name; "md" is accepted for Markdown.
+func TranscriptFormatterFor(format string) (TranscriptFormatter, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "md" {
+		format = ExportFormatMarkdown
+	}
+
+	transcriptFormattersMu.RLock()
+	defer transcriptFormattersMu.RUnlock()
+
+	formatter, ok := transcriptFormatters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown export format %q (available: %s)", format, strings.Join(transcriptFormats(), ", "))
+	}
+	return formatter, nil
+}
+
+// TranscriptFormats lists the registered format names, sorted.
+func TranscriptFormats() []string {
+	transcriptFormattersMu.RLock()
+	defer transcriptFormattersMu.RUnlock()
+
+	return transcriptFormats()
+}
+
+func transcriptFormats() []string {
+	formats := make([]string, 0, len(transcriptFormatters))
+	for name := range transcriptFormatters {
+		formats = append(formats, name)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// ExportTranscript renders transcript in format and returns it with the file name to save it as.
+func ExportTranscript(transcript *Transcript, format string) ([]byte, string, error) {
+	formatter, err := TranscriptFormatterFor(format)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, transcript); err != nil {
+		return nil, "", fmt.Errorf("failed to export %s: %w", formatter.Name(), err)
+	}
+	return buf.Bytes(), transcript.SessionID + formatter.Extension(), nil
+}
+
+// transcriptTitle is the heading of the readable formats.
+func transcriptTitle(transcript *Transcript) string {
+	topic := strings.ReplaceAll(transcript.Topic, "_", " ")
+	if topic == "" {
+		return "English conversation"
+	}
+	return "English conversation: " + topic
+}
+
+type markdownFormatter struct{}
+
+func (markdownFormatter) Name() string        { return ExportFormatMarkdown }
+func (markdownFormatter) Extension() string   { return ".md" }
+func (markdownFormatter) ContentType() string { return "text/markdown; charset=utf-8" }
+
+func (markdownFormatter) Format(w io.Writer, transcript *Transcript) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", transcriptTitle(transcript))
+	fmt.Fprintf(&b, "- Session: %s\n", transcript.SessionID)
+	fmt.Fprintf(&b, "- Level: %s\n", transcript.Level)
+	if !transcript.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "- Started: %s\n", transcript.CreatedAt.Format(time.DateTime))
+	}
+	fmt.Fprintf(&b, "- Exported: %s\n", transcript.ExportedAt.Format(time.DateTime))
+
+	for _, turn := range transcript.Turns {
+		if turn.User != "" {
+			fmt.Fprintf(&b, "\n**You:** %s\n", turn.User)
+			if e := turn.Evaluation; e != nil {
+				fmt.Fprintf(&b, "\n> %s", evaluationLabel(e.Status))
+				if e.ShortDescription != "" {
+					fmt.Fprintf(&b, " — %s", e.ShortDescription)
+				}
+				b.WriteString("\n")
+				if e.Correct != "" {
+					fmt.Fprintf(&b, ">\n> Correction: %s\n", e.Correct)
+				}
+			}
+		}
+		fmt.Fprintf(&b, "\n**Tutor:** %s\n", turn.Reply)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type htmlFormatter struct{}
+
+func (htmlFormatter) Name() string        { return ExportFormatHTML }
+func (htmlFormatter) Extension() string   { return ".html" }
+func (htmlFormatter) ContentType() string { return "text/html; charset=utf-8" }
+
+// Format writes a standalone page. Model output is escaped, so the evaluation's long HTML
+// description is left out in favour of the short one.
+func (htmlFormatter) Format(w io.Writer, transcript *Transcript) error {
+	esc := html.EscapeString
+	title := esc(transcriptTitle(transcript))
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString(`<style>
+body { font-family: sans-serif; max-width: 760px; margin: 2em auto; line-height: 1.5; color: #222; }
+.meta { color: #666; font-size: 0.9em; }
+.message { margin: 1em 0; padding: 0.6em 1em; border-radius: 8px; }
+.user { background: #e3f2fd; }
+.assistant { background: #f5f5f5; }
+.evaluation { margin-top: 0.4em; font-size: 0.9em; color: #555; }
+.correction { color: #2e7d32; }
+</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+	fmt.Fprintf(&b, "<p class=\"meta\">Session %s · Level %s · Exported %s</p>\n",
+		esc(transcript.SessionID), esc(string(transcript.Level)), transcript.ExportedAt.Format(time.DateTime))
+
+	for _, turn := range transcript.Turns {
+		if turn.User != "" {
+			fmt.Fprintf(&b, "<div class=\"message user\"><strong>You:</strong> %s", esc(turn.User))
+			if e := turn.Evaluation; e != nil {
+				fmt.Fprintf(&b, "\n<div class=\"evaluation\">%s", esc(evaluationLabel(e.Status)))
+				if e.ShortDescription != "" {
+					fmt.Fprintf(&b, " — %s", esc(e.ShortDescription))
+				}
+				if e.Correct != "" {
+					fmt.Fprintf(&b, "<br><span class=\"correction\">Correction: %s</span>", esc(e.Correct))
+				}
+				b.WriteString("</div>")
+			}
+			b.WriteString("</div>\n")
+		}
+		fmt.Fprintf(&b, "<div class=\"message assistant\"><strong>Tutor:</strong> %s</div>\n", esc(turn.Reply))
+	}
+	b.WriteString("</body>\n</html>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type csvFormatter struct{}
+
+func (csvFormatter) Name() string        { return ExportFormatCSV }
+func (csvFormatter) Extension() string   { return ".csv" }
+func (csvFormatter) ContentType() string { return "text/csv; charset=utf-8" }
+
+// Format writes one row per learner message, numbered as in the transcript.
+func (csvFormatter) Format(w io.Writer, transcript *Transcript) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"turn", "message", "status", "feedback", "correction"})
+	for position, turn := range transcript.Turns {
+		if turn.User == "" {
+			continue
+		}
+		row := []string{strconv.Itoa(position), turn.User, "", "", ""}
+		if e := turn.Evaluation; e != nil {
+			row[2], row[3], row[4] = e.Status, e.ShortDescription, e.Correct
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonlFormatter struct{}
+
+func (jsonlFormatter) Name() string        { return ExportFormatJSONL }
+func (jsonlFormatter) Extension() string   { return ".jsonl" }
+func (jsonlFormatter) ContentType() string { return "application/jsonl; charset=utf-8" }
+
+// Format writes the conversation as one line in chat format, {"messages": [...]}, so exports of
+// several sessions can be concatenated into a dataset.
+func (jsonlFormatter) Format(w io.Writer, transcript *Transcript) error {
+	var messages []models.Message
+	for _, turn := range transcript.Turns {
+		messages = append(messages, turn.Messages()...)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(struct {
+		Messages []models.ChatMessage `json:"messages"`
+	}{ProjectHistory(messages, HistoryProjection{})})
+}
+
+// evaluationLabel is an evaluation status as shown in the readable formats, e.g. "✏️ needs improvement".
+func evaluationLabel(status string) string {
+	mark := "•"
+	switch status {
+	case "excellent":
+		mark = "🌟"
+	case "good":
+		mark = "✅"
+	case "needs_improvement":
+		mark = "✏️"
+	}
+	return mark + " " + strings.ReplaceAll(status, "_", " ")
+}
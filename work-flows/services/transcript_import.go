@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+// HistoryExportType is the request_type of the history export written by the CLI 'history' command.
+const HistoryExportType = "conversation_export"
+
+// MaxImportSize bounds an imported history export, which is far larger than any real conversation.
+const MaxImportSize = 5 << 20
+
+// ErrInvalidTranscript is returned for a file that is not a usable history export.
+var ErrInvalidTranscript = errors.New("invalid history export")
+
+// ImportedTranscript is a conversation read back from a history export. Topic, level and
+// language are empty for exports that predate them.
+type ImportedTranscript struct {
+	SessionID string
+	Topic     string
+	Level     models.ConversationLevel
+	Language  string
+	History   []models.Message
+}
+
+// historyExport is the utils.ExportData envelope with the history export as its data.
+type historyExport struct {
+	RequestType string `json:"request_type"`
+	Data        struct {
+		SessionID string           `json:"session_id"`
+		Topic     string           `json:"topic"`
+		Level     string           `json:"level"`
+		Language  string           `json:"language"`
+		History   []models.Message `json:"history"`
+	} `json:"data"`
+}
+
+// ReadHistoryExport reads and validates a history export file.
+func ReadHistoryExport(path string) (*ImportedTranscript, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info.Size() > MaxImportSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidTranscript, path, MaxImportSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return ParseHistoryExport(data)
+}
+
+// ParseHistoryExport validates a history export and returns its conversation. Invalid UTF-8 is
+// replaced; unknown roles, empty messages, a user message without a reply after it and a
+// conversation without any reply are rejected, so nothing in the file is lost on import.
+func ParseHistoryExport(data []byte) (*ImportedTranscript, error) {
+	var export historyExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTranscript, err)
+	}
+	if export.RequestType != HistoryExportType {
+		return nil, fmt.Errorf("%w: request_type is %q, want %q", ErrInvalidTranscript, export.RequestType, HistoryExportType)
+	}
+
+	level := models.ConversationLevel(export.Data.Level)
+	if level != "" && !models.IsValidConversationLevel(string(level)) {
+		return nil, fmt.Errorf("%w: unknown level %q", ErrInvalidTranscript, level)
+	}
+
+	history := make([]models.Message, 0, len(export.Data.History))
+	replies := 0
+	for i, msg := range export.Data.History {
+		switch msg.Role {
+		case models.MessageRoleUser:
+			next := i + 1
+			if next == len(export.Data.History) {
+				return nil, fmt.Errorf("%w: message %d is the learner's and has no reply", ErrInvalidTranscript, i+1)
+			}
+			if export.Data.History[next].Role == models.MessageRoleUser {
+				return nil, fmt.Errorf("%w: messages %d and %d are both the learner's; user and assistant messages must alternate", ErrInvalidTranscript, i+1, next+1)
+			}
+		case models.MessageRoleAssistant:
+			replies++
+		default:
+			return nil, fmt.Errorf("%w: message %d has role %q", ErrInvalidTranscript, i+1, msg.Role)
+		}
+
+		msg.Content = strings.TrimSpace(utils.SanitizeString(msg.Content))
+		if msg.Content == "" {
+			return nil, fmt.Errorf("%w: message %d is empty", ErrInvalidTranscript, i+1)
+		}
+		history = append(history, msg)
+	}
+	if replies == 0 {
+		return nil, fmt.Errorf("%w: no conversation history", ErrInvalidTranscript)
+	}
+
+	return &ImportedTranscript{
+		SessionID: utils.SanitizeString(export.Data.SessionID),
+		Topic:     utils.SanitizeString(export.Data.Topic),
+		Level:     level,
+		Language:  utils.SanitizeString(export.Data.Language),
+		History:   history,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// historyExportJSON wraps history, a JSON array of messages, in a history export with the given level.
+func historyExportJSON(level string, history string) []byte {
+	return fmt.Appendf(nil, `{"request_type": %q, "data": {"session_id": "s1", "topic": "travel", "level": %q, "history": %s}}`,
+		HistoryExportType, level, history)
+}
+
+func TestParseHistoryExport(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		wantErr     bool
+		wantContent []string
+	}{
+		{
+			name:        "starter and one exchange",
+			data:        historyExportJSON("intermediate", `[{"role": "assistant", "content": "Hi!"}, {"role": "user", "content": " Hello "}, {"role": "assistant", "content": "How are you?"}]`),
+			wantContent: []string{"Hi!", "Hello", "How are you?"},
+		},
+		{
+			name:        "export without a level",
+			data:        historyExportJSON("", `[{"role": "assistant", "content": "Hi!"}]`),
+			wantContent: []string{"Hi!"},
+		},
+		{
+			name:        "invalid UTF-8 is replaced",
+			data:        historyExportJSON("", `[{"role": "assistant", "content": "Hi`+"\xff"+`"}]`),
+			wantContent: []string{"Hi�"},
+		},
+		{name: "not json", data: []byte("hello"), wantErr: true},
+		{name: "other export type", data: []byte(`{"request_type": "assessment", "data": {}}`), wantErr: true},
+		{name: "unknown level", data: historyExportJSON("expert", `[{"role": "assistant", "content": "Hi!"}]`), wantErr: true},
+		{name: "no reply", data: historyExportJSON("", `[]`), wantErr: true},
+		{name: "unknown role", data: historyExportJSON("", `[{"role": "system", "content": "Be nice"}, {"role": "assistant", "content": "Hi!"}]`), wantErr: true},
+		{name: "empty message", data: historyExportJSON("", `[{"role": "assistant", "content": "  "}]`), wantErr: true},
+		{
+			name:    "consecutive user messages",
+			data:    historyExportJSON("", `[{"role": "user", "content": "One"}, {"role": "user", "content": "Two"}, {"role": "assistant", "content": "Hi!"}]`),
+			wantErr: true,
+		},
+		{
+			name:    "trailing user message",
+			data:    historyExportJSON("", `[{"role": "assistant", "content": "Hi!"}, {"role": "user", "content": "Hello"}]`),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transcript, err := ParseHistoryExport(tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTranscript) {
+					t.Fatalf("got %v, want ErrInvalidTranscript", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var content []string
+			for _, msg := range transcript.History {
+				content = append(content, msg.Content)
+			}
+			if !slices.Equal(content, tt.wantContent) {
+				t.Errorf("got messages %q, want %q", content, tt.wantContent)
+			}
+			if transcript.SessionID != "s1" || transcript.Topic != "travel" {
+				t.Errorf("got session %q topic %q, want s1 travel", transcript.SessionID, transcript.Topic)
+			}
+		})
+	}
+}
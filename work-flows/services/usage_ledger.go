@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+type UsageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *UsageTotals) add(record models.UsageRecord) {
+	t.Calls++
+	t.PromptTokens += record.PromptTokens
+	t.CompletionTokens += record.CompletionTokens
+	t.CachedTokens += record.CachedTokens
+	t.ReasoningTokens += record.ReasoningTokens
+	t.Cost += record.Cost
+}
+
+type UsageSummary struct {
+	SessionID string                  `json:"session_id,omitempty"`
+	Currency  string                  `json:"currency"`
+	Total     UsageTotals             `json:"total"`
+	ByAgent   map[string]*UsageTotals `json:"by_agent"`
+	ByModel   map[string]*UsageTotals `json:"by_model"`
+}
+
+// MaxUsageRecords bounds the raw records a ledger keeps; totals cover every call regardless.
+const MaxUsageRecords = 10000
+
+// usageAggregate is the running total of a set of calls, split by agent and by model.
+type usageAggregate struct {
+	total   UsageTotals
+	byAgent map[string]*UsageTotals
+	byModel map[string]*UsageTotals
+}
+
+func newUsageAggregate() *usageAggregate {
+	return &usageAggregate{
+		byAgent: make(map[string]*UsageTotals),
+		byModel: make(map[string]*UsageTotals),
+	}
+}
+
+func (a *usageAggregate) add(record models.UsageRecord) {
+	a.total.add(record)
+
+	if a.byAgent[record.Agent] == nil {
+		a.byAgent[record.Agent] = &UsageTotals{}
+	}
+	a.byAgent[record.Agent].add(record)
+
+	if a.byModel[record.Model] == nil {
+		a.byModel[record.Model] = &UsageTotals{}
+	}
+	a.byModel[record.Model].add(record)
+}
+
+// UsageLedger prices every metered LLM call with the configured price table and keeps running
+// totals per session and overall. Only the most recent MaxUsageRecords calls are kept as records,
+// so a long-running server does not grow without bound.
+type UsageLedger struct {
+	mu       sync.Mutex
+	records  []models.UsageRecord // Ring buffer of the latest calls, oldest at next once full
+	next     int
+	all      *usageAggregate
+	sessions map[string]*usageAggregate
+	pricing  *utils.PricingConfig
+}
+
+var (
+	usageLedger     *UsageLedger
+	usageLedgerOnce sync.Once
+)
+
+// GetUsageLedger returns the process-wide ledger shared by all sessions.
+func GetUsageLedger() *UsageLedger {
+	usageLedgerOnce.Do(func() {
+		pricing, err := utils.LoadPricingConfig()
+		if err != nil {
+			utils.PrintError(fmt.Sprintf("Failed to load pricing config, using provider-reported costs: %v", err))
+		}
+		usageLedger = NewUsageLedger(pricing)
+	})
+	return usageLedger
+}
+
+func NewUsageLedger(pricing *utils.PricingConfig) *UsageLedger {
+	return &UsageLedger{
+		records:  []models.UsageRecord{},
+		all:      newUsageAggregate(),
+		sessions: make(map[string]*usageAggregate),
+		pricing:  pricing,
+	}
+}
+
+// RecordUsage prices the record from the table when the model is listed,
+// otherwise it keeps the provider-reported cost.
+func (ul *UsageLedger) RecordUsage(record models.UsageRecord) {
+	if cost, ok := ul.price(record); ok {
+		record.Cost = cost
+	}
+
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	ul.all.add(record)
+	session := ul.sessions[record.SessionID]
+	if session == nil {
+		session = newUsageAggregate()
+		ul.sessions[record.SessionID] = session
+	}
+	session.add(record)
+
+	if len(ul.records) < MaxUsageRecords {
+		ul.records = append(ul.records, record)
+		return
+	}
+	ul.records[ul.next] = record
+	ul.next = (ul.next + 1) % MaxUsageRecords
+}
+
+func (ul *UsageLedger) price(record models.UsageRecord) (float64, bool) {
+	if ul.pricing == nil {
+		return 0, false
+	}
+
+	price, ok := ul.pricing.Models[record.Model]
+	if !ok {
+		return 0, false
+	}
+
+	cachedPrice := price.CachedPrompt
+	if cachedPrice == 0 {
+		cachedPrice = price.Prompt
+	}
+
+	uncached := max(record.PromptTokens-record.CachedTokens, 0)
+	cost := float64(uncached)*price.Prompt +
+		float64(record.CachedTokens)*cachedPrice +
+		float64(record.CompletionTokens)*price.Completion
+
+	return cost / 1_000_000, true
+}
+
+// Summary totals the calls of one session, or of every session when sessionID is empty.
+func (ul *UsageLedger) Summary(sessionID string) UsageSummary {
+	summary := UsageSummary{
+		SessionID: sessionID,
+		Currency:  "USD",
+		ByAgent:   make(map[string]*UsageTotals),
+		ByModel:   make(map[string]*UsageTotals),
+	}
+	if ul.pricing != nil && ul.pricing.Currency != "" {
+		summary.Currency = ul.pricing.Currency
+	}
+
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	aggregate := ul.all
+	if sessionID != "" {
+		aggregate = ul.sessions[sessionID]
+	}
+	if aggregate == nil {
+		return summary
+	}
+
+	// Copies, so the caller never shares totals the ledger is still adding to
+	summary.Total = aggregate.total
+	for agent, totals := range aggregate.byAgent {
+		copied := *totals
+		summary.ByAgent[agent] = &copied
+	}
+	for model, totals := range aggregate.byModel {
+		copied := *totals
+		summary.ByModel[model] = &copied
+	}
+	return summary
+}
+
+// Records returns the retained calls of one session, or of every session when sessionID is
+// empty, oldest first. Calls older than the last MaxUsageRecords are only in the totals.
+func (ul *UsageLedger) Records(sessionID string) []models.UsageRecord {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	var records []models.UsageRecord
+	for i := range ul.records {
+		record := ul.records[(ul.next+i)%len(ul.records)]
+		if sessionID == "" || record.SessionID == sessionID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
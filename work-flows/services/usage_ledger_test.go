@@ -0,0 +1,121 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"ai-agent/utils"
+	"ai-agent/work-flows/models"
+)
+
+func TestUsageLedgerRingBuffer(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls int
+	}{
+		{name: "below capacity", calls: 3},
+		{name: "at capacity", calls: MaxUsageRecords},
+		{name: "wrapped", calls: MaxUsageRecords + 5},
+		{name: "wrapped twice", calls: 2*MaxUsageRecords + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewUsageLedger(nil)
+			for i := range tt.calls {
+				session := "a"
+				if i%2 == 1 {
+					session = "b"
+				}
+				ledger.RecordUsage(models.UsageRecord{SessionID: session, Model: "m", PromptTokens: 1, Timestamp: int64(i)})
+			}
+
+			records := ledger.Records("")
+			kept := min(tt.calls, MaxUsageRecords)
+			if len(records) != kept {
+				t.Fatalf("got %d records, want %d", len(records), kept)
+			}
+			// The newest records are kept, oldest first
+			for i, record := range records {
+				if want := int64(tt.calls - kept + i); record.Timestamp != want {
+					t.Fatalf("record %d has timestamp %d, want %d", i, record.Timestamp, want)
+				}
+			}
+			for _, record := range ledger.Records("a") {
+				if record.SessionID != "a" {
+					t.Fatalf("got a record of session %q in session a's records", record.SessionID)
+				}
+			}
+
+			// Totals still count every call
+			if got := ledger.Summary("").Total; got.Calls != tt.calls || got.PromptTokens != tt.calls {
+				t.Errorf("got total %+v, want %d calls", got, tt.calls)
+			}
+			if got, want := ledger.Summary("a").Total.Calls, (tt.calls+1)/2; got != want {
+				t.Errorf("got %d calls for session a, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestUsageLedgerSummary(t *testing.T) {
+	pricing := &utils.PricingConfig{
+		Currency: "EUR",
+		Models:   map[string]utils.ModelPrice{"priced": {Prompt: 1, Completion: 2, CachedPrompt: 0.5}},
+	}
+	ledger := NewUsageLedger(pricing)
+	// Priced from the table: (800*1 + 200*0.5 + 500*2) / 1M, whatever the provider reported
+	ledger.RecordUsage(models.UsageRecord{SessionID: "s1", Agent: "ConversationAgent", Model: "priced", PromptTokens: 1000, CachedTokens: 200, CompletionTokens: 500, Cost: 9})
+	// Not in the table, so the provider's cost is kept
+	ledger.RecordUsage(models.UsageRecord{SessionID: "s1", Agent: "EvaluateAgent", Model: "unpriced", PromptTokens: 100, Cost: 0.01})
+	ledger.RecordUsage(models.UsageRecord{SessionID: "s2", Agent: "ConversationAgent", Model: "unpriced", PromptTokens: 10, Cost: 0.02})
+
+	tests := []struct {
+		session     string
+		wantCalls   int
+		wantCost    float64
+		wantByAgent map[string]int // Calls per agent
+		wantByModel map[string]int // Calls per model
+	}{
+		{
+			session:     "",
+			wantCalls:   3,
+			wantCost:    0.0019 + 0.01 + 0.02,
+			wantByAgent: map[string]int{"ConversationAgent": 2, "EvaluateAgent": 1},
+			wantByModel: map[string]int{"priced": 1, "unpriced": 2},
+		},
+		{
+			session:     "s1",
+			wantCalls:   2,
+			wantCost:    0.0019 + 0.01,
+			wantByAgent: map[string]int{"ConversationAgent": 1, "EvaluateAgent": 1},
+			wantByModel: map[string]int{"priced": 1, "unpriced": 1},
+		},
+		{session: "missing", wantByAgent: map[string]int{}, wantByModel: map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run("session "+tt.session, func(t *testing.T) {
+			summary := ledger.Summary(tt.session)
+			if summary.Currency != "EUR" {
+				t.Errorf("got currency %q, want EUR", summary.Currency)
+			}
+			if summary.Total.Calls != tt.wantCalls || math.Abs(summary.Total.Cost-tt.wantCost) > 1e-9 {
+				t.Errorf("got %d calls costing %g, want %d costing %g", summary.Total.Calls, summary.Total.Cost, tt.wantCalls, tt.wantCost)
+			}
+			if len(summary.ByAgent) != len(tt.wantByAgent) || len(summary.ByModel) != len(tt.wantByModel) {
+				t.Fatalf("got agents %v and models %v, want %v and %v", summary.ByAgent, summary.ByModel, tt.wantByAgent, tt.wantByModel)
+			}
+			for agent, calls := range tt.wantByAgent {
+				if totals := summary.ByAgent[agent]; totals == nil || totals.Calls != calls {
+					t.Errorf("got %+v for agent %s, want %d calls", totals, agent, calls)
+				}
+			}
+			for model, calls := range tt.wantByModel {
+				if totals := summary.ByModel[model]; totals == nil || totals.Calls != calls {
+					t.Errorf("got %+v for model %s, want %d calls", totals, model, calls)
+				}
+			}
+		})
+	}
+}